@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 var labelseq int = 1
@@ -10,14 +12,40 @@ var labelseq int = 1
 // Lower 8-bit register (1 byte).
 var argreg1 = []string{"dil", "sil", "dl", "cl", "r8b", "r9b"}
 
+// Lower 16-bit register (2 bytes).
+var argreg2 = []string{"di", "si", "dx", "cx", "r8w", "r9w"}
+
+// Lower 32-bit register (4 bytes).
+var argreg4 = []string{"edi", "esi", "edx", "ecx", "r8d", "r9d"}
+
 // 64-bit register (8 bytes).
 var argreg8 = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
 var funcname string
 
+// Names of a register from 8 bytes to 1 byte.
+type register [4]string
+
+var (
+	regRAX = register{"rax", "eax", "ax", "al"}
+	regRDI = register{"rdi", "edi", "di", "dil"}
+	regR10 = register{"r10", "r10d", "r10w", "r10b"}
+)
+
+func argRegister(i int) register {
+	return register{argreg8[i], argreg4[i], argreg2[i], argreg1[i]}
+}
+
+// The maximum number of words returned by a function. The words other than
+// the first two, which are returned in RAX and RDX, are passed through the
+// buffer `.Lret.buf`.
+var retWords int
+
 func genAddr(node interface{}) {
 	switch n := node.(type) {
 	case *Var:
-		if n.isLocal {
+		if n.ref != nil {
+			fmt.Printf("  push [rbp-%d]\n", n.ref.offset)
+		} else if n.isLocal {
 			fmt.Printf("  lea rax, [rbp-%d]\n", n.offset)
 			fmt.Printf("  push rax\n")
 		} else {
@@ -28,23 +56,43 @@ func genAddr(node interface{}) {
 		gen(n.child)
 		return
 	case *ArrayRef:
-		if n.lhs.getType().kind == TY_STRING {
+		switch ty := n.lhs.getType(); ty.kind {
+		case TY_MAP:
+			// A missing entry is inserted with the zero value.
+			gen(n.lhs)
+			kw := genMapKey(ty, n.rhs)
+			callMap(".Lmap.assign", 0, kw)
+			fmt.Printf("  add rsp, %d\n", 8*(kw+1))
+			fmt.Printf("  push rax\n")
+			return
+		case TY_STRING:
 			genAddr(n.lhs)
 			gen(n.rhs)
 			// index stored in right-size node.
 			fmt.Printf("  pop rdi\n")
 			// pointer to string object stored in left-size node.
 			fmt.Printf("  pop rax\n")
+			fmt.Printf("  mov rsi, [rax+8]\n")
+			genIndexCheck()
 			fmt.Printf("  mov rax, [rax]\n")
-			fmt.Printf("  add rax, rdi\n")
-			fmt.Printf("  push rax\n")
-			return
+		case TY_SLICE:
+			gen(n.lhs)
+			gen(n.rhs)
+			fmt.Printf("  pop rdi\n") // index
+			fmt.Printf("  pop rcx\n") // capacity
+			fmt.Printf("  pop rsi\n") // length
+			fmt.Printf("  pop rax\n") // pointer to the elements
+			genIndexCheck()
+		default:
+			genAddr(n.lhs)
+			gen(n.rhs)
+			fmt.Printf("  pop rdi\n") // index stored in right-side node.
+			fmt.Printf("  pop rax\n") // address stored in left-size node.
+			if ty.kind == TY_ARRAY {
+				fmt.Printf("  mov rsi, %d\n", ty.aryLen)
+				genIndexCheck()
+			}
 		}
-
-		genAddr(n.lhs)
-		gen(n.rhs)
-		fmt.Printf("  pop rdi\n") // index stored in right-side node.
-		fmt.Printf("  pop rax\n") // address stored in left-size node.
 		fmt.Printf("  imul rdi, %d\n", n.ty.size)
 		fmt.Printf("  add rax, rdi\n")
 		fmt.Printf("  push rax\n")
@@ -52,40 +100,368 @@ func genAddr(node interface{}) {
 	case *StringLit:
 		fmt.Printf("  push offset %s.obj\n", n.label)
 		return
+	case *Selector:
+		if n.tmp != nil {
+			// Store the value in a temporary variable to take its address.
+			genAddr(n.tmp)
+			gen(n.lhs)
+			store(n.lhs.getType())
+			genAddr(n.tmp)
+		} else {
+			genAddr(n.lhs)
+		}
+		fmt.Printf("  pop rax\n")
+		fmt.Printf("  add rax, %d\n", n.field.offset)
+		fmt.Printf("  push rax\n")
+		return
+	case *CompositeLit:
+		genCompositeLit(n)
+		return
+	case *SliceExpr, *MapLit:
+		if e := node.(Expr); isCompositeLit(e) {
+			// The slice or the map is stored in a new variable on the
+			// heap to take its address.
+			ty := e.getType()
+			fmt.Printf("  mov rdi, %d\n", ty.size)
+			fmt.Printf("  call .Lruntime.alloc\n")
+			fmt.Printf("  push rax\n")
+			fmt.Printf("  push rax\n")
+			gen(n)
+			store(ty)
+			return
+		}
 	}
 	panic(fmt.Sprintf("not a lvalue %#v", node))
 }
 
-func load(ty *Type) {
-	if ty.kind == TY_INT8 {
-		fmt.Printf("  pop rax\n")
-		fmt.Printf("  movzx rax, byte ptr [rax]\n")
+// genIndexCheck checks that the index in RDI is less than the length in
+// RSI. Otherwise the program panics. A negative index is a large
+// unsigned one.
+func genIndexCheck() {
+	fmt.Printf("  cmp rdi, rsi\n")
+	fmt.Printf("  jae .Lpanic.index\n")
+}
+
+// genSlice emits a slice expression. The pointer, the length and the
+// capacity of the operand are pushed first, and then the indices with
+// their default values.
+func genSlice(n *SliceExpr) {
+	ty := n.lhs.getType()
+	size := 1
+	switch ty.kind {
+	case TY_ARRAY:
+		size = ty.base.size
+		genAddr(n.lhs)
+		fmt.Printf("  push %d\n", ty.aryLen)
+		fmt.Printf("  push %d\n", ty.aryLen)
+	case TY_STRING:
+		// The capacity of a string is its length.
+		gen(n.lhs)
+		fmt.Printf("  push [rsp]\n")
+	case TY_SLICE:
+		size = ty.base.size
+		gen(n.lhs)
+	}
+	if n.low != nil {
+		gen(n.low)
+	} else {
+		fmt.Printf("  push 0\n")
+	}
+	if n.high != nil {
+		gen(n.high)
+	} else {
+		fmt.Printf("  push [rsp+16]\n")
+	}
+	if n.max != nil {
+		gen(n.max)
+	} else {
+		fmt.Printf("  push [rsp+16]\n")
+	}
+
+	fmt.Printf("  pop rdx\n") // max
+	fmt.Printf("  pop rsi\n") // high
+	fmt.Printf("  pop rdi\n") // low
+	fmt.Printf("  pop rcx\n") // capacity
+	fmt.Printf("  pop rax\n") // length
+	fmt.Printf("  pop rax\n") // pointer
+	// 0 <= low <= high <= max <= capacity.
+	fmt.Printf("  cmp rdx, rcx\n")
+	fmt.Printf("  ja .Lpanic.slice\n")
+	fmt.Printf("  cmp rsi, rdx\n")
+	fmt.Printf("  ja .Lpanic.slice\n")
+	fmt.Printf("  cmp rdi, rsi\n")
+	fmt.Printf("  ja .Lpanic.slice\n")
+	fmt.Printf("  imul rcx, rdi, %d\n", size)
+	fmt.Printf("  add rax, rcx\n")
+	fmt.Printf("  push rax\n")
+	fmt.Printf("  sub rsi, rdi\n")
+	fmt.Printf("  push rsi\n")
+	if n.ty.kind == TY_SLICE {
+		fmt.Printf("  sub rdx, rdi\n")
+		fmt.Printf("  push rdx\n")
+	}
+}
+
+// mapIndex returns e as an index expression of a map if it is.
+func mapIndex(e Expr) (*ArrayRef, bool) {
+	a, ok := e.(*ArrayRef)
+	return a, ok && a.lhs.getType().kind == TY_MAP
+}
+
+// genMapKey pushes a key of the map type ty for the runtime routines, and
+// returns the number of its words. The key is laid out in memory from RSP.
+func genMapKey(ty *Type, key Expr) int {
+	gen(key)
+	kw := wordCount(ty.key)
+	for i := 0; i < kw/2; i++ {
+		j := kw - 1 - i
+		fmt.Printf("  mov rax, [rsp+%d]\n", 8*i)
+		fmt.Printf("  mov rdi, [rsp+%d]\n", 8*j)
+		fmt.Printf("  mov [rsp+%d], rdi\n", 8*i)
+		fmt.Printf("  mov [rsp+%d], rax\n", 8*j)
+	}
+	return kw
+}
+
+// callMap calls a map routine with the key of kw words at [rsp+off] and
+// the map just under it. The result is returned in RAX.
+func callMap(routine string, off int, kw int) {
+	fmt.Printf("  mov rdi, [rsp+%d]\n", off+8*kw)
+	fmt.Printf("  lea rsi, [rsp+%d]\n", off)
+	fmt.Printf("  call %s\n", routine)
+}
+
+// genMapIndex pushes the value of `m[k]`, or the zero value if the map
+// has no such key. `v, ok := m[k]` pushes ok after the value.
+func genMapIndex(n *ArrayRef, commaOk bool) {
+	gen(n.lhs)
+	kw := genMapKey(n.lhs.getType(), n.rhs)
+	callMap(".Lmap.access", 0, kw)
+	fmt.Printf("  add rsp, %d\n", 8*(kw+1))
+	pushMapValue(n.ty, commaOk)
+}
+
+// pushMapValue pushes the value of ty at the address in RAX returned by
+// `.Lmap.access`, or the zero value if it is 0.
+func pushMapValue(ty *Type, commaOk bool) {
+	seq := labelseq
+	labelseq++
+	fmt.Printf("  cmp rax, 0\n")
+	fmt.Printf("  je .Lzero%d\n", seq)
+	fmt.Printf("  push rax\n")
+	load(ty)
+	if commaOk {
+		fmt.Printf("  push 1\n")
+	}
+	fmt.Printf("  jmp .Lend%d\n", seq)
+	fmt.Printf(".Lzero%d:\n", seq)
+	for i := 0; i < wordCount(ty); i++ {
+		fmt.Printf("  push 0\n")
+	}
+	if commaOk {
+		fmt.Printf("  push 0\n")
+	}
+	fmt.Printf(".Lend%d:\n", seq)
+}
+
+// genMapAssign stores a value of ty to an entry of a map. The map and the
+// key of kw words are under the value. They are all popped. The entry is
+// inserted after the value is evaluated as the table may grow.
+func genMapAssign(ty *Type, kw int) {
+	vw := wordCount(ty)
+	callMap(".Lmap.assign", 8*vw, kw)
+	fmt.Printf("  push rax\n")
+	storeAt(ty, 0, 8)
+	fmt.Printf("  add rsp, %d\n", 8*(vw+kw+2))
+}
+
+// genMapLit builds a map from a composite literal and pushes it.
+func genMapLit(n *MapLit) {
+	genNewMap(n.ty)
+	for i, k := range n.keys {
+		fmt.Printf("  push [rsp]\n")
+		kw := genMapKey(n.ty, k)
+		gen(n.vals[i])
+		genMapAssign(n.ty.base, kw)
+	}
+}
+
+// genNewMap pushes a new empty map of ty.
+func genNewMap(ty *Type) {
+	isstr := 0
+	if ty.key.kind == TY_STRING {
+		isstr = 1
+	}
+	fmt.Printf("  mov rdi, %d\n", 8*wordCount(ty.key))
+	fmt.Printf("  mov rsi, %d\n", 8*wordCount(ty.base))
+	fmt.Printf("  mov rdx, %d\n", isstr)
+	fmt.Printf("  call .Lmap.new\n")
+	fmt.Printf("  push rax\n")
+}
+
+// genCompositeLit builds a struct from a composite literal and pushes its
+// address. The struct is allocated by the runtime if it is on the heap.
+func genCompositeLit(n *CompositeLit) {
+	if n.heap {
+		fmt.Printf("  mov rdi, %d\n", n.ty.size)
+		fmt.Printf("  call .Lruntime.alloc\n")
 		fmt.Printf("  push rax\n")
-	} else if ty.kind == TY_STRING {
-		fmt.Printf("  pop rax\n")
-		fmt.Printf("  mov rdi, [rax]\n")
-		fmt.Printf("  push rdi\n") // pointer to string
-		fmt.Printf("  mov rdi, [rax+8]\n")
-		fmt.Printf("  push rdi\n") // length of string
 	} else {
-		fmt.Printf("  pop rax\n")
-		fmt.Printf("  mov rax, [rax]\n")
+		// The variable is cleared every time the literal is evaluated.
+		genAddr(n.tmp)
+		fmt.Printf("  mov rax, [rsp]\n")
+		zeroFill(n.ty.size)
+	}
+	for i, f := range n.fields {
+		fmt.Printf("  mov rax, [rsp]\n")
+		fmt.Printf("  add rax, %d\n", f.offset)
 		fmt.Printf("  push rax\n")
+		gen(n.vals[i])
+		store(f.ty)
 	}
 }
 
-func store(ty *Type) {
-	if ty.kind == TY_STRING {
-		fmt.Printf("  pop rsi\n")
-		fmt.Printf("  pop rdi\n")
-		fmt.Printf("  pop rax\n")
-		fmt.Printf("  mov [rax], rdi\n")
-		fmt.Printf("  mov [rax+8], rsi\n")
+// zeroFill sets size bytes at the address in RAX to zero.
+func zeroFill(size int) {
+	fmt.Printf("  mov rdi, 0\n")
+	for off := 0; off < size; off += 8 {
+		storeBytes(regRDI, "rax", off, size-off)
+	}
+}
+
+// wordSize returns the number of bytes of the i-th word of a value of ty.
+func wordSize(ty *Type, i int) int {
+	if ty.kind == TY_NONE || ty.size-8*i > 8 {
+		return 8
+	}
+	return ty.size - 8*i
+}
+
+// loadBytes loads n bytes at [base+off] to reg with zero extension.
+// R11 is used as a scratch register.
+func loadBytes(reg register, base string, off int, n int) {
+	switch n {
+	case 8:
+		fmt.Printf("  mov %s, [%s%+d]\n", reg[0], base, off)
+		return
+	case 4:
+		fmt.Printf("  mov %s, dword ptr [%s%+d]\n", reg[1], base, off)
+		return
+	case 2:
+		fmt.Printf("  movzx %s, word ptr [%s%+d]\n", reg[0], base, off)
+		return
+	case 1:
+		fmt.Printf("  movzx %s, byte ptr [%s%+d]\n", reg[0], base, off)
 		return
 	}
-	fmt.Printf("  pop rdi\n")
+
+	// Combine smaller loads not to read beyond the value.
+	fmt.Printf("  mov %s, 0\n", reg[0])
+	for shift := 0; n > 0; {
+		size := 1
+		if n >= 4 {
+			size = 4
+		} else if n >= 2 {
+			size = 2
+		}
+		loadBytes(register{"r11", "r11d", "r11w", "r11b"}, base, off, size)
+		fmt.Printf("  shl r11, %d\n", shift)
+		fmt.Printf("  or %s, r11\n", reg[0])
+		shift += size * 8
+		off += size
+		n -= size
+	}
+}
+
+// storeBytes stores the lower n bytes of reg to [base+off]. The value of
+// reg may be broken.
+func storeBytes(reg register, base string, off int, n int) {
+	for n > 0 {
+		switch {
+		case n >= 8:
+			fmt.Printf("  mov [%s%+d], %s\n", base, off, reg[0])
+			return
+		case n >= 4:
+			fmt.Printf("  mov dword ptr [%s%+d], %s\n", base, off, reg[1])
+			fmt.Printf("  shr %s, 32\n", reg[0])
+			off += 4
+			n -= 4
+		case n >= 2:
+			fmt.Printf("  mov word ptr [%s%+d], %s\n", base, off, reg[2])
+			fmt.Printf("  shr %s, 16\n", reg[0])
+			off += 2
+			n -= 2
+		default:
+			fmt.Printf("  mov byte ptr [%s%+d], %s\n", base, off, reg[3])
+			fmt.Printf("  shr %s, 8\n", reg[0])
+			off++
+			n--
+		}
+	}
+}
+
+// load pops an address and pushes the value of ty at the address. A value
+// bigger than 8 bytes is pushed word by word from the lowest address.
+func load(ty *Type) {
 	fmt.Printf("  pop rax\n")
-	fmt.Printf("  mov [rax], rdi\n")
+	// Signed integers are sign-extended.
+	switch ty.kind {
+	case TY_INT8:
+		fmt.Printf("  movsx rdi, byte ptr [rax]\n")
+		fmt.Printf("  push rdi\n")
+		return
+	case TY_INT16:
+		fmt.Printf("  movsx rdi, word ptr [rax]\n")
+		fmt.Printf("  push rdi\n")
+		return
+	}
+	for i := 0; i < wordCount(ty); i++ {
+		loadBytes(regRDI, "rax", 8*i, wordSize(ty, i))
+		fmt.Printf("  push rdi\n")
+	}
+}
+
+// store pops a value of ty and an address under it, and stores the value
+// to the address.
+func store(ty *Type) {
+	n := wordCount(ty)
+	storeAt(ty, 8*n, 0)
+	fmt.Printf("  add rsp, %d\n", 8*(n+1))
+}
+
+// storeAt stores a value of ty at [rsp+valOff] to the address at
+// [rsp+addrOff] without popping them.
+func storeAt(ty *Type, addrOff int, valOff int) {
+	n := wordCount(ty)
+	fmt.Printf("  mov rax, [rsp+%d]\n", addrOff)
+	for i := 0; i < n; i++ {
+		fmt.Printf("  mov rdi, [rsp+%d]\n", valOff+8*(n-1-i))
+		storeBytes(regRDI, "rax", 8*i, wordSize(ty, i))
+	}
+}
+
+// truncate truncates an integer in RAX to the size of ty. Signed integers
+// are sign-extended and unsigned ones are zero-extended.
+func truncate(ty *Type) {
+	switch ty.kind {
+	case TY_INT8:
+		fmt.Printf("  movsx rax, al\n")
+	case TY_INT16:
+		fmt.Printf("  movsx rax, ax\n")
+	case TY_INT32:
+		fmt.Printf("  movsxd rax, eax\n")
+	case TY_UINT8:
+		fmt.Printf("  movzx eax, al\n")
+	case TY_UINT16:
+		fmt.Printf("  movzx eax, ax\n")
+	case TY_UINT32:
+		fmt.Printf("  mov eax, eax\n")
+	}
+}
+
+// discard throws away a value of ty on the top of the stack.
+func discard(ty *Type) {
+	fmt.Printf("  add rsp, %d\n", 8*wordCount(ty))
 }
 
 func isEmpty(node interface{}) bool {
@@ -103,26 +479,62 @@ func gen(node interface{}) {
 	switch n := node.(type) {
 	case *Empty:
 		return
+	case *VarDecl:
+		if n.v.ref != nil {
+			allocVar(n.v)
+			return
+		}
+		if n.assigned {
+			return
+		}
+		// A variable in a loop is cleared in every iteration.
+		genAddr(n.v)
+		fmt.Printf("  pop rax\n")
+		zeroFill(n.v.ty.size)
+		return
 	case *IntLit:
-		fmt.Printf("  push %d\n", n.val)
+		val := n.val.Int64()
+		// `push` only takes a 32-bit immediate.
+		if val != int64(int32(val)) {
+			fmt.Printf("  movabs rax, %d\n", val)
+			fmt.Printf("  push rax\n")
+			return
+		}
+		fmt.Printf("  push %d\n", val)
 		return
 	case *StringLit:
 		fmt.Printf("  push offset %s\n", n.label)
 		fmt.Printf("  push %d\n", len(n.val))
 		return
+	case *Nil:
+		for i := 0; i < wordCount(n.ty); i++ {
+			fmt.Printf("  push 0\n")
+		}
+		return
 	case *Var:
 		genAddr(n)
 		load(n.ty)
 		return
 	case *Assign:
-		if len(n.lvals) != len(n.rvals) {
-			panic(fmt.Sprintf("Not same length %d != %d", len(n.lvals), len(n.rvals)))
-		}
-		for i := range n.lvals {
-			genAddr(n.lvals[i])
-			gen(n.rvals[i])
-			store(n.lvals[i].getType())
+		if len(n.lvals) == 1 {
+			if _, ok := n.lvals[0].(*Blank); ok {
+				gen(n.rvals[0])
+				discard(n.rvals[0].getType())
+				return
+			}
+			if a, ok := mapIndex(n.lvals[0]); ok {
+				gen(a.lhs)
+				kw := genMapKey(a.lhs.getType(), a.rhs)
+				gen(n.rvals[0])
+				genMapAssign(a.ty, kw)
+				return
+			}
+			genAddr(n.lvals[0])
+			gen(n.rvals[0])
+			store(n.lvals[0].getType())
+			return
 		}
+		genTupleAssign(n)
 		return
 	case *Addr:
 		genAddr(n.child)
@@ -131,9 +543,115 @@ func gen(node interface{}) {
 		gen(n.child)
 		load(n.ty)
 		return
-	case *ArrayRef:
+	case *Conv:
+		if n.ty.kind == TY_INTERFACE {
+			genToInterface(n)
+			return
+		}
+		from := n.child.getType()
+		gen(n.child)
+		switch {
+		case n.ty.kind == TY_STRING && isInteger(from):
+			fmt.Printf("  pop rdi\n")
+			fmt.Printf("  call .Lruntime.encoderune\n")
+			fmt.Printf("  push rax\n")
+			fmt.Printf("  push rdx\n")
+		case isRunes(from, n.ty):
+			// The capacity is dropped.
+			fmt.Printf("  add rsp, 8\n")
+			fmt.Printf("  pop rsi\n")
+			fmt.Printf("  pop rdi\n")
+			fmt.Printf("  call .Lruntime.runestring\n")
+			fmt.Printf("  push rax\n")
+			fmt.Printf("  push rdx\n")
+		case isRunes(n.ty, from):
+			fmt.Printf("  pop rsi\n")
+			fmt.Printf("  pop rdi\n")
+			fmt.Printf("  call .Lruntime.runes\n")
+			fmt.Printf("  push rax\n")
+			fmt.Printf("  push rdx\n")
+			// The capacity is the length.
+			fmt.Printf("  push rdx\n")
+		case n.ty.kind == TY_STRING && from.kind == TY_SLICE:
+			// The capacity is dropped.
+			fmt.Printf("  add rsp, 8\n")
+			genCopyBytes()
+		case n.ty.kind == TY_SLICE && from.kind == TY_STRING:
+			genCopyBytes()
+			// The capacity is the length.
+			fmt.Printf("  push [rsp]\n")
+		case isInteger(n.ty):
+			fmt.Printf("  pop rax\n")
+			truncate(n.ty)
+			fmt.Printf("  push rax\n")
+		}
+		return
+	case *Not:
+		gen(n.child)
+		fmt.Printf("  pop rax\n")
+		fmt.Printf("  cmp rax, 0\n")
+		fmt.Printf("  sete al\n")
+		fmt.Printf("  movzx rax, al\n")
+		fmt.Printf("  push rax\n")
+		return
+	case *BitNot:
+		gen(n.child)
+		fmt.Printf("  pop rax\n")
+		fmt.Printf("  not rax\n")
+		truncate(n.ty)
+		fmt.Printf("  push rax\n")
+		return
+	case *FuncName:
+		fmt.Printf("  lea rax, %s[rip]\n", funcLabel(n.fn))
+		fmt.Printf("  push rax\n")
+		return
+	case *MethodExpr:
+		fmt.Printf("  lea rax, %s[rip]\n", funcLabel(n.fn))
+		fmt.Printf("  push rax\n")
+		return
+	case *ArrayRef, *Selector, *CompositeLit:
+		if s, ok := n.(*Selector); ok && s.bound != nil {
+			genMethodValue(s)
+			return
+		}
+		if a, ok := mapIndex(n.(Expr)); ok {
+			genMapIndex(a, false)
+			return
+		}
 		genAddr(n)
-		load(n.ty)
+		load(n.(Expr).getType())
+		return
+	case *CommaOk:
+		if t, ok := n.child.(*TypeAssert); ok {
+			genTypeAssert(t, true)
+			return
+		}
+		genMapIndex(n.child.(*ArrayRef), true)
+		return
+	case *TypeAssert:
+		genTypeAssert(n, false)
+		return
+	case *MapLit:
+		genMapLit(n)
+		return
+	case *OpAssign:
+		if a, ok := mapIndex(n.lhs); ok {
+			gen(a.lhs)
+			kw := genMapKey(a.lhs.getType(), a.rhs)
+			callMap(".Lmap.access", 0, kw)
+			pushMapValue(a.ty, false)
+			gen(n.rhs)
+			genOpAssign(n.op, a.ty)
+			genMapAssign(a.ty, kw)
+			return
+		}
+		genAddr(n.lhs)
+		// Keep the address to store the result.
+		fmt.Printf("  push [rsp]\n")
+		load(n.lhs.getType())
+		gen(n.rhs)
+		genOpAssign(n.op, n.lhs.getType())
+		store(n.lhs.getType())
 		return
 	case *Block:
 		for _, c := range n.children {
@@ -143,7 +661,7 @@ func gen(node interface{}) {
 	case *ExprStmt:
 		gen(n.child)
 		// Throw away the result of an expression.
-		fmt.Printf("  add rsp, 8\n")
+		discard(n.child.getType())
 		return
 	case *If:
 		seq := labelseq
@@ -171,7 +689,8 @@ func gen(node interface{}) {
 		}
 		return
 	case *For:
-		seq := labelseq
+		n.seq = labelseq
+		seq := n.seq
 		labelseq++
 		if !isEmpty(n.init) {
 			gen(n.init)
@@ -184,124 +703,2083 @@ func gen(node interface{}) {
 			fmt.Printf("  je  .Lend%d\n", seq)
 		}
 		gen(n.then)
+		fmt.Printf(".Lcontinue%d:\n", seq)
+		// Each iteration has new variables, which start with the values
+		// at the end of the previous one.
+		for _, v := range n.vars {
+			if v.ref != nil {
+				fmt.Printf("  push [rbp-%d]\n", v.ref.offset)
+				allocVar(v)
+				fmt.Printf("  mov rdi, rax\n")
+				fmt.Printf("  pop rsi\n")
+				fmt.Printf("  mov rdx, %d\n", v.ty.size)
+				fmt.Printf("  call .Lruntime.memmove\n")
+			}
+		}
 		if !isEmpty(n.post) {
 			gen(n.post)
 		}
 		fmt.Printf("  jmp .Lbegin%d\n", seq)
 		fmt.Printf(".Lend%d:\n", seq)
 		return
+	case *Range:
+		genRange(n)
+		return
+	case *Switch:
+		genSwitch(n)
+		return
+	case *Labeled:
+		fmt.Printf(".Llabel.%s.%s:\n", funcname, n.name)
+		gen(n.stmt)
+		return
+	case *Branch:
+		genBranch(n)
+		return
+	case *RangeNext:
+		genRangeNext(n)
+		return
 	case *Return:
-		gen(n.child)
-		fmt.Printf("  pop rax\n")
-		fmt.Printf("  jmp .Lreturn.%s\n", funcname)
+		genReturn(n)
 		return
 	case *FuncCall:
-		for _, arg := range n.args {
-			gen(arg)
-		}
-		for i := len(n.args) - 1; i >= 0; i-- {
-			fmt.Printf("  pop %s\n", argreg8[i])
-		}
-
-		// We need to align RSP to a 16 byte boundary before
-		// calling a function because it is an ABI requirement.
-		// RAX is set to 0 for variadic function.
-		seq := labelseq
-		labelseq++
-		fmt.Printf("  mov rax, rsp\n")
-		fmt.Printf("  and rax, 15\n")
-		fmt.Printf("  jnz .Lcall%d\n", seq)
-		fmt.Printf("  mov rax, 0\n")
-		fmt.Printf("  call %s\n", n.name)
-		fmt.Printf("  jmp .Lend%d\n", seq)
-		fmt.Printf(".Lcall%d:\n", seq)
-		fmt.Printf("  sub rsp, 8\n")
-		fmt.Printf("  mov rax, 0\n")
-		fmt.Printf("  call %s\n", n.name)
-		fmt.Printf("  add rsp, 8\n")
-		fmt.Printf(".Lend%d:\n", seq)
-		fmt.Printf("  push rax\n")
+		genCall(n)
 		return
-	case *Stdlib:
-		for _, arg := range n.args {
-			gen(arg)
-		}
-		fmt.Printf("  call %s\n", n.name)
+	case *BuiltinCall:
+		genBuiltin(n)
+		return
+	case *SliceExpr:
+		genSlice(n)
 		return
 	}
 
 	n := node.(*Binary)
+	if n.op == "&&" || n.op == "||" {
+		genLogical(n)
+		return
+	}
 	gen(n.lhs)
 	gen(n.rhs)
+	if n.lhs.getType().kind == TY_INTERFACE {
+		fmt.Printf("  mov rcx, [rsp]\n")
+		fmt.Printf("  mov rdx, [rsp+8]\n")
+		fmt.Printf("  mov rsi, [rsp+16]\n")
+		fmt.Printf("  mov rdi, [rsp+24]\n")
+		fmt.Printf("  add rsp, 32\n")
+		fmt.Printf("  call .Lruntime.ifaceeq\n")
+		if n.op == "!=" {
+			fmt.Printf("  xor rax, 1\n")
+		}
+		fmt.Printf("  push rax\n")
+		return
+	}
+	if n.lhs.getType().kind == TY_STRING && n.op == "+" {
+		genConcat()
+		return
+	}
+	if n.lhs.getType().kind == TY_STRING {
+		// Strings are compared by their contents.
+		fmt.Printf("  mov rcx, [rsp]\n")
+		fmt.Printf("  mov rdx, [rsp+8]\n")
+		fmt.Printf("  mov rsi, [rsp+16]\n")
+		fmt.Printf("  mov rdi, [rsp+24]\n")
+		fmt.Printf("  add rsp, 32\n")
+		fmt.Printf("  call .Lruntime.strcmp\n")
+		fmt.Printf("  mov rdi, 0\n")
+		genBinop(n.op, n.lhs.getType())
+		fmt.Printf("  push rax\n")
+		return
+	}
+	if k := n.lhs.getType().kind; k == TY_STRUCT || k == TY_ARRAY {
+		genEqual(n)
+		return
+	}
+	if n.lhs.getType().kind == TY_SLICE {
+		// A slice is only compared to nil by its pointer.
+		fmt.Printf("  mov rax, [rsp+40]\n")
+		fmt.Printf("  mov rdi, [rsp+16]\n")
+		fmt.Printf("  add rsp, 48\n")
+		genBinop(n.op, n.lhs.getType())
+		fmt.Printf("  push rax\n")
+		return
+	}
 	fmt.Printf("  pop rdi\n")
 	fmt.Printf("  pop rax\n")
+	genBinop(n.op, n.lhs.getType())
+	truncate(n.ty)
+	fmt.Printf("  push rax\n")
+}
 
-	switch n.op {
-	case "+":
-		fmt.Printf("  add rax, rdi\n")
-	case "-":
-		fmt.Printf("  sub rax, rdi\n")
-	case "*":
-		fmt.Printf("  imul rax, rdi\n")
-	case "/":
-		fmt.Printf("  cqo\n")
-		fmt.Printf("  idiv rdi\n")
-	case "==":
-		fmt.Printf("  cmp rax, rdi\n")
-		fmt.Printf("  sete al\n")
-		fmt.Printf("  movzx rax, al\n")
-	case "!=":
-		fmt.Printf("  cmp rax, rdi\n")
-		fmt.Printf("  setne al\n")
-		fmt.Printf("  movzx rax, al\n")
-	case "<":
-		fmt.Printf("  cmp rax, rdi\n")
-		fmt.Printf("  setl al\n")
-		fmt.Printf("  movzx rax, al\n")
-	case "<=":
-		fmt.Printf("  cmp rax, rdi\n")
-		fmt.Printf("  setle al\n")
-		fmt.Printf("  movzx rax, al\n")
-	default:
-		panic(fmt.Sprintf("unexpected node %#v", n))
+// genOpAssign pops the operands of an assignment operation on a value of
+// ty and pushes the result.
+func genOpAssign(op string, ty *Type) {
+	if ty.kind == TY_STRING {
+		genConcat()
+		return
 	}
+	fmt.Printf("  pop rdi\n")
+	fmt.Printf("  pop rax\n")
+	genBinop(op, ty)
+	truncate(ty)
 	fmt.Printf("  push rax\n")
 }
 
-func emitData(prog Program) {
-	fmt.Printf(".data\n")
+// genConcat pops two strings and pushes their concatenation, which is
+// allocated on the heap.
+func genConcat() {
+	fmt.Printf("  mov rcx, [rsp]\n")
+	fmt.Printf("  mov rdx, [rsp+8]\n")
+	fmt.Printf("  mov rsi, [rsp+16]\n")
+	fmt.Printf("  mov rdi, [rsp+24]\n")
+	fmt.Printf("  add rsp, 32\n")
+	fmt.Printf("  call .Lruntime.concat\n")
+	fmt.Printf("  push rax\n")
+	fmt.Printf("  push rdx\n")
+}
 
-	for _, g := range prog.globals {
-		fmt.Printf("%s:\n", g.name)
-		fmt.Printf("  .zero %d\n", g.ty.aryLen*g.ty.size)
+// genEqual emits `==` or `!=` of structs or arrays with the routine in the
+// type descriptor. The words of the operands on the stack are reversed in
+// place to lay out the values as in memory.
+func genEqual(n *Binary) {
+	w := wordCount(n.lhs.getType())
+	for _, off := range []int{0, 8 * w} {
+		for i := 0; i < w/2; i++ {
+			fmt.Printf("  mov rax, [rsp+%d]\n", off+8*i)
+			fmt.Printf("  mov rdi, [rsp+%d]\n", off+8*(w-1-i))
+			fmt.Printf("  mov [rsp+%d], rdi\n", off+8*i)
+			fmt.Printf("  mov [rsp+%d], rax\n", off+8*(w-1-i))
+		}
+	}
+	fmt.Printf("  lea rdi, [rsp+%d]\n", 8*w)
+	fmt.Printf("  mov rsi, rsp\n")
+	fmt.Printf("  call %s.equal\n", typeLabel(n.lhs.getType()))
+	fmt.Printf("  add rsp, %d\n", 16*w)
+	if n.op == "!=" {
+		fmt.Printf("  xor rax, 1\n")
+	}
+	fmt.Printf("  push rax\n")
+}
+
+// genRange emits a for statement with a range clause. The i-th word of
+// the state is at [rbp-it+8*i].
+func genRange(n *Range) {
+	n.seq = labelseq
+	seq := n.seq
+	labelseq++
+	ty := n.tmp.ty
+	it := n.it.offset
+	genAddr(n.tmp)
+	gen(n.x)
+	store(ty)
+	genAddr(n.it)
+	fmt.Printf("  pop rax\n")
+	zeroFill(n.it.ty.size)
+	if ty.kind == TY_MAP {
+		fmt.Printf("  mov rdi, [rbp-%d]\n", n.tmp.offset)
+		fmt.Printf("  lea rsi, [rbp-%d]\n", it)
+		fmt.Printf("  call .Lmap.iter\n")
+	}
+
+	fmt.Printf(".Lbegin%d:\n", seq)
+	switch {
+	case ty.kind == TY_MAP:
+		fmt.Printf("  mov rdi, [rbp-%d]\n", n.tmp.offset)
+		fmt.Printf("  lea rsi, [rbp-%d]\n", it)
+		fmt.Printf("  call .Lmap.next\n")
+		fmt.Printf("  cmp rax, 0\n")
+		fmt.Printf("  je .Lend%d\n", seq)
+		fmt.Printf("  mov [rbp-%d], rax\n", it-24)
+		fmt.Printf("  mov [rbp-%d], rdx\n", it-32)
+	case ty.kind == TY_STRING:
+		// The rune at the offset is decoded before the iteration.
+		fmt.Printf("  mov rsi, [rbp-%d]\n", n.tmp.offset-8)
+		fmt.Printf("  mov rax, [rbp-%d]\n", it)
+		fmt.Printf("  cmp rax, rsi\n")
+		fmt.Printf("  jge .Lend%d\n", seq)
+		fmt.Printf("  sub rsi, rax\n")
+		fmt.Printf("  mov rdi, [rbp-%d]\n", n.tmp.offset)
+		fmt.Printf("  add rdi, rax\n")
+		fmt.Printf("  call .Lruntime.decoderune\n")
+		fmt.Printf("  mov [rbp-%d], rax\n", it-8)
+		fmt.Printf("  mov [rbp-%d], rdx\n", it-16)
+	default:
+		switch ty.kind {
+		case TY_ARRAY:
+			fmt.Printf("  mov rdi, %d\n", ty.aryLen)
+		case TY_PTR:
+			fmt.Printf("  mov rdi, %d\n", ty.base.aryLen)
+		case TY_SLICE:
+			fmt.Printf("  mov rdi, [rbp-%d]\n", n.tmp.offset-8)
+		default:
+			gen(n.tmp)
+			fmt.Printf("  pop rdi\n")
+		}
+		fmt.Printf("  mov rax, [rbp-%d]\n", it)
+		fmt.Printf("  cmp rax, rdi\n")
+		if isUnsigned(ty) {
+			fmt.Printf("  jae .Lend%d\n", seq)
+		} else {
+			fmt.Printf("  jge .Lend%d\n", seq)
+		}
+	}
+	// Each iteration has new variables.
+	for _, v := range n.vars {
+		if v.ref != nil {
+			allocVar(v)
+		}
+	}
+	if n.assign != nil {
+		gen(n.assign)
+	}
+	gen(n.then)
+	fmt.Printf(".Lcontinue%d:\n", seq)
+	switch ty.kind {
+	case TY_MAP:
+		// The iterator has moved to the next slot.
+	case TY_STRING:
+		fmt.Printf("  mov rax, [rbp-%d]\n", it-16)
+		fmt.Printf("  add [rbp-%d], rax\n", it)
+	default:
+		fmt.Printf("  inc qword ptr [rbp-%d]\n", it)
+	}
+	fmt.Printf("  jmp .Lbegin%d\n", seq)
+	fmt.Printf(".Lend%d:\n", seq)
+}
+
+// genSwitch emits a switch statement. The cases are compared in order
+// unless a jump table is used, and then the bodies follow in order so
+// that fallthrough goes to the next one.
+func genSwitch(n *Switch) {
+	n.seq = labelseq
+	seq := n.seq
+	labelseq++
+	if n.init != nil {
+		gen(n.init)
+	}
+	if n.tag != nil {
+		genAddr(n.tmp)
+		gen(n.tag)
+		store(n.tmp.ty)
+	}
+	if n.guard != nil {
+		genAddr(n.tmp)
+		gen(n.guard.lhs)
+		store(n.tmp.ty)
+	}
+
+	def := fmt.Sprintf(".Lend%d", seq)
+	for i, c := range n.cases {
+		if c.vals == nil {
+			def = fmt.Sprintf(".Lcase%d.%d", seq, i)
+		}
+	}
+	if !genJumpTable(n, def) {
+		for i, c := range n.cases {
+			for _, cond := range c.conds {
+				gen(cond)
+				fmt.Printf("  pop rax\n")
+				fmt.Printf("  cmp rax, 0\n")
+				fmt.Printf("  jne .Lcase%d.%d\n", seq, i)
+			}
+			for _, ty := range c.types {
+				fmt.Printf("  mov rdi, [rbp-%d]\n", n.tmp.offset)
+				genDynamicType(ty)
+				fmt.Printf("  cmp rax, 0\n")
+				fmt.Printf("  jne .Lcase%d.%d\n", seq, i)
+			}
+		}
+		fmt.Printf("  jmp %s\n", def)
+	}
+
+	for i, c := range n.cases {
+		fmt.Printf(".Lcase%d.%d:\n", seq, i)
+		gen(c.body)
+		if !c.fall {
+			fmt.Printf("  jmp .Lend%d\n", seq)
+		}
+	}
+	fmt.Printf(".Lend%d:\n", seq)
+}
+
+// genJumpTable jumps to the case of an integer tag through a table
+// indexed by the tag if all cases are constants and at least half of the
+// table is used. It reports whether the table is emitted.
+func genJumpTable(n *Switch, def string) bool {
+	if n.tag == nil || !isInteger(n.tmp.ty) {
+		return false
+	}
+	var vals []*big.Int
+	var cases []int
+	for i, c := range n.cases {
+		for _, v := range c.vals {
+			lit, ok := v.(*IntLit)
+			if !ok {
+				return false
+			}
+			vals = append(vals, lit.val)
+			cases = append(cases, i)
+		}
+	}
+	if len(vals) < 4 {
+		return false
+	}
+	min, max := vals[0], vals[0]
+	for _, v := range vals {
+		if v.Cmp(min) < 0 {
+			min = v
+		}
+		if v.Cmp(max) > 0 {
+			max = v
+		}
+	}
+	span := new(big.Int).Sub(max, min)
+	if span.Cmp(big.NewInt(int64(2*len(vals)))) >= 0 {
+		return false
+	}
+	table := make([]string, span.Int64()+1)
+	for i := range table {
+		table[i] = def
+	}
+	// The first case wins for duplicated values.
+	for i := len(vals) - 1; i >= 0; i-- {
+		off := new(big.Int).Sub(vals[i], min).Int64()
+		table[off] = fmt.Sprintf(".Lcase%d.%d", n.seq, cases[i])
+	}
+
+	gen(n.tmp)
+	fmt.Printf("  pop rax\n")
+	if isUnsigned(n.tmp.ty) {
+		fmt.Printf("  movabs rdi, %d\n", min.Uint64())
+	} else {
+		fmt.Printf("  movabs rdi, %d\n", min.Int64())
+	}
+	fmt.Printf("  sub rax, rdi\n")
+	fmt.Printf("  cmp rax, %d\n", len(table)-1)
+	fmt.Printf("  ja %s\n", def)
+	fmt.Printf("  lea rdi, .Ltable%d[rip]\n", n.seq)
+	fmt.Printf("  jmp [rdi+rax*8]\n")
+	fmt.Printf(".section .rodata\n")
+	fmt.Printf(".Ltable%d:\n", n.seq)
+	for _, l := range table {
+		fmt.Printf("  .quad %s\n", l)
+	}
+	fmt.Printf(".text\n")
+	return true
+}
+
+// genBranch emits a jump of a break, continue or goto statement.
+func genBranch(n *Branch) {
+	if n.tok == "goto" {
+		fmt.Printf("  jmp .Llabel.%s.%s\n", funcname, n.label)
+		return
+	}
+	var seq int
+	switch t := n.target.(type) {
+	case *For:
+		seq = t.seq
+	case *Range:
+		seq = t.seq
+	case *Switch:
+		seq = t.seq
+	}
+	if n.tok == "break" {
+		fmt.Printf("  jmp .Lend%d\n", seq)
+	} else {
+		fmt.Printf("  jmp .Lcontinue%d\n", seq)
+	}
+}
+
+// genRangeNext pushes the index or the key, and the element or the value
+// if there are two iteration variables.
+func genRangeNext(n *RangeNext) {
+	r := n.r
+	ty := r.tmp.ty
+	it := r.it.offset
+	if ty.kind == TY_MAP {
+		fmt.Printf("  push [rbp-%d]\n", it-24)
+		load(ty.key)
+		if n.ty.kind == TY_TUPLE {
+			fmt.Printf("  push [rbp-%d]\n", it-32)
+			load(ty.base)
+		}
+		return
+	}
+	fmt.Printf("  push [rbp-%d]\n", it)
+	if n.ty.kind != TY_TUPLE {
+		return
+	}
+	switch ty.kind {
+	case TY_STRING:
+		fmt.Printf("  push [rbp-%d]\n", it-8)
+		return
+	case TY_ARRAY:
+		genAddr(r.tmp)
+		fmt.Printf("  pop rax\n")
+	default:
+		// The elements of a slice or a pointer to an array.
+		fmt.Printf("  mov rax, [rbp-%d]\n", r.tmp.offset)
+	}
+	elem := n.ty.elems[1]
+	fmt.Printf("  imul rdi, [rbp-%d], %d\n", it, elem.size)
+	fmt.Printf("  add rax, rdi\n")
+	fmt.Printf("  push rax\n")
+	load(elem)
+}
+
+// genBuiltin emits a call of a builtin function.
+func genBuiltin(n *BuiltinCall) {
+	switch n.name {
+	case "len", "cap":
+		ty := n.args[0].getType()
+		if ty.kind == TY_STRING {
+			gen(n.args[0])
+			// The length is the second word.
+			fmt.Printf("  pop rax\n")
+			fmt.Printf("  pop rdi\n")
+			fmt.Printf("  push rax\n")
+			return
+		}
+		if ty.kind == TY_MAP {
+			// The count is the first word of a map, and 0 for nil.
+			seq := labelseq
+			labelseq++
+			gen(n.args[0])
+			fmt.Printf("  pop rax\n")
+			fmt.Printf("  cmp rax, 0\n")
+			fmt.Printf("  je .Lend%d\n", seq)
+			fmt.Printf("  mov rax, [rax]\n")
+			fmt.Printf(".Lend%d:\n", seq)
+			fmt.Printf("  push rax\n")
+			return
+		}
+		if ty.kind == TY_SLICE {
+			gen(n.args[0])
+			fmt.Printf("  pop rcx\n")
+			fmt.Printf("  pop rax\n")
+			fmt.Printf("  pop rdi\n")
+			if n.name == "len" {
+				fmt.Printf("  push rax\n")
+			} else {
+				fmt.Printf("  push rcx\n")
+			}
+			return
+		}
+		if ty.kind == TY_PTR {
+			gen(n.args[0])
+			discard(ty)
+			ty = ty.base
+		}
+		fmt.Printf("  push %d\n", ty.aryLen)
+	case "print", "println":
+		for i, arg := range n.args {
+			if i > 0 && n.name == "println" {
+				fmt.Printf("  mov rdi, ' '\n")
+				fmt.Printf("  call .Lprint.char\n")
+			}
+			gen(arg)
+			ty := arg.getType()
+			if ty.kind == TY_STRING {
+				fmt.Printf("  pop rsi\n")
+				fmt.Printf("  pop rdi\n")
+			} else {
+				fmt.Printf("  pop rdi\n")
+			}
+			switch {
+			case ty.kind == TY_STRING:
+				fmt.Printf("  call .Lprint.string\n")
+			case ty.kind == TY_BOOL:
+				fmt.Printf("  call .Lprint.bool\n")
+			case ty.kind == TY_PTR:
+				fmt.Printf("  call .Lprint.pointer\n")
+			case isUnsigned(ty):
+				fmt.Printf("  call .Lprint.uint\n")
+			default:
+				fmt.Printf("  call .Lprint.int\n")
+			}
+		}
+		if n.name == "println" {
+			fmt.Printf("  mov rdi, '\\n'\n")
+			fmt.Printf("  call .Lprint.char\n")
+		}
+	case "make":
+		if n.ty.kind == TY_MAP {
+			// The size hint is evaluated and ignored.
+			for _, arg := range n.args {
+				gen(arg)
+				discard(arg.getType())
+			}
+			genNewMap(n.ty)
+			return
+		}
+		genMake(n)
+	case "delete":
+		gen(n.args[0])
+		kw := genMapKey(n.args[0].getType(), n.args[1])
+		callMap(".Lmap.delete", 0, kw)
+		fmt.Printf("  add rsp, %d\n", 8*(kw+1))
+	case "append":
+		genAppend(n)
+	case "copy":
+		genCopy(n)
+	default:
+		panic(fmt.Sprintf("unexpected builtin %s", n.name))
+	}
+}
+
+// genMake emits `make([]T, len, cap)`. The elements are allocated by the
+// runtime and cleared.
+func genMake(n *BuiltinCall) {
+	gen(n.args[0])
+	if len(n.args) > 1 {
+		gen(n.args[1])
+	} else {
+		fmt.Printf("  push [rsp]\n")
+	}
+	fmt.Printf("  mov rdi, [rsp]\n")
+	fmt.Printf("  cmp [rsp+8], rdi\n")
+	fmt.Printf("  ja .Lpanic.makeslice\n")
+	fmt.Printf("  test rdi, rdi\n")
+	fmt.Printf("  js .Lpanic.makeslice\n")
+	fmt.Printf("  imul rdi, %d\n", n.ty.base.size)
+	fmt.Printf("  call .Lruntime.alloc\n")
+	fmt.Printf("  pop rdi\n")
+	fmt.Printf("  pop rsi\n")
+	fmt.Printf("  push rax\n")
+	fmt.Printf("  push rsi\n")
+	fmt.Printf("  push rdi\n")
+}
+
+// genAppend emits `append(s, x, y)` and `append(s, t...)`. The runtime
+// grows the elements of s if its capacity is not enough, and then the
+// values are stored after the length.
+func genAppend(n *BuiltinCall) {
+	size := n.ty.base.size
+	gen(n.args[0])
+	if n.dots {
+		gen(n.args[1])
+		// The pointer and the length of t are its first two words.
+		w := wordCount(n.args[1].getType())
+		ptr, length := 8*(w-1), 8*(w-2)
+		sptr, slen, scap := 8*w+16, 8*w+8, 8*w
+		fmt.Printf("  mov rdi, [rsp+%d]\n", sptr)
+		fmt.Printf("  mov rsi, [rsp+%d]\n", slen)
+		fmt.Printf("  mov rdx, [rsp+%d]\n", scap)
+		fmt.Printf("  mov rcx, [rsp+%d]\n", length)
+		fmt.Printf("  mov r8, %d\n", size)
+		fmt.Printf("  call .Lruntime.grow\n")
+		fmt.Printf("  mov [rsp+%d], rax\n", sptr)
+		fmt.Printf("  mov [rsp+%d], rdx\n", scap)
+		fmt.Printf("  imul rdi, [rsp+%d], %d\n", slen, size)
+		fmt.Printf("  add rdi, [rsp+%d]\n", sptr)
+		fmt.Printf("  mov rsi, [rsp+%d]\n", ptr)
+		fmt.Printf("  imul rdx, [rsp+%d], %d\n", length, size)
+		fmt.Printf("  call .Lruntime.memmove\n")
+		fmt.Printf("  mov rax, [rsp+%d]\n", length)
+		fmt.Printf("  add [rsp+%d], rax\n", slen)
+		discard(n.args[1].getType())
+		return
+	}
+
+	vals := n.args[1:]
+	fmt.Printf("  mov rdi, [rsp+16]\n")
+	fmt.Printf("  mov rsi, [rsp+8]\n")
+	fmt.Printf("  mov rdx, [rsp]\n")
+	fmt.Printf("  mov rcx, %d\n", len(vals))
+	fmt.Printf("  mov r8, %d\n", size)
+	fmt.Printf("  call .Lruntime.grow\n")
+	fmt.Printf("  mov [rsp+16], rax\n")
+	fmt.Printf("  mov [rsp], rdx\n")
+	for i, v := range vals {
+		fmt.Printf("  mov rax, [rsp+8]\n")
+		fmt.Printf("  add rax, %d\n", i)
+		fmt.Printf("  imul rax, %d\n", size)
+		fmt.Printf("  add rax, [rsp+16]\n")
+		fmt.Printf("  push rax\n")
+		gen(v)
+		store(n.ty.base)
+	}
+	fmt.Printf("  add qword ptr [rsp+8], %d\n", len(vals))
+}
+
+// genCopy emits `copy(dst, src)`, which copies the elements as many as
+// the shorter length and pushes the number of them.
+func genCopy(n *BuiltinCall) {
+	size := n.args[0].getType().base.size
+	gen(n.args[0])
+	gen(n.args[1])
+	w := wordCount(n.args[1].getType())
+	sptr, slen := 8*(w-1), 8*(w-2)
+	dptr, dlen, dcap := 8*w+16, 8*w+8, 8*w
+	fmt.Printf("  mov rdx, [rsp+%d]\n", dlen)
+	fmt.Printf("  mov rax, [rsp+%d]\n", slen)
+	fmt.Printf("  cmp rax, rdx\n")
+	fmt.Printf("  cmovb rdx, rax\n")
+	// The capacity of dst is not used anymore. It holds the result.
+	fmt.Printf("  mov [rsp+%d], rdx\n", dcap)
+	fmt.Printf("  mov rdi, [rsp+%d]\n", dptr)
+	fmt.Printf("  mov rsi, [rsp+%d]\n", sptr)
+	fmt.Printf("  imul rdx, %d\n", size)
+	fmt.Printf("  call .Lruntime.memmove\n")
+	fmt.Printf("  mov rax, [rsp+%d]\n", dcap)
+	fmt.Printf("  add rsp, %d\n", 8*(w+3))
+	fmt.Printf("  push rax\n")
+}
+
+// genTupleAssign emits an assignment of multiple values such as
+// `a, b = b, a`. All addresses on the left and values on the right are
+// evaluated before any of them is stored.
+func genTupleAssign(n *Assign) {
+	// The number of words pushed for each destination. An entry of a map
+	// is inserted when it is stored as the table may grow, so the map and
+	// the key are pushed instead of the address.
+	dests := make([]int, len(n.lvals))
+	addrs := 0
+	for i, l := range n.lvals {
+		if _, ok := l.(*Blank); ok {
+			continue
+		}
+		if a, ok := mapIndex(l); ok {
+			gen(a.lhs)
+			dests[i] = 1 + genMapKey(a.lhs.getType(), a.rhs)
+		} else {
+			genAddr(l)
+			dests[i] = 1
+		}
+		addrs += dests[i]
+	}
+	words := 0
+	for _, r := range n.rvals {
+		gen(r)
+		words += wordCount(r.getType())
+	}
+
+	// Store values from left to right. Values are pushed above addresses.
+	addr := 8 * (words + addrs)
+	val := 8 * words
+	for i, l := range n.lvals {
+		ty := l.getType()
+		val -= 8 * wordCount(ty)
+		addr -= 8 * dests[i]
+		if dests[i] == 0 {
+			continue
+		}
+		if dests[i] > 1 {
+			callMap(".Lmap.assign", addr, dests[i]-1)
+			fmt.Printf("  mov [rsp+%d], rax\n", addr)
+		}
+		storeAt(ty, addr, val)
+	}
+	fmt.Printf("  add rsp, %d\n", 8*(words+addrs))
+}
+
+// genReturn emits a return statement. Returned values are split into
+// words. The first word is returned in RAX, the second one in RDX and the
+// others in the buffer `.Lret.buf`.
+func genReturn(n *Return) {
+	words := 0
+	for _, c := range n.children {
+		gen(c)
+		words += wordCount(c.getType())
+	}
+	if words > retWords {
+		retWords = words
+	}
+	for i := words - 1; i >= 0; i-- {
+		switch i {
+		case 0:
+			fmt.Printf("  pop rax\n")
+		case 1:
+			fmt.Printf("  pop rdx\n")
+		default:
+			fmt.Printf("  pop rdi\n")
+			fmt.Printf("  mov [.Lret.buf+%d], rdi\n", 8*(i-2))
+		}
+	}
+	fmt.Printf("  jmp .Lreturn.%s\n", funcname)
+}
+
+// genCall emits a function call. Arguments are split into words. The
+// first six words are passed in registers and the others on the stack in
+// the same way as the System V ABI.
+//
+// A method of an interface is called through the method table of the
+// receiver with the pointer to the value of the receiver.
+func genCall(n *FuncCall) {
+	// The function value is evaluated before the arguments.
+	if n.fnval != nil {
+		gen(n.fn)
+		fmt.Printf("  pop rax\n")
+		fmt.Printf("  mov [rbp-%d], rax\n", n.fnval.offset)
+	}
+	words := 0
+	for i, arg := range n.args {
+		if i == 0 && n.iface != nil {
+			words++
+			continue
+		}
+		words += wordCount(arg.getType())
+	}
+	onStack := 0
+	if words > 6 {
+		onStack = words - 6
+	}
+	total := words + onStack
+
+	// We need to align RSP to a 16 byte boundary before calling a
+	// function because it is an ABI requirement. Reserve the padding
+	// before evaluating arguments and save its size above them.
+	fmt.Printf("  mov rax, rsp\n")
+	fmt.Printf("  sub rax, %d\n", 8*(total+1))
+	fmt.Printf("  and rax, 15\n")
+	fmt.Printf("  sub rsp, rax\n")
+	fmt.Printf("  push rax\n")
+
+	for i, arg := range n.args {
+		if i == 0 && n.iface != nil {
+			genAddr(n.iface)
+			gen(arg)
+			store(arg.getType())
+			fmt.Printf("  push [rbp-%d]\n", n.iface.offset-8)
+			continue
+		}
+		gen(arg)
+	}
+	// Copy words passed on the stack in the reverse order so that the
+	// 7th word is on the top.
+	for i := 0; i < onStack; i++ {
+		fmt.Printf("  push [rsp+%d]\n", 16*i)
+	}
+	for i := 0; i < words && i < 6; i++ {
+		fmt.Printf("  mov %s, [rsp+%d]\n", argreg8[i], 8*(onStack+words-1-i))
+	}
+
+	// RAX is set to 0 for variadic function.
+	if n.fnval != nil {
+		fmt.Printf("  mov r10, [rbp-%d]\n", n.fnval.offset)
+		fmt.Printf("  cmp r10, 0\n")
+		fmt.Printf("  je .Lpanic.nil\n")
+		fmt.Printf("  mov rax, [r10]\n")
+		fmt.Printf("  call rax\n")
+	} else if n.iface != nil {
+		fmt.Printf("  mov r11, [rbp-%d]\n", n.iface.offset)
+		fmt.Printf("  cmp r11, 0\n")
+		fmt.Printf("  je .Lpanic.nil\n")
+		fmt.Printf("  mov rax, 0\n")
+		fmt.Printf("  call [r11+%d]\n", 8*(n.index+1))
+	} else {
+		fmt.Printf("  mov rax, 0\n")
+		fmt.Printf("  call %s\n", n.name)
+	}
+	fmt.Printf("  add rsp, %d\n", 8*total)
+	fmt.Printf("  pop rdi\n")
+	fmt.Printf("  add rsp, rdi\n")
+
+	for i := 0; i < wordCount(n.ty); i++ {
+		switch i {
+		case 0:
+			fmt.Printf("  push rax\n")
+		case 1:
+			fmt.Printf("  push rdx\n")
+		default:
+			fmt.Printf("  push [.Lret.buf+%d]\n", 8*(i-2))
+		}
+	}
+}
+
+// genMethodValue emits a method value, which is a closure holding the
+// address of the code calling the method and the receiver. The code finds
+// the receiver by the closure passed in R10.
+func genMethodValue(n *Selector) {
+	ty := n.lhs.getType()
+	words := wordCount(ty)
+	gen(n.lhs)
+	fmt.Printf("  mov rdi, %d\n", 8+8*words)
+	fmt.Printf("  call .Lruntime.alloc\n")
+	for i := 0; i < words; i++ {
+		fmt.Printf("  mov rdi, [rsp+%d]\n", 8*(words-1-i))
+		fmt.Printf("  mov [rax+%d], rdi\n", 8+8*i)
+	}
+	discard(ty)
+	fmt.Printf("  lea rdi, %s[rip]\n", n.bound.name)
+	fmt.Printf("  mov [rax], rdi\n")
+	fmt.Printf("  push rax\n")
+}
+
+// genToInterface emits a conversion to an interface. An interface is a
+// pair of the method table and the pointer to the value. A value other
+// than a pointer is copied to the heap. The method table of an interface
+// converted from another one is looked up by the dynamic type.
+func genToInterface(n *Conv) {
+	from := n.child.getType()
+	gen(n.child)
+	if from.kind == TY_INTERFACE {
+		if identical(underlying(from), underlying(n.ty)) {
+			return
+		}
+		fmt.Printf("  mov rdi, [rsp+8]\n")
+		fmt.Printf("  lea rsi, %s[rip]\n", itabsLabel(n.ty))
+		fmt.Printf("  call .Lruntime.convI2I\n")
+		fmt.Printf("  mov [rsp+8], rax\n")
+		return
+	}
+	if from.kind == TY_PTR {
+		fmt.Printf("  pop rax\n")
+	} else {
+		words := wordCount(from)
+		fmt.Printf("  mov rdi, %d\n", from.size)
+		fmt.Printf("  call .Lruntime.alloc\n")
+		for i := 0; i < words; i++ {
+			fmt.Printf("  mov rdi, [rsp+%d]\n", 8*(words-1-i))
+			storeBytes(regRDI, "rax", 8*i, wordSize(from, i))
+		}
+		discard(from)
+	}
+	fmt.Printf("  lea rdi, %s[rip]\n", itabLabel(n.ty, from))
+	fmt.Printf("  push rdi\n")
+	fmt.Printf("  push rax\n")
+}
+
+// genDynamicType sets RAX to non-zero if the method table RDI of an
+// interface has the dynamic type ty, or if it is 0 for a nil ty. RAX is
+// the method table for ty if ty is an interface.
+func genDynamicType(ty *Type) {
+	if ty == nil {
+		fmt.Printf("  cmp rdi, 0\n")
+		fmt.Printf("  sete al\n")
+		fmt.Printf("  movzx rax, al\n")
+		return
+	}
+	if ty.kind == TY_INTERFACE {
+		fmt.Printf("  lea rsi, %s[rip]\n", itabsLabel(ty))
+		fmt.Printf("  call .Lruntime.convI2I\n")
+		return
+	}
+	seq := labelseq
+	labelseq++
+	fmt.Printf("  mov rax, 0\n")
+	fmt.Printf("  cmp rdi, 0\n")
+	fmt.Printf("  je .Ldyntype%d\n", seq)
+	fmt.Printf("  lea rsi, %s[rip]\n", typeLabel(ty))
+	fmt.Printf("  cmp [rdi], rsi\n")
+	fmt.Printf("  sete al\n")
+	fmt.Printf(".Ldyntype%d:\n", seq)
+}
+
+// genTypeAssert emits a type assertion. It panics if the assertion does
+// not hold unless commaOk is set, in which case the zero value and false
+// are pushed instead.
+func genTypeAssert(n *TypeAssert, commaOk bool) {
+	seq := labelseq
+	labelseq++
+	gen(n.lhs)
+	fmt.Printf("  mov rdi, [rsp+8]\n")
+	genDynamicType(n.ty)
+	fmt.Printf("  cmp rax, 0\n")
+	if commaOk {
+		fmt.Printf("  je .Lzero%d\n", seq)
+	} else {
+		fmt.Printf("  jne .Lok%d\n", seq)
+		fmt.Printf("  mov rdi, [rsp+8]\n")
+		if n.ty.kind == TY_INTERFACE {
+			fmt.Printf("  lea rsi, %s.name[rip]\n", itabsLabel(n.ty))
+			fmt.Printf("  mov rcx, 1\n")
+		} else {
+			fmt.Printf("  lea rsi, %s.name[rip]\n", typeLabel(n.ty))
+			fmt.Printf("  mov rcx, 0\n")
+		}
+		fmt.Printf("  mov rdx, %d\n", len(n.ty.String()))
+		fmt.Printf("  jmp .Lpanic.assert\n")
+		fmt.Printf(".Lok%d:\n", seq)
+	}
+
+	if n.ty.kind == TY_INTERFACE {
+		fmt.Printf("  mov [rsp+8], rax\n")
+	} else {
+		fmt.Printf("  pop rax\n")
+		fmt.Printf("  add rsp, 8\n")
+		fmt.Printf("  push rax\n")
+		if n.ty.kind != TY_PTR {
+			load(n.ty)
+		}
+	}
+	if !commaOk {
+		return
+	}
+	fmt.Printf("  push 1\n")
+	fmt.Printf("  jmp .Lend%d\n", seq)
+	fmt.Printf(".Lzero%d:\n", seq)
+	fmt.Printf("  add rsp, 16\n")
+	for i := 0; i < wordCount(n.ty); i++ {
+		fmt.Printf("  push 0\n")
+	}
+	fmt.Printf("  push 0\n")
+	fmt.Printf(".Lend%d:\n", seq)
+}
+
+// genParams copies parameters passed by genCall to their stack slots.
+func genParams(params []*Var) {
+	word := 0
+	for _, p := range params {
+		for i := 0; i < wordCount(p.ty); i++ {
+			reg := regR10
+			if word < 6 {
+				reg = argRegister(word)
+			} else {
+				fmt.Printf("  mov r10, [rbp+%d]\n", 16+8*(word-6))
+			}
+			storeBytes(reg, "rbp", -p.offset+8*i, wordSize(p.ty, i))
+			word++
+		}
+	}
+}
+
+// genCopyBytes copies the bytes of the pointer and the length on the stack
+// to the heap, and replaces the pointer with the copy.
+func genCopyBytes() {
+	fmt.Printf("  mov rdi, [rsp]\n")
+	fmt.Printf("  call .Lruntime.alloc\n")
+	fmt.Printf("  mov rdi, rax\n")
+	fmt.Printf("  mov rsi, [rsp+8]\n")
+	fmt.Printf("  mov rdx, [rsp]\n")
+	fmt.Printf("  mov [rsp+8], rax\n")
+	fmt.Printf("  call .Lruntime.memmove\n")
+}
+
+// allocVar allocates a zeroed variable on the heap and stores the pointer
+// to it in the slot of v.ref.
+func allocVar(v *Var) {
+	fmt.Printf("  mov rdi, %d\n", v.ty.size)
+	fmt.Printf("  call .Lruntime.alloc\n")
+	fmt.Printf("  mov [rbp-%d], rax\n", v.ref.offset)
+}
+
+// genLogical emits `&&` and `||`. The right operand is evaluated only if
+// the left one does not determine the result.
+func genLogical(n *Binary) {
+	seq := labelseq
+	labelseq++
+	// The result when the left operand is short-circuited.
+	short := 0
+	jump := "je"
+	if n.op == "||" {
+		short = 1
+		jump = "jne"
+	}
+
+	gen(n.lhs)
+	fmt.Printf("  pop rax\n")
+	fmt.Printf("  cmp rax, 0\n")
+	fmt.Printf("  %s .Lshort%d\n", jump, seq)
+	gen(n.rhs)
+	fmt.Printf("  pop rax\n")
+	fmt.Printf("  cmp rax, 0\n")
+	fmt.Printf("  setne al\n")
+	fmt.Printf("  movzx rax, al\n")
+	fmt.Printf("  push rax\n")
+	fmt.Printf("  jmp .Lend%d\n", seq)
+	fmt.Printf(".Lshort%d:\n", seq)
+	fmt.Printf("  push %d\n", short)
+	fmt.Printf(".Lend%d:\n", seq)
+}
+
+// genBinop emits `rax = rax op rdi`. ty is the type of the left operand,
+// which decides whether the operation is signed.
+func genBinop(op string, ty *Type) {
+	if isUnsigned(ty) {
+		switch op {
+		case "/", "%", ">>", "<", "<=", ">", ">=":
+			genUnsignedBinop(op)
+			return
+		}
+	}
+	switch op {
+	case "+":
+		fmt.Printf("  add rax, rdi\n")
+	case "-":
+		fmt.Printf("  sub rax, rdi\n")
+	case "*":
+		fmt.Printf("  imul rax, rdi\n")
+	case "/", "%":
+		// idiv traps on the overflow of the most negative integer divided
+		// by -1, whose quotient is the dividend negated with wraparound
+		// and whose remainder is 0.
+		seq := labelseq
+		labelseq++
+		fmt.Printf("  cmp rdi, -1\n")
+		fmt.Printf("  jne .Ldiv%d\n", seq)
+		if op == "/" {
+			fmt.Printf("  neg rax\n")
+		} else {
+			fmt.Printf("  mov rax, 0\n")
+		}
+		fmt.Printf("  jmp .Ldivend%d\n", seq)
+		fmt.Printf(".Ldiv%d:\n", seq)
+		fmt.Printf("  cqo\n")
+		fmt.Printf("  idiv rdi\n")
+		if op == "%" {
+			fmt.Printf("  mov rax, rdx\n")
+		}
+		fmt.Printf(".Ldivend%d:\n", seq)
+	case "&":
+		fmt.Printf("  and rax, rdi\n")
+	case "|":
+		fmt.Printf("  or rax, rdi\n")
+	case "^":
+		fmt.Printf("  xor rax, rdi\n")
+	case "&^":
+		fmt.Printf("  not rdi\n")
+		fmt.Printf("  and rax, rdi\n")
+	case "<<":
+		// Unlike x86, shifting by 64 or more bits results in 0.
+		fmt.Printf("  mov rcx, rdi\n")
+		fmt.Printf("  shl rax, cl\n")
+		fmt.Printf("  cmp rdi, 64\n")
+		fmt.Printf("  mov rdi, 0\n")
+		fmt.Printf("  cmovae rax, rdi\n")
+	case ">>":
+		// Shifting by 64 or more bits fills all bits with the sign.
+		fmt.Printf("  mov rcx, 63\n")
+		fmt.Printf("  cmp rdi, 63\n")
+		fmt.Printf("  cmovb rcx, rdi\n")
+		fmt.Printf("  sar rax, cl\n")
+	case "==":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  sete al\n")
+		fmt.Printf("  movzx rax, al\n")
+	case "!=":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  setne al\n")
+		fmt.Printf("  movzx rax, al\n")
+	case "<":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  setl al\n")
+		fmt.Printf("  movzx rax, al\n")
+	case "<=":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  setle al\n")
+		fmt.Printf("  movzx rax, al\n")
+	case ">":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  setg al\n")
+		fmt.Printf("  movzx rax, al\n")
+	case ">=":
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  setge al\n")
+		fmt.Printf("  movzx rax, al\n")
+	default:
+		panic(fmt.Sprintf("unexpected operator %s", op))
+	}
+}
+
+// genUnsignedBinop emits the operations that differ for unsigned
+// integers.
+func genUnsignedBinop(op string) {
+	switch op {
+	case "/":
+		fmt.Printf("  mov rdx, 0\n")
+		fmt.Printf("  div rdi\n")
+	case "%":
+		fmt.Printf("  mov rdx, 0\n")
+		fmt.Printf("  div rdi\n")
+		fmt.Printf("  mov rax, rdx\n")
+	case ">>":
+		// Shifting by 64 or more bits results in 0.
+		fmt.Printf("  mov rcx, rdi\n")
+		fmt.Printf("  shr rax, cl\n")
+		fmt.Printf("  cmp rdi, 64\n")
+		fmt.Printf("  mov rdi, 0\n")
+		fmt.Printf("  cmovae rax, rdi\n")
+	case "<", "<=", ">", ">=":
+		set := map[string]string{"<": "setb", "<=": "setbe", ">": "seta", ">=": "setae"}[op]
+		fmt.Printf("  cmp rax, rdi\n")
+		fmt.Printf("  %s al\n", set)
+		fmt.Printf("  movzx rax, al\n")
+	}
+}
+
+func escape(s string) string {
+	str := ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' || c == '"' {
+			str += "\\" + s[i:i+1]
+		} else if 0x20 <= c && c < 0x7f {
+			str += s[i : i+1]
+		} else {
+			str += fmt.Sprintf("\\%03o", c)
+		}
+	}
+	return str
+}
+
+func emitData(prog Program) {
+	fmt.Printf(".data\n")
+
+	for _, g := range prog.globals {
+		fmt.Printf("%s:\n", g.name)
+		fmt.Printf("  .zero %d\n", g.ty.aryLen*g.ty.size)
 	}
 
 	for _, c := range prog.contents {
 		fmt.Printf("%s:\n", c.label)
-		fmt.Printf("  .string \"%s\"\n", c.val)
+		fmt.Printf("  .string \"%s\"\n", escape(c.val))
 		fmt.Printf("%s.obj:\n", c.label)
 		fmt.Printf("  .quad %s\n", c.label)
 		fmt.Printf("  .quad %d\n", len(c.val))
 	}
+
+	emitTypes()
+
+	// A declared function used as a value is a closure of its address.
+	for _, f := range funcValues {
+		fmt.Printf(".Lfunc.%s:\n", f.name)
+		fmt.Printf("  .quad %s\n", f.name)
+	}
+
+	if retWords > 2 {
+		fmt.Printf(".Lret.buf:\n")
+		fmt.Printf("  .zero %d\n", 8*(retWords-2))
+	}
+}
+
+// Functions used as values.
+var funcValues []*Function
+
+func funcLabel(fn *Function) string {
+	for _, f := range funcValues {
+		if f == fn {
+			return ".Lfunc." + fn.name
+		}
+	}
+	funcValues = append(funcValues, fn)
+	return ".Lfunc." + fn.name
+}
+
+// Types of values held in interfaces. The type descriptor of the i-th
+// type is `.Ltype.i`. Identical types share a descriptor.
+var dynTypes []*Type
+
+// itab is the method table of a type converted to an interface.
+type itab struct {
+	iface *Type
+	ty    *Type
+}
+
+// Method tables referred to by the code. The i-th one is `.Litab.i`.
+var itabs []itab
+
+// Interfaces converted from other interfaces. The i-th one has the table
+// `.Litabs.i` to look up method tables by dynamic types.
+var convIfaces []*Type
+
+func typeLabel(ty *Type) string {
+	for i, t := range dynTypes {
+		if identical(t, ty) {
+			return fmt.Sprintf(".Ltype.%d", i)
+		}
+	}
+	dynTypes = append(dynTypes, ty)
+	return fmt.Sprintf(".Ltype.%d", len(dynTypes)-1)
+}
+
+func itabLabel(iface *Type, ty *Type) string {
+	typeLabel(ty)
+	for i, t := range itabs {
+		if identical(t.iface, iface) && identical(t.ty, ty) {
+			return fmt.Sprintf(".Litab.%d", i)
+		}
+	}
+	itabs = append(itabs, itab{iface, ty})
+	return fmt.Sprintf(".Litab.%d", len(itabs)-1)
+}
+
+func itabsLabel(iface *Type) string {
+	for i, t := range convIfaces {
+		if identical(t, iface) {
+			return fmt.Sprintf(".Litabs.%d", i)
+		}
+	}
+	convIfaces = append(convIfaces, iface)
+	return fmt.Sprintf(".Litabs.%d", len(convIfaces)-1)
+}
+
+// emitTypes emits the type descriptors and the method tables for
+// interfaces to the data section.
+//
+// A type descriptor has the size of the type, the routine to compare two
+// values at RDI and RSI, the name and whether an interface holds a value
+// itself rather than a pointer to it. The routine is 0 if the values are
+// not comparable. A method table has the type descriptor and the methods
+// in the order of the interface. A method takes the pointer to a value,
+// so a method with a value receiver is called through its wrapper.
+func emitTypes() {
+	// Dynamic types are all known as converting interfaces does not add
+	// them.
+	n := len(dynTypes)
+	for i, iface := range convIfaces {
+		fmt.Printf(".Litabs.%d:\n", i)
+		for j, ty := range dynTypes[:n] {
+			if missingMethod(ty, iface) == "" {
+				fmt.Printf("  .quad .Ltype.%d, %s\n", j, itabLabel(iface, ty))
+			}
+		}
+		fmt.Printf("  .quad 0\n")
+		fmt.Printf(".Litabs.%d.name:\n", i)
+		fmt.Printf("  .string \"%s\"\n", escape(iface.String()))
+	}
+
+	for i, t := range itabs {
+		fmt.Printf(".Litab.%d:\n", i)
+		fmt.Printf("  .quad %s\n", typeLabel(t.ty))
+		for _, m := range t.iface.methods {
+			f := methodOf(t.ty, m.name)
+			if f.recv.ty.kind == TY_PTR {
+				fmt.Printf("  .quad %s\n", f.name)
+			} else {
+				fmt.Printf("  .quad %s.ptr\n", f.name)
+			}
+		}
+	}
+
+	for i, ty := range dynTypes {
+		parts, ok := equalParts(ty, 0, nil)
+		fmt.Printf(".Ltype.%d:\n", i)
+		fmt.Printf("  .quad %d\n", ty.size)
+		if ok {
+			fmt.Printf("  .quad .Ltype.%d.equal\n", i)
+		} else {
+			fmt.Printf("  .quad 0\n")
+		}
+		name := ty.String()
+		fmt.Printf("  .quad .Ltype.%d.name\n", i)
+		fmt.Printf("  .quad %d\n", len(name))
+		if ty.kind == TY_PTR {
+			fmt.Printf("  .quad 1\n")
+		} else {
+			fmt.Printf("  .quad 0\n")
+		}
+		fmt.Printf(".Ltype.%d.name:\n", i)
+		fmt.Printf("  .string \"%s\"\n", escape(name))
+		if ok {
+			fmt.Printf(".text\n")
+			emitEqual(fmt.Sprintf(".Ltype.%d.equal", i), parts)
+			fmt.Printf(".data\n")
+		}
+	}
+}
+
+// equalPart is a part of a value compared at once. kind is "bytes",
+// "string" or "interface".
+type equalPart struct {
+	kind   string
+	offset int
+	size   int
+}
+
+// equalParts appends the parts of a value of ty at offset to parts. The
+// padding between fields is not compared. It reports false if the values
+// are not comparable.
+func equalParts(ty *Type, offset int, parts []equalPart) ([]equalPart, bool) {
+	switch ty.kind {
+	case TY_SLICE, TY_MAP, TY_FUNC:
+		return parts, false
+	case TY_STRING:
+		return append(parts, equalPart{"string", offset, 16}), true
+	case TY_INTERFACE:
+		return append(parts, equalPart{"interface", offset, 16}), true
+	case TY_ARRAY:
+		ok := true
+		for i := 0; i < ty.aryLen && ok; i++ {
+			parts, ok = equalParts(ty.base, offset+i*ty.base.size, parts)
+		}
+		return parts, ok
+	case TY_STRUCT:
+		ok := true
+		for _, f := range ty.fields {
+			if parts, ok = equalParts(f.ty, offset+f.offset, parts); !ok {
+				break
+			}
+		}
+		return parts, ok
+	}
+	// Adjacent bytes are compared together.
+	if l := len(parts) - 1; l >= 0 && parts[l].kind == "bytes" && parts[l].offset+parts[l].size == offset {
+		parts[l].size += ty.size
+		return parts, true
+	}
+	return append(parts, equalPart{"bytes", offset, ty.size}), true
+}
+
+// emitEqual emits a routine comparing two values at RDI and RSI part by
+// part. It returns 1 in RAX if they are equal.
+func emitEqual(label string, parts []equalPart) {
+	body := "  push r12\n  push r13\n  mov r12, rdi\n  mov r13, rsi\n"
+	for _, p := range parts {
+		switch p.kind {
+		case "bytes":
+			body += fmt.Sprintf("  lea rdi, [r12+%d]\n  lea rsi, [r13+%d]\n  mov rdx, %d\n", p.offset, p.offset, p.size)
+			body += fmt.Sprintf("  call memcmp\n  cmp eax, 0\n  jne %s.ne\n", label)
+		case "string":
+			body += fmt.Sprintf("  mov rdi, [r12+%d]\n  mov rsi, [r12+%d]\n  mov rdx, [r13+%d]\n  mov rcx, [r13+%d]\n", p.offset, p.offset+8, p.offset, p.offset+8)
+			body += fmt.Sprintf("  cmp rsi, rcx\n  jne %s.ne\n  call .Lruntime.strcmp\n  cmp rax, 0\n  jne %s.ne\n", label, label)
+		case "interface":
+			body += fmt.Sprintf("  mov rdi, [r12+%d]\n  mov rsi, [r12+%d]\n  mov rdx, [r13+%d]\n  mov rcx, [r13+%d]\n", p.offset, p.offset+8, p.offset, p.offset+8)
+			body += fmt.Sprintf("  call .Lruntime.ifaceeq\n  cmp rax, 0\n  je %s.ne\n", label)
+		}
+	}
+	body += fmt.Sprintf("  mov rax, 1\n  jmp %s.end\n%s.ne:\n  mov rax, 0\n%s.end:\n  pop r13\n  pop r12\n", label, label, label)
+	emitRoutine(label, body)
 }
 
+// emitStdlibs emits the runtime routines for the builtin functions. The
+// routines take arguments in the same registers as C functions. They align
+// RSP by themselves as they are called without the alignment of genCall.
 func emitStdlibs() {
-	// ssize_t write(int fd, const void *buf, size_t count);
-	fmt.Printf("println:\n")
+	fmt.Printf(".section .rodata\n")
+	fmt.Printf(".Lfmt.string:\n")
+	fmt.Printf("  .string \"%%.*s\"\n")
+	fmt.Printf(".Lfmt.int:\n")
+	fmt.Printf("  .string \"%%ld\"\n")
+	fmt.Printf(".Lfmt.uint:\n")
+	fmt.Printf("  .string \"%%lu\"\n")
+	fmt.Printf(".Lfmt.pointer:\n")
+	fmt.Printf("  .string \"0x%%lx\"\n")
+	fmt.Printf(".Lfmt.true:\n")
+	fmt.Printf("  .string \"true\"\n")
+	fmt.Printf(".Lfmt.false:\n")
+	fmt.Printf("  .string \"false\"\n")
+	fmt.Printf(".Lfmt.index:\n")
+	fmt.Printf("  .string \"panic: runtime error: index out of range [%%ld] with length %%ld\\n\"\n")
+	fmt.Printf(".Lfmt.slice:\n")
+	fmt.Printf("  .string \"panic: runtime error: slice bounds out of range\\n\"\n")
+	fmt.Printf(".Lfmt.makeslice:\n")
+	fmt.Printf("  .string \"panic: runtime error: makeslice: len out of range\\n\"\n")
+	fmt.Printf(".Lfmt.nilmap:\n")
+	fmt.Printf("  .string \"panic: assignment to entry in nil map\\n\"\n")
+	fmt.Printf(".Lfmt.nil:\n")
+	fmt.Printf("  .string \"panic: runtime error: invalid memory address or nil pointer dereference\\n\"\n")
+	fmt.Printf(".Lfmt.uncomparable:\n")
+	fmt.Printf("  .string \"panic: runtime error: comparing uncomparable type %%.*s\\n\"\n")
+	fmt.Printf(".Lfmt.assert:\n")
+	fmt.Printf("  .string \"panic: interface conversion: interface is %%.*s, not %%.*s\\n\"\n")
+	fmt.Printf(".Lfmt.assertI:\n")
+	fmt.Printf("  .string \"panic: interface conversion: %%.*s is not %%.*s\\n\"\n")
+	fmt.Printf(".Lfmt.niltype:\n")
+	fmt.Printf("  .string \"nil\"\n")
+	fmt.Printf(".text\n")
+
+	// The print routines take a value in RDI, or a string in RDI and RSI.
+	// int printf(const char *format, ...);
+	emitRoutine(".Lprint.string", "  mov rdx, rdi\n  lea rdi, .Lfmt.string[rip]\n  call printf\n")
+	emitRoutine(".Lprint.int", "  mov rsi, rdi\n  lea rdi, .Lfmt.int[rip]\n  call printf\n")
+	emitRoutine(".Lprint.uint", "  mov rsi, rdi\n  lea rdi, .Lfmt.uint[rip]\n  call printf\n")
+	emitRoutine(".Lprint.pointer", "  mov rsi, rdi\n  lea rdi, .Lfmt.pointer[rip]\n  call printf\n")
+	emitRoutine(".Lprint.bool", "  cmp rdi, 0\n  lea rdi, .Lfmt.false[rip]\n  lea rsi, .Lfmt.true[rip]\n  cmovne rdi, rsi\n  call printf\n")
+	// int putchar(int c);
+	emitRoutine(".Lprint.char", "  call putchar\n")
+
+	// The heap allocator returns RDI bytes of zeros in RAX.
+	emitRoutine(".Lruntime.alloc", "  mov rsi, rdi\n  mov rdi, 1\n  call calloc\n")
+	emitRoutine(".Lruntime.memmove", "  call memmove\n")
+
+	// The strcmp routine compares the string of the pointer RDI and the
+	// length RSI with the one of RDX and RCX. The result is negative, 0
+	// or positive as the first string is less than, equal to or greater
+	// than the second one.
+	emitRoutine(".Lruntime.strcmp", `  sub rsp, 16
+  mov [rsp], rsi
+  mov [rsp+8], rcx
+  cmp rcx, rsi
+  cmovb rsi, rcx
+  xchg rsi, rdx
+  call memcmp
+  movsxd rax, eax
+  cmp rax, 0
+  jne .Lstrcmp.end
+  mov rax, [rsp]
+  sub rax, [rsp+8]
+.Lstrcmp.end:
+`)
+
+	// The ifaceeq routine compares the interface of the method table RDI
+	// and the value RSI with the one of RDX and RCX. They are equal if
+	// both are nil, or if they have the same dynamic type and equal
+	// values. It panics if the values are not comparable.
+	emitRoutine(".Lruntime.ifaceeq", `  cmp rdi, 0
+  je .Lifaceeq.nil
+  cmp rdx, 0
+  je .Lifaceeq.nil
+  mov rdi, [rdi]
+  cmp rdi, [rdx]
+  jne .Lifaceeq.end
+  mov r11, [rdi+8]
+  cmp r11, 0
+  je .Lifaceeq.panic
+  cmp qword ptr [rdi+32], 0
+  jne .Lifaceeq.direct
+  mov rdi, rsi
+  mov rsi, rcx
+  call r11
+  jmp .Lifaceeq.end
+.Lifaceeq.direct:
+  cmp rsi, rcx
+  sete al
+  jmp .Lifaceeq.end
+.Lifaceeq.nil:
+  cmp rdi, rdx
+  sete al
+  jmp .Lifaceeq.end
+.Lifaceeq.panic:
+  mov rdx, [rdi+24]
+  mov rcx, [rdi+16]
+  jmp .Lpanic.uncomparable
+.Lifaceeq.end:
+`)
+
+	// The convI2I routine returns the method table for the dynamic type of
+	// the method table RDI in the table RSI of type descriptors and method
+	// tables. It returns 0 if RDI is 0 or the type is not in the table.
+	emitRoutine(".Lruntime.convI2I", `  cmp rdi, 0
+  je .LconvI2I.end
+  mov rdi, [rdi]
+.LconvI2I.loop:
+  mov rax, [rsi]
+  cmp rax, 0
+  je .LconvI2I.end
+  add rsi, 16
+  cmp rax, rdi
+  jne .LconvI2I.loop
+  mov rax, [rsi-8]
+.LconvI2I.end:
+`)
+
+	// The grow routine makes room for RCX more elements of R8 bytes in a
+	// slice of the pointer RDI, the length RSI and the capacity RDX. It
+	// returns the new pointer in RAX and the new capacity in RDX. The
+	// capacity is at least doubled to append elements in amortized
+	// constant time.
+	emitRoutine(".Lruntime.grow", `  sub rsp, 32
+  lea rax, [rsi+rcx]
+  cmp rax, rdx
+  ja .Lgrow.alloc
+  mov rax, rdi
+  jmp .Lgrow.end
+.Lgrow.alloc:
+  lea r9, [rdx+rdx]
+  cmp r9, rax
+  cmovb r9, rax
+  mov [rsp], rdi
+  mov [rsp+8], rsi
+  mov [rsp+16], r8
+  mov [rsp+24], r9
+  mov rdi, 1
+  mov rsi, r9
+  imul rsi, r8
+  call calloc
+  mov rdi, rax
+  mov rsi, [rsp]
+  mov rdx, [rsp+8]
+  imul rdx, [rsp+16]
+  call memcpy
+  mov rdx, [rsp+24]
+.Lgrow.end:
+`)
+
+	// A map is a pointer to a header of 64 bytes, which holds the number
+	// of entries, the number of slots, the slots, the key size, the value
+	// size, whether the key is a string, the slot size and the number of
+	// used slots including deleted ones. A slot is a flag word (0 for
+	// empty, 1 for used and 2 for deleted), the key and the value. Keys
+	// are found by open addressing with linear probing.
+	emitRoutine(".Lmap.new", `  sub rsp, 32
+  mov [rsp], rdi
+  mov [rsp+8], rsi
+  mov [rsp+16], rdx
+  mov rdi, 1
+  mov rsi, 64
+  call calloc
+  mov [rsp+24], rax
+  mov rdi, [rsp]
+  mov [rax+24], rdi
+  mov rsi, [rsp+8]
+  mov [rax+32], rsi
+  mov rdx, [rsp+16]
+  mov [rax+40], rdx
+  lea rsi, [rdi+rsi+8]
+  mov [rax+48], rsi
+  mov qword ptr [rax+8], 8
+  mov rdi, 8
+  call calloc
+  mov rdi, [rsp+24]
+  mov [rdi+16], rax
+  mov rax, rdi
+`)
+
+	// The hash routine returns the FNV-1a hash of the key at RSI in the
+	// map RDI. A string key is hashed by its contents.
+	emitRoutine(".Lmap.hash", `  mov rcx, [rdi+24]
+  cmp qword ptr [rdi+40], 0
+  je .Lhash.begin
+  mov rcx, [rsi+8]
+  mov rsi, [rsi]
+.Lhash.begin:
+  movabs rax, 0xcbf29ce484222325
+  movabs rdx, 0x100000001b3
+.Lhash.loop:
+  cmp rcx, 0
+  je .Lhash.end
+  movzx r8d, byte ptr [rsi]
+  xor rax, r8
+  imul rax, rdx
+  inc rsi
+  dec rcx
+  jmp .Lhash.loop
+.Lhash.end:
+`)
+
+	// The equal routine returns 1 if the keys at RSI and RDX in the map
+	// RDI are equal. Otherwise it returns 0.
+	// int memcmp(const void *s1, const void *s2, size_t n);
+	emitRoutine(".Lmap.equal", `  mov rcx, [rdi+24]
+  cmp qword ptr [rdi+40], 0
+  je .Lequal.cmp
+  mov rcx, [rsi+8]
+  cmp rcx, [rdx+8]
+  jne .Lequal.end
+  mov rsi, [rsi]
+  mov rdx, [rdx]
+.Lequal.cmp:
+  mov rdi, rsi
+  mov rsi, rdx
+  mov rdx, rcx
+  call memcmp
+  cmp eax, 0
+  sete al
+  movzx eax, al
+.Lequal.end:
+`)
+
+	// The find routine returns the slot of the key at RSI in the map RDI,
+	// or 0 if it is not found. A nil map has no keys.
+	emitRoutine(".Lmap.find", `  push rbx
+  push r12
+  push r13
+  push r14
+  mov rbx, rdi
+  mov r12, rsi
+  cmp rbx, 0
+  je .Lfind.none
+  call .Lmap.hash
+  mov r13, [rbx+8]
+  dec r13
+  and r13, rax
+.Lfind.loop:
+  mov r14, r13
+  imul r14, [rbx+48]
+  add r14, [rbx+16]
+  cmp qword ptr [r14], 0
+  je .Lfind.none
+  cmp qword ptr [r14], 1
+  jne .Lfind.next
+  mov rdi, rbx
+  lea rsi, [r14+8]
+  mov rdx, r12
+  call .Lmap.equal
+  cmp rax, 0
+  jne .Lfind.found
+.Lfind.next:
+  inc r13
+  mov rax, [rbx+8]
+  dec rax
+  and r13, rax
+  jmp .Lfind.loop
+.Lfind.found:
+  mov rax, r14
+  jmp .Lfind.end
+.Lfind.none:
+  mov rax, 0
+.Lfind.end:
+  pop r14
+  pop r13
+  pop r12
+  pop rbx
+`)
+
+	// The access routine returns the address of the value of the key at
+	// RSI in the map RDI, or 0 if it is not found.
+	emitRoutine(".Lmap.access", `  push rbx
+  push r12
+  mov rbx, rdi
+  call .Lmap.find
+  cmp rax, 0
+  je .Laccess.end
+  add rax, 8
+  add rax, [rbx+24]
+.Laccess.end:
+  pop r12
+  pop rbx
+`)
+
+	// The assign routine returns the address of the value of the key at
+	// RSI in the map RDI. A missing key is inserted with the zero value.
+	// The slots are doubled when three quarters of them are used.
+	// void *memset(void *s, int c, size_t n);
+	emitRoutine(".Lmap.assign", `  push rbx
+  push r12
+  push r13
+  push r14
+  mov rbx, rdi
+  mov r12, rsi
+  cmp rbx, 0
+  je .Lpanic.nilmap
+  call .Lmap.find
+  cmp rax, 0
+  jne .Lassign.found
+  mov rax, [rbx+56]
+  inc rax
+  shl rax, 2
+  mov rcx, [rbx+8]
+  lea rcx, [rcx+rcx*2]
+  cmp rax, rcx
+  jbe .Lassign.insert
+  mov rdi, rbx
+  call .Lmap.grow
+.Lassign.insert:
+  mov rdi, rbx
+  mov rsi, r12
+  call .Lmap.hash
+  mov r13, [rbx+8]
+  dec r13
+  and r13, rax
+.Lassign.loop:
+  mov r14, r13
+  imul r14, [rbx+48]
+  add r14, [rbx+16]
+  cmp qword ptr [r14], 1
+  jne .Lassign.new
+  inc r13
+  mov rax, [rbx+8]
+  dec rax
+  and r13, rax
+  jmp .Lassign.loop
+.Lassign.new:
+  cmp qword ptr [r14], 0
+  jne .Lassign.reuse
+  inc qword ptr [rbx+56]
+.Lassign.reuse:
+  mov qword ptr [r14], 1
+  inc qword ptr [rbx]
+  lea rdi, [r14+8]
+  mov rsi, r12
+  mov rdx, [rbx+24]
+  call memcpy
+  mov rdi, r14
+  add rdi, 8
+  add rdi, [rbx+24]
+  mov rsi, 0
+  mov rdx, [rbx+32]
+  call memset
+  mov rax, r14
+.Lassign.found:
+  add rax, 8
+  add rax, [rbx+24]
+  pop r14
+  pop r13
+  pop r12
+  pop rbx
+`)
+
+	// The delete routine marks the slot of the key at RSI in the map RDI
+	// as deleted if it is found.
+	emitRoutine(".Lmap.delete", `  push rbx
+  push r12
+  mov rbx, rdi
+  call .Lmap.find
+  cmp rax, 0
+  je .Ldelete.end
+  mov qword ptr [rax], 2
+  dec qword ptr [rbx]
+.Ldelete.end:
+  pop r12
+  pop rbx
+`)
+
+	// The grow routine doubles the slots of the map RDI and inserts the
+	// used slots again. Deleted slots are dropped. The old slots are not
+	// freed as iterators may refer to them.
+	emitRoutine(".Lmap.grow", `  push rbx
+  push r12
+  push r13
+  push r14
+  mov rbx, rdi
+  mov r12, [rbx+16]
+  mov r13, [rbx+8]
+  shl qword ptr [rbx+8], 1
+  mov rdi, [rbx+8]
+  mov rsi, [rbx+48]
+  call calloc
+  mov [rbx+16], rax
+  mov qword ptr [rbx], 0
+  mov qword ptr [rbx+56], 0
+  mov r14, 0
+.Lrehash.loop:
+  cmp r14, r13
+  jae .Lrehash.end
+  mov rsi, r14
+  imul rsi, [rbx+48]
+  add rsi, r12
+  cmp qword ptr [rsi], 1
+  jne .Lrehash.next
+  add rsi, 8
+  sub rsp, 16
+  mov [rsp], rsi
+  mov rdi, rbx
+  call .Lmap.assign
+  mov rsi, [rsp]
+  add rsp, 16
+  mov rdi, rax
+  add rsi, [rbx+24]
+  mov rdx, [rbx+32]
+  call memcpy
+.Lrehash.next:
+  inc r14
+  jmp .Lrehash.loop
+.Lrehash.end:
+  pop r14
+  pop r13
+  pop r12
+  pop rbx
+`)
+
+	// The iterator of a map is the slots and the number of them when the
+	// iteration starts, the index of the next slot, and the key and the
+	// value returned by the next routine. The iter routine sets the
+	// cleared iterator RSI up for the map RDI.
+	emitRoutine(".Lmap.iter", `  cmp rdi, 0
+  je .Liter.end
+  mov rax, [rdi+16]
+  mov [rsi], rax
+  mov rax, [rdi+8]
+  mov [rsi+8], rax
+.Liter.end:
+`)
+
+	// The next routine returns the addresses of the next key in RAX and
+	// its value in RDX for the iterator RSI of the map RDI. RAX is 0 at
+	// the end. If the map has grown, the key is looked up again as it
+	// may have been deleted after growing.
+	emitRoutine(".Lmap.next", `  push rbx
+  push r12
+  push r13
+  push r14
+  mov rbx, rdi
+  mov r12, rsi
+.Lnext.loop:
+  mov rax, [r12+16]
+  cmp rax, [r12+8]
+  jae .Lnext.done
+  inc qword ptr [r12+16]
+  imul rax, [rbx+48]
+  add rax, [r12]
+  cmp qword ptr [rax], 1
+  jne .Lnext.loop
+  lea r13, [rax+8]
+  mov rdx, r13
+  add rdx, [rbx+24]
+  mov r14, [r12]
+  cmp r14, [rbx+16]
+  je .Lnext.found
+  mov rdi, rbx
+  mov rsi, r13
+  call .Lmap.access
+  cmp rax, 0
+  je .Lnext.loop
+  mov rdx, rax
+.Lnext.found:
+  mov rax, r13
+  jmp .Lnext.end
+.Lnext.done:
+  mov rax, 0
+.Lnext.end:
+  pop r14
+  pop r13
+  pop r12
+  pop rbx
+`)
+
+	// The decoderune routine decodes the UTF-8 rune at RDI of RSI bytes,
+	// and returns the rune in RAX and its width in RDX. An invalid
+	// encoding is U+FFFD of 1 byte.
+	emitRoutine(".Lruntime.decoderune", `  movzx eax, byte ptr [rdi]
+  mov edx, 1
+  cmp eax, 0x80
+  jb .Ldecode.end
+  cmp eax, 0xC0
+  jb .Ldecode.bad
+  cmp eax, 0xE0
+  jb .Ldecode.two
+  cmp eax, 0xF0
+  jb .Ldecode.three
+  cmp eax, 0xF8
+  jae .Ldecode.bad
+  and eax, 0x07
+  mov ecx, 4
+  mov r8d, 0x10000
+  jmp .Ldecode.cont
+.Ldecode.three:
+  and eax, 0x0F
+  mov ecx, 3
+  mov r8d, 0x800
+  jmp .Ldecode.cont
+.Ldecode.two:
+  and eax, 0x1F
+  mov ecx, 2
+  mov r8d, 0x80
+.Ldecode.cont:
+  cmp rsi, rcx
+  jb .Ldecode.bad
+.Ldecode.loop:
+  cmp edx, ecx
+  jae .Ldecode.check
+  movzx r9d, byte ptr [rdi+rdx]
+  mov r10d, r9d
+  and r10d, 0xC0
+  cmp r10d, 0x80
+  jne .Ldecode.bad
+  shl eax, 6
+  and r9d, 0x3F
+  or eax, r9d
+  inc edx
+  jmp .Ldecode.loop
+.Ldecode.check:
+  cmp eax, r8d
+  jb .Ldecode.bad
+  cmp eax, 0x10FFFF
+  ja .Ldecode.bad
+  mov r9d, eax
+  and r9d, 0xFFFFF800
+  cmp r9d, 0xD800
+  je .Ldecode.bad
+  jmp .Ldecode.end
+.Ldecode.bad:
+  mov eax, 0xFFFD
+  mov edx, 1
+.Ldecode.end:
+`)
+
+	// The concat routine returns the concatenation of the string of the
+	// pointer RDI and the length RSI and the one of RDX and RCX in RAX and
+	// RDX.
+	emitRoutine(".Lruntime.concat", `  push r12
+  push r13
+  push r14
+  push r15
+  mov r12, rdi
+  mov r13, rsi
+  mov r14, rdx
+  mov r15, rcx
+  mov rdi, 1
+  lea rsi, [r13+r15]
+  call calloc
+  mov rdi, rax
+  mov rsi, r12
+  mov rdx, r13
+  call memcpy
+  mov r12, rax
+  lea rdi, [rax+r13]
+  mov rsi, r14
+  mov rdx, r15
+  call memcpy
+  mov rax, r12
+  lea rdx, [r13+r15]
+  pop r15
+  pop r14
+  pop r13
+  pop r12
+`)
+
+	// The encoderune routine returns the string of the UTF-8 of the rune
+	// RDI in RAX and its length in RDX.
+	emitRoutine(".Lruntime.encoderune", `  push rdi
+  push rdi
+  mov rdi, 4
+  call .Lruntime.alloc
+  pop rdi
+  pop rdi
+  mov rsi, rax
+  call .Lruntime.putrune
+`)
+
+	// The putrune routine writes the UTF-8 of the rune RDI to RSI, and
+	// returns RSI in RAX and the length in RDX. An invalid rune is U+FFFD.
+	emitRoutine(".Lruntime.putrune", `  mov rax, rsi
+  cmp rdi, 0x80
+  jb .Lencode.one
+  cmp rdi, 0x800
+  jb .Lencode.two
+  cmp rdi, 0xD800
+  jb .Lencode.three
+  cmp rdi, 0xE000
+  jb .Lencode.bad
+  cmp rdi, 0x10000
+  jb .Lencode.three
+  cmp rdi, 0x10FFFF
+  jbe .Lencode.four
+.Lencode.bad:
+  mov edi, 0xFFFD
+  jmp .Lencode.three
+.Lencode.one:
+  mov [rax], dil
+  mov edx, 1
+  jmp .Lencode.end
+.Lencode.two:
+  mov ecx, edi
+  shr ecx, 6
+  or ecx, 0xC0
+  mov [rax], cl
+  mov edx, 2
+  jmp .Lencode.last
+.Lencode.three:
+  mov ecx, edi
+  shr ecx, 12
+  or ecx, 0xE0
+  mov [rax], cl
+  mov edx, 3
+  jmp .Lencode.middle
+.Lencode.four:
+  mov ecx, edi
+  shr ecx, 18
+  or ecx, 0xF0
+  mov [rax], cl
+  mov ecx, edi
+  shr ecx, 12
+  and ecx, 0x3F
+  or ecx, 0x80
+  mov [rax+1], cl
+  mov edx, 4
+.Lencode.middle:
+  mov ecx, edi
+  shr ecx, 6
+  and ecx, 0x3F
+  or ecx, 0x80
+  mov [rax+rdx-2], cl
+.Lencode.last:
+  mov ecx, edi
+  and ecx, 0x3F
+  or ecx, 0x80
+  mov [rax+rdx-1], cl
+.Lencode.end:
+`)
+
+	// The runes routine decodes the string of the pointer RDI and the
+	// length RSI to runes of 8 bytes, and returns the pointer to them in
+	// RAX and the number of them in RDX.
+	emitRoutine(".Lruntime.runes", `  push r12
+  push r13
+  push r14
+  push r15
+  mov r12, rdi
+  mov r13, rsi
+  lea rdi, [rsi*8]
+  call .Lruntime.alloc
+  mov r14, rax
+  mov r15, 0
+.Lrunes.loop:
+  cmp r13, 0
+  jle .Lrunes.end
+  mov rdi, r12
+  mov rsi, r13
+  call .Lruntime.decoderune
+  mov [r14+r15*8], rax
+  inc r15
+  add r12, rdx
+  sub r13, rdx
+  jmp .Lrunes.loop
+.Lrunes.end:
+  mov rax, r14
+  mov rdx, r15
+  pop r15
+  pop r14
+  pop r13
+  pop r12
+`)
+
+	// The runestring routine encodes RSI runes of 8 bytes at RDI to UTF-8,
+	// and returns the string in RAX and RDX.
+	emitRoutine(".Lruntime.runestring", `  push r12
+  push r13
+  push r14
+  push r15
+  mov r12, rdi
+  mov r13, rsi
+  lea rdi, [rsi*4]
+  call .Lruntime.alloc
+  mov r14, rax
+  mov r15, 0
+.Lrunestring.loop:
+  cmp r13, 0
+  je .Lrunestring.end
+  movsxd rdi, dword ptr [r12]
+  lea rsi, [r14+r15]
+  call .Lruntime.putrune
+  add r15, rdx
+  add r12, 8
+  dec r13
+  jmp .Lrunestring.loop
+.Lrunestring.end:
+  mov rax, r14
+  mov rdx, r15
+  pop r15
+  pop r14
+  pop r13
+  pop r12
+`)
+
+	// Panics print a message to stderr and exit with 2 like Go.
+	// int dprintf(int fd, const char *format, ...);
+	emitRoutine(".Lpanic.index", "  mov rcx, rsi\n  mov rdx, rdi\n  lea rsi, .Lfmt.index[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+	emitRoutine(".Lpanic.slice", "  lea rsi, .Lfmt.slice[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+	emitRoutine(".Lpanic.makeslice", "  lea rsi, .Lfmt.makeslice[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+	emitRoutine(".Lpanic.nilmap", "  lea rsi, .Lfmt.nilmap[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+	emitRoutine(".Lpanic.nil", "  lea rsi, .Lfmt.nil[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+	// The assert routine takes the method table RDI of an interface, the
+	// name of the asserted type in RSI and RDX, and whether it is an
+	// interface in RCX.
+	emitRoutine(".Lpanic.assert", `  mov r9, rsi
+  mov r8, rdx
+  lea rsi, .Lfmt.assert[rip]
+  cmp rdi, 0
+  je .Lassert.nil
+  cmp rcx, 0
+  je .Lassert.type
+  lea rsi, .Lfmt.assertI[rip]
+.Lassert.type:
+  mov rdi, [rdi]
+  mov rdx, [rdi+24]
+  mov rcx, [rdi+16]
+  jmp .Lassert.print
+.Lassert.nil:
+  mov rdx, 3
+  lea rcx, .Lfmt.niltype[rip]
+.Lassert.print:
+  mov rdi, 2
+  call dprintf
+  mov rdi, 2
+  call exit
+`)
+	emitRoutine(".Lpanic.uncomparable", "  lea rsi, .Lfmt.uncomparable[rip]\n  mov rdi, 2\n  call dprintf\n  mov rdi, 2\n  call exit\n")
+}
+
+// emitRoutine emits a runtime routine with body.
+func emitRoutine(label string, body string) {
+	fmt.Printf("%s:\n", label)
 	// Prologue.
 	fmt.Printf("  push rbp\n")
 	fmt.Printf("  mov rbp, rsp\n")
+	fmt.Printf("  and rsp, -16\n")
 
-	//fmt.Printf("  mov rsi, [rbp+16]\n")
-	fmt.Printf("  mov rdx, [rbp+16]\n") // third arg: size_t count
-	fmt.Printf("  mov rsi, [rbp+24]\n") // second arg: const void *buf
-	fmt.Printf("  mov rdi, 1\n")        // first arg: int fd
-
-	fmt.Printf("  call write\n")
-
-	// Newline.
-	fmt.Printf("  mov rdi, '\\n'\n")
-	fmt.Printf("  call putchar\n")
+	// RAX is set to 0 for variadic function.
+	fmt.Printf("  mov rax, 0\n")
+	fmt.Printf("%s", body)
 
 	// Epilogue.
 	fmt.Printf("  mov rsp, rbp\n")
@@ -309,16 +2787,28 @@ func emitStdlibs() {
 	fmt.Printf("  ret\n")
 }
 
+// skipFunc reports whether no code is emitted for f. A function declared
+// without a body is implemented outside Go, and a function or a method
+// named `_` cannot be called.
+func skipFunc(f *Function) bool {
+	return f.isExternal || f.name == "_" || strings.HasSuffix(f.name, "._")
+}
+
 func emitText(prog Program) {
 	fmt.Printf(".text\n")
 
 	for _, f := range prog.funcs {
-		fmt.Printf(".global %s\n", f.name)
+		if !skipFunc(f) {
+			fmt.Printf(".global %s\n", f.name)
+		}
 	}
 
 	emitStdlibs()
 
 	for _, f := range prog.funcs {
+		if skipFunc(f) {
+			continue
+		}
 		funcname = f.name
 		fmt.Printf("%s:\n", funcname)
 
@@ -331,9 +2821,41 @@ func emitText(prog Program) {
 		fmt.Printf("  mov rbp, rsp\n")
 		fmt.Printf("  sub rsp, %d\n", f.stackSize)
 
+		// The receiver of a method value follows the code address in the
+		// closure.
+		if f.ctx != nil {
+			fmt.Printf("  lea rax, [r10+8]\n")
+			fmt.Printf("  mov [rbp-%d], rax\n", f.ctx.offset)
+		}
+
 		// Push parameters to the stack.
-		for i, p := range f.params {
-			fmt.Printf("  mov [rbp-%d], %s\n", p.offset, argreg8[i])
+		genParams(f.params)
+
+		// Parameters on the heap are copied from their slots.
+		for _, p := range f.params {
+			if p.ref == nil {
+				continue
+			}
+			allocVar(p)
+			for i := 0; i < wordCount(p.ty); i++ {
+				loadBytes(regRDI, "rbp", -p.offset+8*i, wordSize(p.ty, i))
+				storeBytes(regRDI, "rax", 8*i, wordSize(p.ty, i))
+			}
+		}
+
+		// Named results are initialized with zero values.
+		for _, r := range f.results {
+			if r.name == "" {
+				continue
+			}
+			if r.ref != nil {
+				allocVar(r)
+				continue
+			}
+			fmt.Printf("  mov r10, 0\n")
+			for i := 0; i < wordCount(r.ty); i++ {
+				storeBytes(regR10, "rbp", -r.offset+8*i, wordSize(r.ty, i))
+			}
 		}
 
 		// Emit code.
@@ -351,6 +2873,8 @@ func emitText(prog Program) {
 
 func codegen(prog Program) {
 	fmt.Printf(".intel_syntax noprefix\n")
-	emitData(prog)
+	// The text is emitted first to know the size of the return buffer and
+	// the types held in interfaces.
 	emitText(prog)
+	emitData(prog)
 }
@@ -35,22 +35,73 @@ func printNode(node interface{}, dep int) {
 	case *Deref:
 		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 		printNode(n.child, dep+1)
+	case *Not:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.child, dep+1)
+	case *Conv:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.child, dep+1)
+	case *BitNot:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.child, dep+1)
+	case *Nil:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 	case *Binary:
 		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 		printNode(n.lhs, dep+1)
 		printNode(n.rhs, dep+1)
 	case *Var:
 		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+	case *Blank:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 	case *ArrayRef:
 		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 		printNode(n.lhs, dep+1)
 		printNode(n.rhs, dep+1)
 	case *FuncCall:
 		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		if n.fn != nil {
+			printNode(n.fn, dep+1)
+		}
 		for _, arg := range n.args {
 			printNode(arg, dep+1)
 		}
+	case *MethodExpr:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+	case *FuncName:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+	case *BuiltinCall:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		for _, arg := range n.args {
+			printNode(arg, dep+1)
+		}
+	case *Selector:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.lhs, dep+1)
+	case *TypeAssert:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.lhs, dep+1)
+	case *CompositeLit:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		for _, v := range n.vals {
+			printNode(v, dep+1)
+		}
 	// Statements.
+	case *SliceExpr:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.lhs, dep+1)
+	case *MapLit:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		for i, k := range n.keys {
+			printNode(k, dep+1)
+			printNode(n.vals[i], dep+1)
+		}
+	case *CommaOk:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
+		printNode(n.child, dep+1)
+	case *VarDecl:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+		printNode(n.v, dep+1)
 	case *Empty:
 		fmt.Printf("dep: %d, node: %#v\n", dep, n)
 	case *ExprStmt:
@@ -58,17 +109,26 @@ func printNode(node interface{}, dep int) {
 		printNode(n.child, dep+1)
 	case *Return:
 		fmt.Printf("dep: %d, node: %#v\n", dep, n)
-		printNode(n.child, dep+1)
+		for _, c := range n.children {
+			printNode(c, dep+1)
+		}
 	case *Block:
 		fmt.Printf("dep: %d, node: %#v\n", dep, n)
 		for _, c := range n.children {
 			printNode(c, dep+1)
 		}
+	case *OpAssign:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+		printNode(n.lhs, dep+1)
+		printNode(n.rhs, dep+1)
 	case *Assign:
 		fmt.Printf("dep: %d, node: %#v\n", dep, n)
-		for i := range n.lvals {
-			printNode(n.lvals[i], dep+1)
-			printNode(n.rvals[i], dep+1)
+		// `a, b := f()` has fewer values on the right.
+		for _, l := range n.lvals {
+			printNode(l, dep+1)
+		}
+		for _, r := range n.rvals {
+			printNode(r, dep+1)
 		}
 	case *If:
 		fmt.Printf("dep: %d, node: %#v\n", dep, n)
@@ -82,5 +142,32 @@ func printNode(node interface{}, dep int) {
 		printNode(n.cond, dep+1)
 		printNode(n.post, dep+1)
 		printNode(n.then, dep+1)
+	case *Range:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+		for _, l := range n.lvals {
+			printNode(l, dep+1)
+		}
+		printNode(n.x, dep+1)
+		printNode(n.then, dep+1)
+	case *Switch:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+		printNode(n.init, dep+1)
+		printNode(n.tag, dep+1)
+		if n.guard != nil {
+			printNode(n.guard, dep+1)
+		}
+		for _, c := range n.cases {
+			for _, v := range c.vals {
+				printNode(v, dep+1)
+			}
+			printNode(c.body, dep+1)
+		}
+	case *Labeled:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+		printNode(n.stmt, dep+1)
+	case *Branch:
+		fmt.Printf("dep: %d, node: %#v\n", dep, n)
+	case *RangeNext:
+		fmt.Printf("dep: %d, node: %#v, \n        type: %#v \n", dep, n, n.ty)
 	}
 }
@@ -10,6 +10,9 @@ import (
 var in string
 var userIn string
 
+// filename is used in error messages.
+var filename string
+
 var isDev bool
 
 func parseArgs() {
@@ -33,9 +36,11 @@ func parseArgs() {
 
 		in = string(b)
 		userIn = string(b)
+		filename = *buildPtr
 	} else {
 		in = *inPtr
 		userIn = *inPtr
+		filename = "<input>"
 	}
 }
 
@@ -56,11 +61,11 @@ func main() {
 		addType(gv)
 	}
 	for _, fn := range prog.funcs {
-		resetOffset()
-		for _, s := range fn.stmts {
-			addType(s)
-		}
-		fn.stackSize = stackSize(fn.locals)
+		addFuncType(fn)
+	}
+	for _, w := range wrappers {
+		addFuncType(w.fn)
+		prog.funcs = append(prog.funcs, w.fn)
 	}
 
 	// debug
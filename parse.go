@@ -2,10 +2,32 @@ package main
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
 )
 
 var globals []*Var
 var tmpLocals []*Var
+var funcs []*Function
+
+// The value of iota in the constant declaration being parsed, or -1.
+var iotaVal = -1
+
+// Results of the function being parsed.
+var tmpResults []*Var
+
+// Composite literals are not allowed in the headers of if and for
+// statements unless they are in parentheses, as `{` starts the block.
+var noLit bool
+
+// The guard `x.(type)` is allowed only in the header of a type switch.
+var guardOk bool
+
+// Package-level variables and functions referred to by the declaration
+// being parsed. They decide the order to initialize package-level
+// variables.
+var tmpRefs []interface{}
 
 var contents []*StringLit
 var contentCnt = 0
@@ -26,6 +48,7 @@ type Expr interface {
 	isExpr()
 	getType() *Type
 	setType(ty *Type)
+	getPos() Pos
 }
 
 // -------------------- Top level program --------------------
@@ -37,27 +60,58 @@ type Program struct {
 
 // -------------------- Declarations --------------------
 type Function struct {
-	name      string
-	params    []*Var
-	locals    []*Var
-	stmts     []Stmt
-	stackSize int
+	name       string // A method is named `T.M` after its receiver base type T.
+	recv       *Var   // The receiver of a method, which is also the first parameter.
+	params     []*Var
+	results    []*Var // Unnamed results have an empty name.
+	locals     []*Var
+	stmts      []Stmt
+	stackSize  int
+	isExternal bool // Declared without a body and implemented outside Go.
+	pos        Pos
+	ctx        *Var // Points to the receiver bound to a method value.
+}
+
+// Constant is a named constant declared by `const`. It is replaced with
+// its value wherever it is used.
+type Constant struct {
+	name string
+	val  Expr // *IntLit or *StringLit.
+	pos  Pos
+}
+
+// TypeName is a type declared by `type`.
+type TypeName struct {
+	name string
+	ty   *Type
+	pos  Pos
+}
+
+// Builtin is a predeclared function such as `len`. It is called with
+// arguments that ordinary functions cannot take, such as types.
+type Builtin struct {
+	name string
 }
 
 func (*Function) isDecl() {}
+func (*Constant) isDecl() {}
+func (*TypeName) isDecl() {}
+func (*Builtin) isDecl()  {}
 
 // -------------------- Statements --------------------
 type ExprStmt struct {
 	child Expr
+	pos   Pos
 }
 
 type Return struct {
-	//children []Expr
-	child Expr
+	children []Expr
+	pos      Pos
 }
 
 type Block struct {
 	children []Stmt
+	pos      Pos
 }
 
 type If struct {
@@ -65,6 +119,7 @@ type If struct {
 	cond Expr
 	then Stmt
 	els  Stmt
+	pos  Pos
 }
 
 type For struct {
@@ -72,38 +127,139 @@ type For struct {
 	cond Expr
 	post Stmt
 	then Stmt
+	vars []*Var // The variables declared by init.
+	brk  bool   // A break statement refers to it.
+	seq  int    // The number of the labels assigned by codegen.
+	pos  Pos
+}
+
+// Range is a for statement with a range clause. The range expression is
+// evaluated once, and the iteration variables are assigned from the hidden
+// state of the iteration, so changing them does not affect the iteration.
+type Range struct {
+	lvals  []Expr // The iteration variables. It may be empty.
+	vars   []*Var // The variables declared by the clause.
+	x      Expr
+	then   Stmt
+	assign *Assign // Assigns the values of an iteration to lvals.
+	tmp    *Var    // Holds the value of x.
+	it     *Var    // The state of the iteration.
+	seq    int     // The number of the labels assigned by codegen.
+	pos    Pos
+}
+
+// Switch is an expression switch statement or a type switch. The tag, or
+// the interface of the guard of a type switch, is evaluated once into tmp.
+// A switch without a tag runs the first case that is true.
+type Switch struct {
+	init  Stmt
+	tag   Expr        // The tag or nil.
+	guard *TypeAssert // The guard `x.(type)` of a type switch or nil.
+	bind  string      // The variable declared by the guard or "".
+	cases []*Case
+	tmp   *Var
+	brk   bool // A break statement refers to it.
+	seq   int  // The number of the labels assigned by codegen.
+	pos   Pos
+}
+
+// Case is a case clause of a switch. vals is nil for default. conds are
+// the conditions of vals added by the type checker. A case of a type
+// switch has types instead of vals, where nil stands for `case nil`, and
+// v is the variable declared by the guard in the clause.
+type Case struct {
+	vals  []Expr
+	conds []Expr
+	types []*Type
+	v     *Var
+	body  *Block
+	fall  bool // It ends with a fallthrough statement.
+	pos   Pos
+}
+
+// Branch is a break, continue or goto statement. target is the loop
+// that break and continue refer to.
+type Branch struct {
+	tok    string
+	label  string // The label or "".
+	target Stmt
+	pos    Pos
+}
+
+// Labeled is a labeled statement. Labels are declared in the function
+// body rather than in a block.
+type Labeled struct {
+	name string
+	stmt Stmt
+	pos  Pos
 }
 
 type Assign struct {
 	lvals []Expr
 	rvals []Expr
+	pos   Pos
+}
+
+// It's also an expression.
+// OpAssign is an assignment operation such as `x += y`, `x++` and `x--`.
+// The address of lhs is evaluated only once.
+type OpAssign struct {
+	op  string // Binary operator.
+	lhs Expr
+	rhs Expr
+	pos Pos
+}
+
+// VarDecl declares a local variable. The variable is set to the zero
+// value of its type unless the next statement assigns it. A variable on
+// the heap is allocated every time it is declared.
+type VarDecl struct {
+	v        *Var
+	assigned bool
+	pos      Pos
 }
 
-type Empty struct{} // It's also an expression
+type Empty struct {
+	pos Pos
+}
 
 func (*Assign) isStmt()   {}
+func (*OpAssign) isStmt() {}
 func (*Return) isStmt()   {}
 func (*ExprStmt) isStmt() {}
 func (*Block) isStmt()    {}
 func (*If) isStmt()       {}
 func (*For) isStmt()      {}
+func (*Range) isStmt()    {}
+func (*Branch) isStmt()   {}
+func (*Switch) isStmt()   {}
+func (*Labeled) isStmt()  {}
+func (*VarDecl) isStmt()  {}
 func (*Empty) isStmt()    {}
 
 // -------------------- Expressions --------------------
+// IntLit is an integer, rune or boolean constant. A boolean is 1 if it
+// is true. The value is arbitrary precision until it takes a type.
 type IntLit struct {
-	val int
+	val *big.Int
 	ty  *Type
+	pos Pos
 }
 
+// StringLit is a string constant. It is untyped unless it is a typed
+// constant, and an untyped one takes a string type from the context.
 type StringLit struct {
 	val   string
 	label string
 	ty    *Type
+	typed bool
+	pos   Pos
 }
 
 type Unary struct {
 	child Expr
 	ty    *Type
+	pos   Pos
 }
 
 type Binary struct {
@@ -111,6 +267,7 @@ type Binary struct {
 	lhs Expr
 	rhs Expr
 	ty  *Type
+	pos Pos
 }
 
 type Var struct {
@@ -118,443 +275,2533 @@ type Var struct {
 	offset  int
 	isLocal bool
 	ty      *Type
+	pos     Pos  // Where the variable is declared.
+	ref     *Var // Holds the pointer to the variable if it is on the heap.
 }
 
 type ArrayRef struct {
 	lhs Expr
 	rhs Expr
 	ty  *Type
+	pos Pos
 }
 
-type FuncCall struct {
-	name string
-	args []Expr
-	ty   *Type // TODO: support function type.
+// Blank is the blank identifier `_`. It can only be assigned to.
+type Blank struct {
+	ty  *Type
+	pos Pos
 }
 
-type Addr Unary
-type Deref Unary
+// Nil is the predeclared `nil`. It takes the type of the pointer it is
+// assigned or compared to.
+type Nil struct {
+	ty  *Type
+	pos Pos
+}
 
-func (*Binary) isExpr()    {}
-func (*FuncCall) isExpr()  {}
-func (*Var) isExpr()       {}
-func (*Addr) isExpr()      {}
-func (*Deref) isExpr()     {}
-func (*ArrayRef) isExpr()  {}
-func (*IntLit) isExpr()    {}
-func (*StringLit) isExpr() {}
-func (*Empty) isExpr()     {}
-
-func (b *Binary) getType() *Type    { return b.ty }
-func (f *FuncCall) getType() *Type  { return f.ty }
-func (v *Var) getType() *Type       { return v.ty }
-func (a *Addr) getType() *Type      { return a.ty }
-func (d *Deref) getType() *Type     { return d.ty }
-func (a *ArrayRef) getType() *Type  { return a.ty }
-func (i *IntLit) getType() *Type    { return i.ty }
-func (s *StringLit) getType() *Type { return s.ty }
-func (e *Empty) getType() *Type     { return nil }
-
-func (b *Binary) setType(ty *Type)    { b.ty = ty }
-func (f *FuncCall) setType(ty *Type)  { f.ty = ty }
-func (v *Var) setType(ty *Type)       { v.ty = ty }
-func (a *Addr) setType(ty *Type)      { a.ty = ty }
-func (d *Deref) setType(ty *Type)     { d.ty = ty }
-func (a *ArrayRef) setType(ty *Type)  { a.ty = ty }
-func (i *IntLit) setType(ty *Type)    { i.ty = ty }
-func (s *StringLit) setType(ty *Type) { s.ty = ty }
-func (e *Empty) setType(ty *Type)     {}
-
-// -------------------- Stdlibs --------------------
-type Stdlib struct {
+// BuiltinCall is a call of a builtin function such as `len(x)`. The type
+// of `make(T, n)` is T.
+type BuiltinCall struct {
 	name string
 	args []Expr
+	dots bool // The last argument is followed by `...` as `append(s, t...)`.
+	ty   *Type
+	pos  Pos
 }
 
-func (*Stdlib) isStmt()          {}
-func (*Stdlib) isExpr()          {}
-func (*Stdlib) getType() *Type   { return nil }
-func (*Stdlib) setType(ty *Type) {}
+// MapLit is a map literal such as `map[string]int{"a": 1}`.
+type MapLit struct {
+	keys []Expr
+	vals []Expr
+	ty   *Type
+	pos  Pos
+}
 
-func findVar(name string) *Var {
-	for _, v := range globals {
-		if v.name == name {
-			return v
-		}
-	}
-	for _, v := range tmpLocals {
-		if v.name == name {
-			return v
-		}
-	}
-	return nil
+// CommaOk is a map index or a type assertion assigned to two values such
+// as `v, ok := m[k]`. The second value reports whether the key is in the
+// map or the assertion holds.
+type CommaOk struct {
+	child Expr
+	ty    *Type // A tuple of the value and bool.
+	pos   Pos
 }
 
-func newLabel() string {
-	l := fmt.Sprintf(".L.data.%d", contentCnt)
-	contentCnt++
-	return l
+// RangeNext is the values of the current iteration of a range clause. It
+// is a tuple if there are two iteration variables.
+type RangeNext struct {
+	r   *Range
+	ty  *Type
+	pos Pos
 }
 
-func arrayLength() int {
-	idx := -1
-	// Array.
-	if consume("[") {
-		// only supports a fixed array.
-		idx = tokens[0].val
-		tokens = tokens[1:]
-		assert("]")
-	}
-	return idx
+// SliceExpr is a slice expression such as `a[low:high:max]`. Omitted
+// indices are nil.
+type SliceExpr struct {
+	lhs  Expr
+	low  Expr
+	high Expr
+	max  Expr
+	ty   *Type
+	pos  Pos
 }
 
-func readTypePrefix(parent *Type) *Type {
-	if !consume("[") {
-		tok := consumeToken(TK_TYPE)
-		if tok == nil {
-			ty := newNoneType()
-			parent.base = &ty
-			return parent
-		}
+// FuncCall is a call of a function. A call of a method such as `x.M()`
+// or `T.M(x)` has fn, and it is changed to a call of the method named
+// name with the receiver as the first argument when it is typed. A method
+// of an interface is called through the method table of the receiver,
+// which is held in iface. Any other fn is a function value called
+// indirectly.
+type FuncCall struct {
+	name  string
+	args  []Expr
+	fn    Expr // The callee if it is not a function name.
+	iface *Var // Holds the receiver of a dynamic call.
+	index int  // The index of the method called dynamically.
+	fnval *Var // Holds the function value called indirectly.
+	ty    *Type
+	pos   Pos
+}
 
-		if !supportType(tok.str) {
-			panic(fmt.Sprintf("unsupported type %s\n", tok.str))
-		}
+// MethodExpr is a method expression such as `T.M` or `(*T).M`. It is the
+// method taking the receiver of recv as the first argument.
+type MethodExpr struct {
+	recv   *Type
+	method *Function
+	fn     *Function // The function of its value, which may be a wrapper.
+	ty     *Type
+	pos    Pos
+}
 
-		ty := newLiteralType(tok.str)
-		parent.base = &ty
-		return parent
-	}
+// FuncName is a declared function used as a value.
+type FuncName struct {
+	fn  *Function
+	ty  *Type
+	pos Pos
+}
 
-	ty := newLiteralType("array")
-	// only supports a fixed array.
-	ty.aryLen = tokens[0].val
-	tokens = tokens[1:]
-	assert("]")
+// TypeAssert is a type assertion such as `x.(T)`, which panics if the
+// dynamic type of the interface x is not T. ty is nil for the guard
+// `x.(type)` of a type switch.
+type TypeAssert struct {
+	lhs Expr
+	ty  *Type
+	pos Pos
+}
 
-	if parent != nil {
-		parent.base = &ty
-	}
+// Selector selects a field of a struct such as `x.f`. A pointer to a
+// struct is dereferenced automatically. A method value such as `x.M`
+// binds lhs to bound, which calls the method with it.
+type Selector struct {
+	lhs   Expr
+	name  string
+	field *Field
+	tmp   *Var      // Holds the value of lhs if it is not addressable.
+	bound *Function // The function of a method value.
+	ty    *Type
+	pos   Pos
+}
 
-	return readTypePrefix(&ty)
+// CompositeLit is a struct literal such as `T{a: 1, b: 2}`. Fields
+// without values are zero.
+type CompositeLit struct {
+	fields []*Field
+	vals   []Expr
+	tmp    *Var // Holds the value unless it is allocated on the heap.
+	heap   bool // Allocated on the heap by `&T{...}`.
+	ty     *Type
+	pos    Pos
 }
 
-// VarSpec = Identifier ( Type [ "=" Expression ] )
-func varSpec() *Var {
-	tokId := consumeToken(TK_IDENT)
-	if tokId == nil {
-		panic(fmt.Sprintf("expected an identifier but got %#v\n", tokId))
-	}
+type Addr Unary
+type Deref Unary
+type Conv Unary   // Conversion such as `int8(x)`.
+type Not Unary    // Logical negation `!`.
+type BitNot Unary // Bitwise complement `^x`.
+
+func (*Binary) isExpr()       {}
+func (*FuncCall) isExpr()     {}
+func (*MethodExpr) isExpr()   {}
+func (*FuncName) isExpr()     {}
+func (*Var) isExpr()          {}
+func (*Addr) isExpr()         {}
+func (*Deref) isExpr()        {}
+func (*Not) isExpr()          {}
+func (*BitNot) isExpr()       {}
+func (*ArrayRef) isExpr()     {}
+func (*Selector) isExpr()     {}
+func (*TypeAssert) isExpr()   {}
+func (*CompositeLit) isExpr() {}
+func (*Conv) isExpr()         {}
+func (*IntLit) isExpr()       {}
+func (*Nil) isExpr()          {}
+func (*BuiltinCall) isExpr()  {}
+func (*SliceExpr) isExpr()    {}
+func (*MapLit) isExpr()       {}
+func (*CommaOk) isExpr()      {}
+func (*RangeNext) isExpr()    {}
+func (*StringLit) isExpr()    {}
+func (*Blank) isExpr()        {}
+func (*Empty) isExpr()        {}
+
+func (b *Binary) getType() *Type       { return b.ty }
+func (f *FuncCall) getType() *Type     { return f.ty }
+func (m *MethodExpr) getType() *Type   { return m.ty }
+func (f *FuncName) getType() *Type     { return f.ty }
+func (v *Var) getType() *Type          { return v.ty }
+func (a *Addr) getType() *Type         { return a.ty }
+func (d *Deref) getType() *Type        { return d.ty }
+func (n *Not) getType() *Type          { return n.ty }
+func (b *BitNot) getType() *Type       { return b.ty }
+func (a *ArrayRef) getType() *Type     { return a.ty }
+func (s *Selector) getType() *Type     { return s.ty }
+func (t *TypeAssert) getType() *Type   { return t.ty }
+func (c *CompositeLit) getType() *Type { return c.ty }
+func (c *Conv) getType() *Type         { return c.ty }
+func (i *IntLit) getType() *Type       { return i.ty }
+func (n *Nil) getType() *Type          { return n.ty }
+func (b *BuiltinCall) getType() *Type  { return b.ty }
+func (s *SliceExpr) getType() *Type    { return s.ty }
+func (m *MapLit) getType() *Type       { return m.ty }
+func (c *CommaOk) getType() *Type      { return c.ty }
+func (r *RangeNext) getType() *Type    { return r.ty }
+func (s *StringLit) getType() *Type    { return s.ty }
+func (b *Blank) getType() *Type        { return b.ty }
+func (e *Empty) getType() *Type        { return nil }
+
+func (b *Binary) setType(ty *Type)       { b.ty = ty }
+func (f *FuncCall) setType(ty *Type)     { f.ty = ty }
+func (m *MethodExpr) setType(ty *Type)   { m.ty = ty }
+func (f *FuncName) setType(ty *Type)     { f.ty = ty }
+func (v *Var) setType(ty *Type)          { v.ty = ty }
+func (a *Addr) setType(ty *Type)         { a.ty = ty }
+func (d *Deref) setType(ty *Type)        { d.ty = ty }
+func (n *Not) setType(ty *Type)          { n.ty = ty }
+func (b *BitNot) setType(ty *Type)       { b.ty = ty }
+func (a *ArrayRef) setType(ty *Type)     { a.ty = ty }
+func (s *Selector) setType(ty *Type)     { s.ty = ty }
+func (t *TypeAssert) setType(ty *Type)   { t.ty = ty }
+func (c *CompositeLit) setType(ty *Type) { c.ty = ty }
+func (c *Conv) setType(ty *Type)         { c.ty = ty }
+func (i *IntLit) setType(ty *Type)       { i.ty = ty }
+func (n *Nil) setType(ty *Type)          { n.ty = ty }
+func (b *BuiltinCall) setType(ty *Type)  { b.ty = ty }
+func (s *SliceExpr) setType(ty *Type)    { s.ty = ty }
+func (m *MapLit) setType(ty *Type)       { m.ty = ty }
+func (c *CommaOk) setType(ty *Type)      { c.ty = ty }
+func (r *RangeNext) setType(ty *Type)    { r.ty = ty }
+func (s *StringLit) setType(ty *Type)    { s.ty = ty }
+func (b *Blank) setType(ty *Type)        { b.ty = ty }
+func (e *Empty) setType(ty *Type)        {}
+
+func (b *Binary) getPos() Pos       { return b.pos }
+func (f *FuncCall) getPos() Pos     { return f.pos }
+func (m *MethodExpr) getPos() Pos   { return m.pos }
+func (f *FuncName) getPos() Pos     { return f.pos }
+func (v *Var) getPos() Pos          { return v.pos }
+func (a *Addr) getPos() Pos         { return a.pos }
+func (d *Deref) getPos() Pos        { return d.pos }
+func (n *Not) getPos() Pos          { return n.pos }
+func (b *BitNot) getPos() Pos       { return b.pos }
+func (a *ArrayRef) getPos() Pos     { return a.pos }
+func (s *Selector) getPos() Pos     { return s.pos }
+func (t *TypeAssert) getPos() Pos   { return t.pos }
+func (c *CompositeLit) getPos() Pos { return c.pos }
+func (c *Conv) getPos() Pos         { return c.pos }
+func (i *IntLit) getPos() Pos       { return i.pos }
+func (n *Nil) getPos() Pos          { return n.pos }
+func (b *BuiltinCall) getPos() Pos  { return b.pos }
+func (s *SliceExpr) getPos() Pos    { return s.pos }
+func (m *MapLit) getPos() Pos       { return m.pos }
+func (c *CommaOk) getPos() Pos      { return c.pos }
+func (r *RangeNext) getPos() Pos    { return r.pos }
+func (s *StringLit) getPos() Pos    { return s.pos }
+func (b *Blank) getPos() Pos        { return b.pos }
+func (e *Empty) getPos() Pos        { return e.pos }
+
+// -------------------- Scopes --------------------
+// Scope is a lexical block. It maps the names declared in the block to
+// *Var or *Constant.
+type Scope struct {
+	outer *Scope
+	names map[string]interface{}
+	vars  []Pos // The positions of the variables in the order of declarations.
+}
 
-	tmp := newNoneType() // Temporary head.
-	ty := readTypePrefix(&tmp)
-	ty = tmp.base
+// The universe scope encloses all the source code. It declares the
+// predeclared types, constants, nil and builtin functions, which can be
+// shadowed by user declarations.
+var universe = &Scope{nil, map[string]interface{}{
+	"bool":    predeclaredType("bool"),
+	"int":     predeclaredType("int"),
+	"int8":    predeclaredType("int8"),
+	"int16":   predeclaredType("int16"),
+	"int32":   predeclaredType("int32"),
+	"int64":   predeclaredType("int64"),
+	"uint":    predeclaredType("uint"),
+	"uint8":   predeclaredType("uint8"),
+	"uint16":  predeclaredType("uint16"),
+	"uint32":  predeclaredType("uint32"),
+	"uint64":  predeclaredType("uint64"),
+	"uintptr": predeclaredType("uintptr"),
+	"string":  predeclaredType("string"),
+	"error":   &TypeName{"error", &Type{TY_INTERFACE, nil, 16, 1, nil, "error", nil, nil, nil, nil}, Pos{}},
+
+	"true":  &Constant{"true", newBoolConst(true, untypedType(TY_UNTYPED_BOOL), Pos{}), Pos{}},
+	"false": &Constant{"false", newBoolConst(false, untypedType(TY_UNTYPED_BOOL), Pos{}), Pos{}},
+	"iota":  iotaConst,
+	"nil":   &Nil{untypedType(TY_UNTYPED_NIL), Pos{}},
+
+	"append":  &Builtin{"append"},
+	"cap":     &Builtin{"cap"},
+	"copy":    &Builtin{"copy"},
+	"delete":  &Builtin{"delete"},
+	"len":     &Builtin{"len"},
+	"make":    &Builtin{"make"},
+	"new":     &Builtin{"new"},
+	"print":   &Builtin{"print"},
+	"println": &Builtin{"println"},
+}, nil}
+
+// iotaConst is the predeclared `iota`, whose value is iotaVal.
+var iotaConst = &Constant{"iota", nil, Pos{}}
+
+func init() {
+	// byte and rune are aliases.
+	universe.names["byte"] = &TypeName{"byte", universe.names["uint8"].(*TypeName).ty, Pos{}}
+	universe.names["rune"] = &TypeName{"rune", universe.names["int32"].(*TypeName).ty, Pos{}}
+
+	// error is `interface{ Error() string }`.
+	str := &Var{"", 0, true, universe.names["string"].(*TypeName).ty, Pos{}, nil}
+	errorMethod := &Function{"Error", nil, []*Var{}, []*Var{str}, nil, nil, 0, true, Pos{}, nil}
+	universe.names["error"].(*TypeName).ty.methods = []*Function{errorMethod}
+}
 
-	return &Var{tokId.str, 0, true, ty}
+func predeclaredType(name string) *TypeName {
+	ty := newLiteralType(name)
+	return &TypeName{name, &ty, Pos{}}
 }
 
-func consume(op string) bool {
-	if len(tokens) > 0 && tokens[0].str == op {
-		tokens = tokens[1:]
-		return true
+// The innermost scope of the code being parsed.
+var scope = universe
+
+// The package scope holding package-level declarations.
+var pkgScope *Scope
+
+// lazyDecl is a package-level const declaration or type spec. It is parsed
+// when one of its names is used first, so it can refer to names declared
+// later.
+type lazyDecl struct {
+	tokens  []Token // Tokens after `const`, or a TypeSpec.
+	names   []Token
+	isType  bool
+	parsing bool
+	done    bool
+	pos     Pos
+}
+
+// Package-level constants and types not parsed yet.
+var pendingDecls = map[string]*lazyDecl{}
+
+func enterScope() {
+	scope = &Scope{scope, map[string]interface{}{}, nil}
+}
+
+func leaveScope() {
+	scope = scope.outer
+}
+
+// declare adds obj named name to the innermost scope. The blank
+// identifier is never declared.
+func declare(name string, obj interface{}, pos Pos) {
+	if name == "_" {
+		return
 	}
-	return false
+	if _, ok := scope.names[name]; ok {
+		errorAt(pos, "%s redeclared in this block", name)
+	}
+	// A constant or type not parsed yet is reported when it is parsed unless it is
+	// declared earlier.
+	if g := pendingDecls[name]; scope == pkgScope && g != nil && !g.parsing {
+		for _, tok := range g.names {
+			if tok.str == name && (tok.pos.line < pos.line || tok.pos.line == pos.line && tok.pos.col < pos.col) {
+				errorAt(pos, "%s redeclared in this block", name)
+			}
+		}
+	}
+	if _, ok := obj.(*Var); ok {
+		scope.vars = append(scope.vars, pos)
+	}
+	scope.names[name] = obj
 }
 
-func consumeToken(tk TokenKind) *Token {
-	if len(tokens) > 0 && tokens[0].kind == tk {
-		tok := tokens[0]
-		tokens = tokens[1:]
-		return &tok
+// declarePkg adds obj named name to the package scope.
+func declarePkg(name string, obj interface{}, pos Pos) {
+	saved := scope
+	scope = pkgScope
+	declare(name, obj, pos)
+	scope = saved
+}
+
+// lookup returns the object named name in the innermost scope declaring
+// it, or nil.
+func lookup(name string) interface{} {
+	for s := scope; s != nil; s = s.outer {
+		if obj, ok := s.names[name]; ok {
+			return obj
+		}
+		if s == pkgScope && pendingDecls[name] != nil {
+			parseLazyDecl(pendingDecls[name])
+			return s.names[name]
+		}
 	}
 	return nil
 }
 
-func assert(op string) {
-	if len(tokens) > 0 && tokens[0].str == op {
-		tokens = tokens[1:]
+// parseLazyDecl parses a package-level const declaration or type spec in
+// the package scope.
+func parseLazyDecl(g *lazyDecl) {
+	if g.done {
 		return
 	}
-	panic(fmt.Sprintf("expected %s but got %s\n", op, tokens[0].str))
+	if g.parsing && g.isType {
+		errorAt(g.pos, "invalid recursive type %s", g.names[0].str)
+	}
+	if g.parsing {
+		errorAt(g.pos, "invalid constant cycle")
+	}
+	g.parsing = true
+	savedTokens, savedScope, savedIota := tokens, scope, iotaVal
+	tokens, scope = g.tokens, pkgScope
+	if g.isType {
+		typeSpec()
+	} else {
+		constDecl()
+	}
+	endDecl()
+	tokens, scope, iotaVal = savedTokens, savedScope, savedIota
+	g.done = true
 }
 
-func assertType() string {
-	tok := consumeToken(TK_TYPE)
-	if tok == nil {
-		panic(fmt.Sprintf("expected type but got %#v\n", tokens[0]))
+// endDecl checks that a package-level declaration parsed from saved
+// tokens has no extra tokens.
+func endDecl() {
+	if len(tokens) > 0 && !next(";") {
+		errorAt(peekPos(), "non-declaration statement outside function body")
 	}
+}
 
-	if !supportType(tok.str) {
-		panic(fmt.Sprintf("unsupported type %s\n", tok.str))
+// addRef records a reference to a package-level variable or function.
+func addRef(obj interface{}) {
+	for _, r := range tmpRefs {
+		if r == obj {
+			return
+		}
 	}
-	return tok.str
+	tmpRefs = append(tmpRefs, obj)
 }
 
-func next(op string) bool {
-	return len(tokens) != 0 && tokens[0].str == op
+func newLabel() string {
+	l := fmt.Sprintf(".L.data.%d", contentCnt)
+	contentCnt++
+	return l
 }
 
-func funcArgs() []Expr {
-	args := make([]Expr, 0)
-	if consume(")") {
-		return args
+// peekPos returns the position of the next token, or the end of the input.
+func peekPos() Pos {
+	if len(tokens) > 0 {
+		return tokens[0].pos
 	}
+	return eofPos
+}
 
-	args = append(args, expr())
-	for consume(",") {
-		args = append(args, expr())
+// peekStr describes the next token for error messages.
+func peekStr() string {
+	if len(tokens) == 0 {
+		return "EOF"
 	}
-	assert(")")
-	return args
+	if tokens[0].kind == TK_STRING {
+		return strconv.Quote(tokens[0].str)
+	}
+	return tokens[0].str
 }
 
-func funcParams() []*Var {
-	params := make([]*Var, 0)
-	if next(")") {
-		return params
+// arrayLen reads an array length such as `2` in `[2]int64`. `[` has
+// been already consumed.
+func arrayLen() int {
+	pos := peekPos()
+	if next("]") {
+		errorAt(pos, "expected array length but got %s", peekStr())
 	}
+	c, ok := expr().(*IntLit)
+	if !ok || !isInteger(c.ty) {
+		errorAt(pos, "array length must be a constant integer")
+	}
+	if c.val.Sign() < 0 || !c.val.IsInt64() {
+		errorAt(pos, "invalid array length %s", c.val)
+	}
+	assert("]")
+	return int(c.val.Int64())
+}
 
-	for {
-		v := varSpec()
-
-		tmpLocals = append(tmpLocals, v)
-		params = append(params, v)
+// isTypeStart reports whether the next token starts a type.
+func isTypeStart() bool {
+	if next("[") || next("*") || next("struct") || next("interface") || next("map") || next("func") {
+		return true
+	}
+	if len(tokens) == 0 || tokens[0].kind != TK_IDENT {
+		return false
+	}
+	_, ok := lookup(tokens[0].str).(*TypeName)
+	return ok
+}
 
-		if !consume(",") {
-			break
+// readType reads a type, or returns nil if no type starts here.
+//
+// Type      = TypeName | ArrayType | SliceType | PointerType | StructType | InterfaceType | MapType | FunctionType .
+// ArrayType = "[" ArrayLength "]" ElementType .
+// SliceType = "[" "]" ElementType .
+// PointerType = "*" BaseType .
+// MapType   = "map" "[" KeyType "]" ElementType .
+// FunctionType = "func" Parameters [ Result ] .
+func readType() *Type {
+	if consume("map") {
+		assert("[")
+		pos := peekPos()
+		key := readType()
+		if key == nil {
+			errorAt(pos, "expected map key type but got %s", peekStr())
+		}
+		// A type being declared is checked when it is used as a key.
+		if key.kind != TY_NONE && !isMapKey(key) {
+			errorAt(pos, "invalid map key type %s", key)
+		}
+		assert("]")
+		val := readType()
+		if val == nil {
+			errorAt(peekPos(), "expected map element type but got %s", peekStr())
 		}
+		ty := mapOf(key, val)
+		return &ty
 	}
-	return params
-}
 
-func ifHeaders() (Stmt, Expr) {
-	s1 := Stmt(nil)
-	e1 := expr()
-	if !next("{") {
-		s1 = simpleStmt(e1)
-		consume(";")
-		e1 = expr()
+	if consume("[") {
+		if consume("]") {
+			base := readType()
+			if base == nil {
+				errorAt(peekPos(), "expected element type but got %s", peekStr())
+			}
+			ty := sliceOf(base)
+			return &ty
+		}
+		length := arrayLen()
+		base := readType()
+		if base == nil {
+			errorAt(peekPos(), "expected element type but got %s", peekStr())
+		}
+		ty := arrayOf(base, length)
+		return &ty
 	}
-	return s1, e1
-}
 
-func forHeaders() (Stmt, Expr, Stmt) {
-	s1 := Stmt(nil)
-	e1 := Expr(nil)
-	s2 := Stmt(nil)
-	// No options.
-	if next("{") {
-		return s1, e1, s2
+	if consume("*") {
+		base := readType()
+		if base == nil {
+			errorAt(peekPos(), "expected pointer base type but got %s", peekStr())
+		}
+		ty := pointerTo(base)
+		return &ty
 	}
-	// Condition.
-	e1 = expr()
-	// For clause ([init] ; [cond] ; [post]).
-	if !next("{") {
-		s1 = simpleStmt(e1)
-		consume(";") // No semi colon when e1 is Empty.
-		e1 = expr()
+
+	if consume("struct") {
+		ty := &Type{TY_STRUCT, nil, -1, 1, nil, "", nil, nil, nil, nil}
+		structType(ty)
+		return ty
 	}
-	if !next("{") {
-		s2 = simpleStmt(expr())
-		consume(";") // No semi colon when expr() is Empty.
+
+	if consume("interface") {
+		ty := newLiteralType("interface")
+		interfaceType(&ty)
+		return &ty
 	}
-	return s1, e1, s2
-}
 
-func program() (Program, string) {
-	assert("package")
-	tok := consumeToken(TK_IDENT)
-	pkgName := tok.str
-	consume(";")
+	if consume("func") {
+		params := funcParams()
+		ty := funcOf(params, funcResults())
+		return &ty
+	}
 
-	funcs := make([]*Function, 0)
+	if tok := consumeToken(TK_IDENT); tok != nil {
+		switch obj := lookup(tok.str).(type) {
+		case *TypeName:
+			return obj.ty
+		case nil:
+			errorAt(tok.pos, "undefined: %s", tok.str)
+		}
+		errorAt(tok.pos, "%s is not a type", tok.str)
+	}
+	return nil
+}
 
-	preStmts := make([]Stmt, 0)
-	funcs = append(funcs, &Function{"preMain", []*Var{}, []*Var{}, nil, 8})
-	for len(tokens) > 0 {
-		if consume("func") {
-			funcs = append(funcs, function())
+// StructType = "struct" "{" { FieldDecl ";" } "}" .
+// FieldDecl  = IdentifierList Type .
+//
+// structType reads the fields of ty. `struct` has been already consumed.
+func structType(ty *Type) {
+	assert("{")
+	for !consume("}") {
+		if consume(";") {
 			continue
 		}
-
-		// Global variable.
-		if consume("var") {
-			v := varSpec()
-
-			v.isLocal = false
-			globals = append(globals, v)
-
-			if consume(";") {
-				continue
+		names := make([]*Token, 0)
+		for {
+			tok := consumeToken(TK_IDENT)
+			if tok == nil {
+				errorAt(peekPos(), "expected field name but got %s", peekStr())
 			}
-
-			if consume("=") {
-				preStmts = append(preStmts, assign(v))
+			names = append(names, tok)
+			if !consume(",") {
+				break
 			}
-			continue
 		}
+		pos := peekPos()
+		fty := readType()
+		if fty == nil {
+			errorAt(pos, "expected field type but got %s", peekStr())
+		}
+		if t := incompleteType(fty); t != nil {
+			errorAt(pos, "invalid recursive type %s", t)
+		}
+		for _, name := range names {
+			if name.str != "_" && findField(ty, name.str) != nil {
+				errorAt(name.pos, "duplicate field %s", name.str)
+			}
+			ty.fields = append(ty.fields, &Field{name.str, fty, 0, name.pos})
+		}
+		if !next("}") {
+			assert(";")
+		}
+	}
+	layoutStruct(ty)
+}
 
+// InterfaceType = "interface" "{" { InterfaceElem ";" } "}" .
+// InterfaceElem = MethodName Signature | InterfaceTypeName .
+//
+// interfaceType reads the methods of ty. `interface` has been already
+// consumed. The methods of an embedded interface are added to ty. Methods
+// are sorted by their names, which decides the order in method tables.
+func interfaceType(ty *Type) {
+	assert("{")
+	for !consume("}") {
 		if consume(";") {
 			continue
 		}
+		tok := consumeToken(TK_IDENT)
+		if tok == nil {
+			errorAt(peekPos(), "expected method or interface name but got %s", peekStr())
+		}
+		if next("(") {
+			params := funcParams()
+			fn := &Function{tok.str, nil, params, funcResults(), nil, nil, 0, true, tok.pos, nil}
+			addInterfaceMethod(ty, fn)
+		} else {
+			var ety *Type
+			switch obj := lookup(tok.str).(type) {
+			case *TypeName:
+				ety = obj.ty
+			case nil:
+				errorAt(tok.pos, "undefined: %s", tok.str)
+			default:
+				errorAt(tok.pos, "%s is not a type", tok.str)
+			}
+			if ety.size < 0 {
+				errorAt(tok.pos, "invalid recursive type %s", ety)
+			}
+			if ety.kind != TY_INTERFACE {
+				errorAt(tok.pos, "interface contains type constraints")
+			}
+			for _, m := range ety.methods {
+				addInterfaceMethod(ty, m)
+			}
+		}
+		if !next("}") {
+			assert(";")
+		}
 	}
-	ty := newLiteralType("int64")
-	preStmts = append(preStmts, &Return{&IntLit{0, &ty}})
-	funcs[0].stmts = preStmts
-	return Program{globals, contents, funcs}, pkgName
 }
 
-func function() *Function {
-	// Initialize for a function.
-	tmpLocals = make([]*Var, 0)
-
-	tok := consumeToken(TK_IDENT)
-	if tok == nil {
-		panic(fmt.Sprintf("expected an identifier after 'func' keyword but got %#v\n", tok))
+// addInterfaceMethod inserts fn to the methods of an interface ty in the
+// order of names.
+func addInterfaceMethod(ty *Type, fn *Function) {
+	i := 0
+	for i < len(ty.methods) && ty.methods[i].name < fn.name {
+		i++
 	}
-	name := tok.str
-	assert("(")
-	params := funcParams()
-	assert(")")
-
-	stmts := make([]Stmt, 0)
-	for len(tokens) > 0 && !next("func") {
-		s := stmt()
-		stmts = append(stmts, s)
+	if i < len(ty.methods) && ty.methods[i].name == fn.name {
+		errorAt(fn.pos, "duplicate method %s", fn.name)
 	}
-	return &Function{name, params, tmpLocals, stmts, 0}
+	ty.methods = append(ty.methods, nil)
+	copy(ty.methods[i+1:], ty.methods[i:])
+	ty.methods[i] = fn
 }
 
-func assign(v *Var) Stmt {
-	length := arrayLength()
-	if length == -1 {
-		return &Assign{[]Expr{v}, []Expr{expr()}}
+// refSize returns the size of a pointer, slice, map or function type
+// literal that comes next, or -1 for other types.
+func refSize() int {
+	switch {
+	case next("*"), next("map"), next("func"):
+		return 8
+	case next("[") && len(tokens) > 1 && isOp(tokens[1], "]"):
+		return 24
 	}
+	return -1
+}
 
-	// Only supports initialization for one-dimentional array.
-	tystr := assertType()
-	assert("{")
-	ty := newNoneType()
-
-	// Type inference `:=`.
-	if v.ty.kind == TY_NONE {
-		base := newLiteralType(tystr)
-		ty := arrayOf(&base, length)
-		v.setType(&ty)
+// TypeDecl = "type" ( TypeSpec | "(" { TypeSpec ";" } ")" ) .
+func typeDecl() {
+	if !consume("(") {
+		typeSpec()
+		return
 	}
-
-	lvals := make([]Expr, length)
-	rvals := exprList()
-	// Expand left-side expressions.
-	for i := 0; i < length; i++ {
-		lvals[i] = &ArrayRef{v, &IntLit{i, &ty}, &ty}
+	for !consume(")") {
+		if consume(";") {
+			continue
+		}
+		typeSpec()
+		if !next(")") {
+			assert(";")
+		}
 	}
-	assert("}")
-	consume(";")
-	return &Assign{lvals, rvals}
 }
 
-func stmt() Stmt {
-	// Standard libraries.
-	tok := consumeToken(TK_LIBS)
-	if tok != nil {
-		assert("(")
-		return &Stdlib{tok.str, funcArgs()}
+// TypeSpec  = AliasDecl | TypeDef .
+// AliasDecl = identifier "=" Type .
+// TypeDef   = identifier Type .
+//
+// A defined type is declared before its underlying type is read so that
+// the underlying type can point to the defined type itself. So is an alias
+// of a type literal whose size does not depend on its elements.
+func typeSpec() {
+	tok := consumeToken(TK_IDENT)
+	if tok == nil {
+		errorAt(peekPos(), "expected type name but got %s", peekStr())
 	}
 
-	// Var declaration.
-	if consume("var") {
-		v := varSpec()
+	// An alias denotes the same type.
+	alias := consume("=")
+	if alias && refSize() < 0 {
+		pos := peekPos()
+		ty := readType()
+		if ty == nil {
+			errorAt(pos, "expected type but got %s", peekStr())
+		}
+		declare(tok.str, &TypeName{tok.str, ty, tok.pos}, tok.pos)
+		return
+	}
+
+	// The size of the type is known while it is being declared if it
+	// refers to other types, which a struct can then contain.
+	ty := &Type{TY_NONE, nil, refSize(), 1, nil, tok.str, nil, nil, nil, nil}
+	declare(tok.str, &TypeName{tok.str, ty, tok.pos}, tok.pos)
+	pos := peekPos()
+	under := readType()
+	if under == nil {
+		errorAt(pos, "expected type but got %s", peekStr())
+	}
+	if t := incompleteType(under); t != nil {
+		errorAt(pos, "invalid recursive type %s", t)
+	}
+	if alias {
+		*ty = *under
+		return
+	}
+	// A defined type does not inherit the methods of its underlying type
+	// unless it is an interface.
+	*ty = *under
+	ty.name = tok.str
+	if ty.kind != TY_INTERFACE {
+		ty.methods = nil
+	}
+}
+
+// VarSpec = Identifier ( Type [ "=" Expression ] )
+func varSpec() *Var {
+	tokId := consumeToken(TK_IDENT)
+	if tokId == nil {
+		errorAt(peekPos(), "expected an identifier but got %s", peekStr())
+	}
+
+	ty := readType()
+	if ty == nil {
+		nty := newNoneType()
+		ty = &nty
+	}
+
+	return &Var{tokId.str, 0, true, ty, tokId.pos, nil}
+}
+
+// ConstDecl = "const" ( ConstSpec | "(" { ConstSpec ";" } ")" ) .
+// ConstSpec = IdentifierList [ [ Type ] "=" ExpressionList ] .
+//
+// A ConstSpec without expressions in a group repeats the previous type and
+// expressions with the next value of iota. Constants are declared one by
+// one so that later ones can refer to them.
+func constDecl() {
+	group := consume("(")
+
+	var ty *Type
+	var prev []Token
+	for iotaVal = 0; ; iotaVal++ {
+		if group {
+			for consume(";") {
+			}
+			if consume(")") {
+				break
+			}
+		}
+
+		names := make([]*Token, 0)
+		for {
+			tok := consumeToken(TK_IDENT)
+			if tok == nil {
+				errorAt(peekPos(), "expected an identifier but got %s", peekStr())
+			}
+			names = append(names, tok)
+			if !consume(",") {
+				break
+			}
+		}
+
+		pos := peekPos()
+		var exprs []Expr
+		var poss []Pos
+		if isTypeStart() || next("=") {
+			ty = readType()
+			assert("=")
+			start := tokens
+			exprs, poss = constExprList()
+			prev = start[:len(start)-len(tokens)]
+		} else {
+			if prev == nil {
+				errorAt(pos, "missing init expr for const declaration")
+			}
+			rest := tokens
+			tokens = prev
+			exprs, poss = constExprList()
+			tokens = rest
+		}
+
+		if len(exprs) < len(names) {
+			errorAt(pos, "missing init expr for const declaration")
+		}
+		if len(exprs) > len(names) {
+			errorAt(poss[len(names)], "extra init expr")
+		}
+		for i, name := range names {
+			val := constInit(exprs[i], ty, poss[i])
+			declare(name.str, &Constant{name.str, val, name.pos}, name.pos)
+		}
+
+		if !group {
+			break
+		}
+		if !next(")") {
+			assert(";")
+		}
+	}
+	iotaVal = -1
+}
+
+// constExprList parses an ExpressionList and returns the positions of the
+// expressions too.
+func constExprList() ([]Expr, []Pos) {
+	exprs := make([]Expr, 0)
+	poss := make([]Pos, 0)
+	for {
+		poss = append(poss, peekPos())
+		exprs = append(exprs, expr())
+		if !consume(",") {
+			return exprs, poss
+		}
+	}
+}
+
+// constInit checks that e at pos is a constant and converts it to ty if
+// the type is given.
+func constInit(e Expr, ty *Type, pos Pos) Expr {
+	switch c := e.(type) {
+	case *IntLit:
+		if ty != nil {
+			convertConst(c, ty)
+			if c.ty.kind != ty.kind {
+				errorAt(c.pos, "cannot use value of type %s as %s value in constant declaration", c.ty, ty)
+			}
+		}
+		return c
+	case *StringLit:
+		if ty == nil {
+			return c
+		}
+		if ty.kind != TY_STRING {
+			errorAt(c.pos, "cannot use value of type %s as %s value in constant declaration", c.ty, ty)
+		}
+		// The string data is shared with the literal.
+		lit := *c
+		lit.ty = ty
+		lit.typed = true
+		return &lit
+	}
+	errorAt(pos, "const initializer is not a constant")
+	return nil
+}
+
+// constValue returns the value of c used at pos.
+func constValue(c *Constant, pos Pos) Expr {
+	switch v := c.val.(type) {
+	case *IntLit:
+		return &IntLit{v.val, v.ty, pos}
+	case *StringLit:
+		// The string data is shared with the original literal.
+		lit := *v
+		lit.pos = pos
+		return &lit
+	}
+	panic(fmt.Sprintf("unexpected constant %#v", c.val))
+}
+
+// isOp reports whether tok is the keyword or punctuator op. A string
+// literal holds its decoded value in str, so the kind must be checked too.
+func isOp(tok Token, op string) bool {
+	return tok.kind == TK_RESERVED && tok.str == op
+}
+
+func consume(op string) bool {
+	if len(tokens) > 0 && isOp(tokens[0], op) {
+		tokens = tokens[1:]
+		return true
+	}
+	return false
+}
+
+func consumeToken(tk TokenKind) *Token {
+	if len(tokens) > 0 && tokens[0].kind == tk {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		return &tok
+	}
+	return nil
+}
+
+func assert(op string) {
+	if len(tokens) > 0 && isOp(tokens[0], op) {
+		tokens = tokens[1:]
+		return
+	}
+	errorAt(peekPos(), "expected %s but got %s", op, peekStr())
+}
+
+func next(op string) bool {
+	return len(tokens) != 0 && isOp(tokens[0], op)
+}
+
+func funcArgs() []Expr {
+	args := make([]Expr, 0)
+	if consume(")") {
+		return args
+	}
+
+	saved := noLit
+	noLit = false
+	args = append(args, expr())
+	// The last argument may be followed by a comma.
+	for consume(",") && !next(")") {
+		args = append(args, expr())
+	}
+	noLit = saved
+	assert(")")
+	return args
+}
+
+// Conversion = Type "(" Expression [ "," ] ")" .
+//
+// conversion parses a conversion to ty such as `int8(x)`. `(` has been
+// already consumed. A constant is converted at compile time, and an
+// integer constant converted to a string is the UTF-8 of the rune.
+func conversion(ty *Type, pos Pos) Expr {
+	args := funcArgs()
+	if len(args) == 0 {
+		errorAt(pos, "missing argument in conversion to %s", ty)
+	}
+	if len(args) > 1 {
+		errorAt(args[1].getPos(), "too many arguments in conversion to %s", ty)
+	}
+	c, ok := args[0].(*IntLit)
+	isBool := func(t *Type) bool { return t.kind == TY_BOOL || t.kind == TY_UNTYPED_BOOL }
+	if ok && (isInteger(ty) && isInteger(c.ty) || isBool(ty) && isBool(c.ty)) {
+		v := &IntLit{new(big.Int).Set(c.val), c.ty, c.pos}
+		convertConst(v, ty)
+		v.pos = pos
+		return v
+	}
+	if ok && ty.kind == TY_STRING && isInteger(c.ty) {
+		r := utf8.RuneError
+		if v := c.val.Int64(); c.val.IsInt64() && v >= 0 && v <= utf8.MaxRune && utf8.ValidRune(rune(v)) {
+			r = rune(v)
+		}
+		n := &StringLit{string(r), newLabel(), ty, true, pos}
+		contents = append(contents, n)
+		return n
+	}
+	return &Conv{args[0], ty, pos}
+}
+
+// builtinCall parses a call of the builtin function b. `(` has been
+// already consumed. `new(T)` takes a type and allocates a zero value of T
+// on the heap. The length of a constant string is a constant, and so are
+// the length and the capacity of a variable declared with an array type or
+// a pointer to one.
+func builtinCall(b *Builtin, pos Pos) Expr {
+	nty := newNoneType()
+	if b.name == "new" {
+		if next(")") {
+			errorAt(pos, "not enough arguments for new() (expected 1, found 0)")
+		}
+		ty := readType()
+		if !next(")") {
+			errorAt(peekPos(), "too many arguments for new(%s) (expected 1, found 2)", ty)
+		}
+		assert(")")
+		ptr := pointerTo(ty)
+		return &Addr{&CompositeLit{nil, nil, nil, true, ty, pos}, &ptr, pos}
+	}
+
+	if b.name == "make" {
+		// The type of the result is the first argument.
+		ty := readType()
+		if ty == nil {
+			errorAt(pos, "not enough arguments for make() (expected 1, found 0)")
+		}
+		args := make([]Expr, 0)
+		if consume(",") {
+			args = funcArgs()
+		} else {
+			assert(")")
+		}
+		return &BuiltinCall{b.name, args, false, ty, pos}
+	}
+
+	// The last argument of append may be followed by `...`.
+	saved := noLit
+	noLit = false
+	args := make([]Expr, 0)
+	dots := false
+	for !next(")") {
+		args = append(args, expr())
+		if next("...") {
+			if b.name != "append" {
+				errorAt(peekPos(), "invalid use of ... with built-in %s", b.name)
+			}
+			consume("...")
+			dots = true
+			break
+		}
+		if !consume(",") {
+			break
+		}
+	}
+	noLit = saved
+	assert(")")
+
+	switch b.name {
+	case "len", "cap":
+		builtinArity(b.name, args, 1, pos)
+	case "copy", "delete":
+		builtinArity(b.name, args, 2, pos)
+	case "append":
+		if len(args) == 0 {
+			errorAt(pos, "not enough arguments for append() (expected 1, found 0)")
+		}
+	}
+	if b.name == "len" || b.name == "cap" {
+		ty := newLiteralType("int")
+		switch arg := args[0].(type) {
+		case *StringLit:
+			if b.name == "len" {
+				return &IntLit{big.NewInt(int64(len(arg.val))), &ty, pos}
+			}
+		case *Var:
+			aty := arg.ty
+			if aty.kind == TY_PTR && aty.base.kind == TY_ARRAY {
+				aty = aty.base
+			}
+			if aty.kind == TY_ARRAY {
+				return &IntLit{big.NewInt(int64(aty.aryLen)), &ty, pos}
+			}
+		}
+	}
+	return &BuiltinCall{b.name, args, dots, &nty, pos}
+}
+
+// builtinArity checks that the builtin function name is called with n
+// arguments.
+func builtinArity(name string, args []Expr, n int, pos Pos) {
+	if len(args) < n {
+		errorAt(pos, "not enough arguments for %s() (expected %d, found %d)", name, n, len(args))
+	}
+	if len(args) > n {
+		errorAt(args[n].getPos(), "too many arguments for %s() (expected %d, found %d)", name, n, len(args))
+	}
+}
+
+// CompositeLit = LiteralType "{" [ ElementList [ "," ] ] "}" .
+// ElementList  = KeyedElement { "," KeyedElement } .
+// KeyedElement = [ FieldName ":" ] Element .
+//
+// Either all elements of a struct literal have field names or none has.
+// Elements without field names are given to all fields in order. Elements
+// of an array literal are given to elements from index 0.
+func compositeLit(ty *Type, pos Pos) Expr {
+	if ty.kind == TY_ARRAY || ty.kind == TY_SLICE {
+		return arrayLit(ty, pos)
+	}
+	if ty.kind == TY_MAP {
+		return mapLit(ty, pos)
+	}
+	if ty.kind != TY_STRUCT {
+		errorAt(pos, "invalid composite literal type %s", ty)
+	}
+	saved := noLit
+	noLit = false
+	lit := &CompositeLit{make([]*Field, 0), make([]Expr, 0), nil, false, ty, pos}
+	keyed := false
+	assert("{")
+	for i := 0; !next("}"); i++ {
+		epos := peekPos()
+		isKey := len(tokens) > 1 && tokens[0].kind == TK_IDENT && isOp(tokens[1], ":")
+		if i > 0 && isKey != keyed {
+			errorAt(epos, "mixture of field:value and value elements in struct literal")
+		}
+		keyed = isKey
+
+		var f *Field
+		if keyed {
+			name := consumeToken(TK_IDENT)
+			assert(":")
+			f = findField(ty, name.str)
+			if f == nil {
+				errorAt(name.pos, "unknown field %s in struct literal of type %s", name.str, ty)
+			}
+			for _, g := range lit.fields {
+				if g == f {
+					errorAt(name.pos, "duplicate field name %s in struct literal", name.str)
+				}
+			}
+		} else {
+			if i >= len(ty.fields) {
+				errorAt(epos, "too many values in struct literal of type %s", ty)
+			}
+			f = ty.fields[i]
+		}
+		lit.fields = append(lit.fields, f)
+		lit.vals = append(lit.vals, expr())
+		if !consume(",") {
+			break
+		}
+	}
+	if !keyed && len(lit.vals) > 0 && len(lit.vals) < len(ty.fields) {
+		errorAt(peekPos(), "too few values in struct literal of type %s", ty)
+	}
+	assert("}")
+	noLit = saved
+	return lit
+}
+
+// arrayLit parses an array or slice literal. Each element is held as a
+// field without a name at the offset of the element. The type of an
+// element may be elided if it is also a composite literal. The elements of a
+// slice literal are in an array on the heap, which the slice refers to.
+func arrayLit(ty *Type, pos Pos) Expr {
+	saved := noLit
+	noLit = false
+	lit := &CompositeLit{make([]*Field, 0), make([]Expr, 0), nil, false, ty, pos}
+	fillSize(ty.base)
+	if ty.kind == TY_ARRAY {
+		fillSize(ty)
+	}
+	assert("{")
+	for i := 0; !next("}"); i++ {
+		if ty.kind == TY_ARRAY && i >= ty.aryLen {
+			errorAt(peekPos(), "array index %d out of bounds [0:%d]", i, ty.aryLen)
+		}
+		lit.fields = append(lit.fields, &Field{"", ty.base, i * ty.base.size, peekPos()})
+		if next("{") {
+			// The type of an element literal may be elided.
+			lit.vals = append(lit.vals, compositeLit(ty.base, peekPos()))
+		} else {
+			lit.vals = append(lit.vals, expr())
+		}
+		if !consume(",") {
+			break
+		}
+	}
+	assert("}")
+	noLit = saved
+	if ty.kind == TY_ARRAY {
+		return lit
+	}
+
+	aty := arrayOf(ty.base, len(lit.vals))
+	lit.ty = &aty
+	lit.heap = true
+	ptr := pointerTo(&aty)
+	return &SliceExpr{&Addr{lit, &ptr, pos}, nil, nil, nil, ty, pos}
+}
+
+// mapLit parses a map literal. Every element has a key.
+func mapLit(ty *Type, pos Pos) Expr {
+	saved := noLit
+	noLit = false
+	lit := &MapLit{make([]Expr, 0), make([]Expr, 0), ty, pos}
+	assert("{")
+	for !next("}") {
+		kpos := peekPos()
+		lit.keys = append(lit.keys, expr())
+		if !consume(":") {
+			errorAt(kpos, "missing key in map literal")
+		}
+		if next("{") {
+			lit.vals = append(lit.vals, compositeLit(ty.base, peekPos()))
+		} else {
+			lit.vals = append(lit.vals, expr())
+		}
+		if !consume(",") {
+			break
+		}
+	}
+	assert("}")
+	noLit = saved
+	return lit
+}
+
+// Parameters    = "(" [ ParameterList [ "," ] ] ")" .
+// ParameterList = ParameterDecl { "," ParameterDecl } .
+// ParameterDecl = [ IdentifierList ] Type .
+//
+// Either all parameters are named or none is. Unnamed parameters are
+// returned as variables without names.
+func funcParams() []*Var {
+	assert("(")
+	params := make([]*Var, 0)
+	named := false
+	for !next(")") {
+		pos := peekPos()
+		tok := consumeToken(TK_IDENT)
+		ty := readType()
+		if tok == nil && ty == nil {
+			errorAt(peekPos(), "expected parameter but got %s", peekStr())
+		}
+		if tok != nil {
+			params = append(params, &Var{tok.str, 0, true, ty, pos, nil})
+		} else {
+			params = append(params, &Var{"", 0, true, ty, pos, nil})
+		}
+		if tok != nil && ty != nil {
+			named = true
+		}
+		if !consume(",") {
+			break
+		}
+	}
+	assert(")")
+
+	if !named {
+		// Names alone such as `T` in `func(T)` are types.
+		for _, p := range params {
+			if p.ty != nil {
+				continue
+			}
+			switch obj := lookup(p.name).(type) {
+			case *TypeName:
+				p.name = ""
+				p.ty = obj.ty
+			case nil:
+				errorAt(p.pos, "undefined: %s", p.name)
+			default:
+				errorAt(p.pos, "%s is not a type", p.name)
+			}
+		}
+		return params
+	}
+
+	// A type applies to the preceding names without types such as
+	// `a, b int64`.
+	var ty *Type
+	for i := len(params) - 1; i >= 0; i-- {
+		p := params[i]
+		if p.name == "" {
+			errorAt(p.pos, "mixed named and unnamed parameters")
+		}
+		if p.ty != nil {
+			ty = p.ty
+		} else if ty == nil {
+			errorAt(p.pos, "mixed named and unnamed parameters")
+		} else {
+			p.ty = ty
+		}
+	}
+	return params
+}
+
+// Result = Parameters | Type .
+func funcResults() []*Var {
+	pos := peekPos()
+	if next("(") {
+		return funcParams()
+	}
+	ty := readType()
+	if ty == nil {
+		return []*Var{}
+	}
+	return []*Var{&Var{"", 0, true, ty, pos, nil}}
+}
+
+func findFunc(name string) *Function {
+	for _, fn := range funcs {
+		if fn.name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// condExpr returns the expression of s, which is used as a condition.
+func condExpr(s Stmt) Expr {
+	e, ok := s.(*ExprStmt)
+	if !ok {
+		errorAt(peekPos(), "expected boolean expression, found simple statement")
+	}
+	return e.child
+}
+
+// IfStmt = "if" [ SimpleStmt ";" ] Expression Block [ "else" ( IfStmt | Block ) ] .
+func ifHeaders() (Stmt, Expr) {
+	saved := noLit
+	noLit = true
+	defer func() { noLit = saved }()
+	s1 := simpleStmt()
+	if consume(";") {
+		return s1, expr()
+	}
+	return nil, condExpr(s1)
+}
+
+// ForStmt = "for" [ Condition | ForClause ] Block .
+// ForClause = [ InitStmt ] ";" [ Condition ] ";" [ PostStmt ] .
+func forHeaders() (Stmt, Expr, Stmt) {
+	saved := noLit
+	noLit = true
+	defer func() { noLit = saved }()
+	s1 := Stmt(nil)
+	e1 := Expr(nil)
+	s2 := Stmt(nil)
+	// No options.
+	if next("{") {
+		return s1, e1, s2
+	}
+	if !next(";") {
+		s1 = simpleStmt()
+		// Condition.
+		if next("{") {
+			return nil, condExpr(s1), nil
+		}
+	}
+	// For clause.
+	assert(";")
+	if !next(";") {
+		e1 = expr()
+	}
+	assert(";")
+	if !next("{") {
+		s2 = simpleStmt()
+	}
+	return s1, e1, s2
+}
+
+// isRangeClause reports whether the next tokens are a range clause, in
+// which `range` comes before the block.
+func isRangeClause() bool {
+	for _, tok := range tokens {
+		if tok.kind != TK_RESERVED {
+			continue
+		}
+		switch tok.str {
+		case "range":
+			return true
+		case "{", ";":
+			return false
+		}
+	}
+	return false
+}
+
+// RangeClause = [ ExpressionList "=" | IdentifierList ":=" ] "range" Expression .
+// The variables declared by `:=` are visible in the block.
+func rangeClause(pos Pos) *Range {
+	saved := noLit
+	noLit = true
+	defer func() { noLit = saved }()
+	r := &Range{pos: pos}
+	newVars := make([]*Var, 0)
+	switch {
+	case next("range"):
+	case isShortVarDecl():
+		for !next(":=") {
+			tok := consumeToken(TK_IDENT)
+			consume(",")
+			ty := newNoneType()
+			if tok.str == "_" {
+				r.lvals = append(r.lvals, &Blank{&ty, tok.pos})
+				continue
+			}
+			for _, v := range newVars {
+				if v.name == tok.str {
+					errorAt(tok.pos, "%s repeated on left side of :=", tok.str)
+				}
+			}
+			v := &Var{tok.str, 0, true, &ty, tok.pos, nil}
+			r.lvals = append(r.lvals, v)
+			newVars = append(newVars, v)
+		}
+		assert(":=")
+	default:
+		r.lvals = exprList()
+		assert("=")
+	}
+	if len(r.lvals) > 2 {
+		errorAt(r.lvals[2].getPos(), "range clause permits at most two iteration variables")
+	}
+	r.pos = peekPos()
+	assert("range")
+	r.x = expr()
+	for _, v := range newVars {
+		tmpLocals = append(tmpLocals, v)
+		declare(v.name, v, v.pos)
+	}
+	r.vars = newVars
+	return r
+}
+
+// SwitchStmt = "switch" [ SimpleStmt ";" ] [ Expression | TypeSwitchGuard ] "{" { CaseClause } "}" .
+func switchHeaders(pos Pos) *Switch {
+	saved := noLit
+	noLit = true
+	defer func() { noLit = saved }()
+	sw := &Switch{pos: pos}
+	if next("{") {
+		return sw
+	}
+	if !isTypeSwitchGuard() {
+		s1 := simpleStmt()
+		if !consume(";") {
+			e, ok := s1.(*ExprStmt)
+			if !ok {
+				errorAt(peekPos(), "expected switch expression, found simple statement")
+			}
+			sw.tag = e.child
+			return sw
+		}
+		sw.init = s1
+		if next("{") {
+			return sw
+		}
+	}
+	if isTypeSwitchGuard() {
+		typeSwitchGuard(sw)
+		return sw
+	}
+	sw.tag = expr()
+	return sw
+}
+
+// isTypeSwitchGuard reports whether the next simple statement of a switch
+// header has the guard `.(type)`.
+func isTypeSwitchGuard() bool {
+	depth := 0
+	for i, tok := range tokens {
+		if tok.kind != TK_RESERVED {
+			continue
+		}
+		switch tok.str {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case "{", ";":
+			if depth == 0 {
+				return false
+			}
+		case "type":
+			if i >= 2 && isOp(tokens[i-1], "(") && isOp(tokens[i-2], ".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TypeSwitchGuard = [ identifier ":=" ] PrimaryExpr "." "(" "type" ")" .
+// The variable is declared in each clause.
+func typeSwitchGuard(sw *Switch) {
+	if len(tokens) > 1 && tokens[0].kind == TK_IDENT && isOp(tokens[1], ":=") {
+		sw.bind = tokens[0].str
+		if sw.bind == "_" {
+			errorAt(tokens[0].pos, "no new variable on left side of :=")
+		}
+		tokens = tokens[2:]
+	}
+	guardOk = true
+	e := expr()
+	g, ok := e.(*TypeAssert)
+	if guardOk || !ok || g.ty != nil {
+		errorAt(e.getPos(), "use of .(type) outside type switch")
+	}
+	sw.guard = g
+}
+
+// CaseClause = ( "case" ExpressionList | "default" ) ":" StatementList .
+// TypeCaseClause = ( "case" TypeList | "default" ) ":" StatementList .
+// Each clause is a block. A fallthrough statement may end a clause except
+// the last one.
+func caseClauses(sw *Switch) []*Case {
+	assert("{")
+	cases := make([]*Case, 0)
+	hasDefault := false
+	for !consume("}") {
+		if consume(";") {
+			continue
+		}
+		c := &Case{pos: peekPos()}
+		if consume("default") {
+			if hasDefault {
+				errorAt(c.pos, "multiple defaults in switch")
+			}
+			hasDefault = true
+		} else {
+			assert("case")
+			if sw.guard != nil {
+				c.types = typeList()
+			} else {
+				c.vals = exprList()
+			}
+		}
+		assert(":")
+
+		enterScope()
+		if sw.bind != "" {
+			ty := newNoneType()
+			c.v = &Var{sw.bind, 0, true, &ty, c.pos, nil}
+			tmpLocals = append(tmpLocals, c.v)
+			declare(c.v.name, c.v, c.v.pos)
+		}
+		stmts := make([]Stmt, 0)
+		for !next("case") && !next("default") && !next("}") {
+			if len(tokens) == 0 {
+				errorAt(eofPos, "expected } but got EOF")
+			}
+			if consume(";") {
+				continue
+			}
+			if next("fallthrough") {
+				pos := peekPos()
+				tokens = tokens[1:]
+				consume(";")
+				if next("}") {
+					errorAt(pos, "cannot fallthrough final case in switch")
+				}
+				if !next("case") && !next("default") {
+					errorAt(pos, "fallthrough statement out of place")
+				}
+				if sw.guard != nil {
+					errorAt(pos, "cannot fallthrough in type switch")
+				}
+				c.fall = true
+				continue
+			}
+			stmts = append(stmts, stmt())
+		}
+		leaveScope()
+		c.body = &Block{stmts, c.pos}
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+// typeList reads the types of a case clause in a type switch. nil stands
+// for the predeclared nil.
+func typeList() []*Type {
+	types := make([]*Type, 0)
+	for {
+		if nextNil() {
+			tokens = tokens[1:]
+			types = append(types, nil)
+		} else {
+			ty := readType()
+			if ty == nil {
+				errorAt(peekPos(), "expected type but got %s", peekStr())
+			}
+			types = append(types, ty)
+		}
+		if !consume(",") {
+			return types
+		}
+	}
+}
+
+// nextNil reports whether the next token is the predeclared nil.
+func nextNil() bool {
+	if len(tokens) == 0 || tokens[0].kind != TK_IDENT {
+		return false
+	}
+	_, ok := lookup(tokens[0].str).(*Nil)
+	return ok
+}
+
+// pkgDecl is a package-level declaration. Its body is parsed after all
+// package-level names are declared so that they can be used in any order.
+type pkgDecl struct {
+	fn       *Function // A function or nil.
+	fnScope  *Scope
+	v        *Var // A variable with an initializer. It is blank if v.name is "_".
+	assignAt Pos
+	body     []Token // The function body or the initializer.
+	stmt     Stmt    // The parsed initializer.
+	refs     []interface{}
+}
+
+func program() (Program, string) {
+	assert("package")
+	tok := consumeToken(TK_IDENT)
+	if tok == nil {
+		errorAt(peekPos(), "expected package name but got %s", peekStr())
+	}
+	pkgName := tok.str
+	consume(";")
+
+	funcs = make([]*Function, 0)
+	funcs = append(funcs, &Function{"preMain", nil, []*Var{}, []*Var{}, []*Var{}, nil, 8, false, tok.pos, nil})
+
+	// Package scope and file scope.
+	enterScope()
+	pkgScope = scope
+	enterScope()
+
+	// Declare package-level names first. Constants are parsed when they are
+	// used first, so types such as array lengths can use them.
+	lazyDecls := findLazyDecls()
+	decls := make([]*pkgDecl, 0)
+	for len(tokens) > 0 {
+		if consume("func") {
+			decls = append(decls, funcDecl())
+			continue
+		}
+
+		// Global constants and types were found by findLazyDecls.
+		if consume("const") || consume("type") {
+			skipDecl()
+			continue
+		}
+
+		// Global variable.
+		if consume("var") {
+			v := varSpec()
+			v.isLocal = false
+			if v.name != "_" {
+				globals = append(globals, v)
+				declarePkg(v.name, v, v.pos)
+			}
+			pos := peekPos()
+			if consume("=") {
+				decls = append(decls, &pkgDecl{nil, nil, v, pos, skipDecl(), nil, nil})
+			}
+			continue
+		}
+
+		if consume(";") {
+			continue
+		}
+
+		errorAt(peekPos(), "non-declaration statement outside function body")
+	}
+
+	// Parse constants which are not used yet to report errors in them.
+	for _, g := range lazyDecls {
+		parseLazyDecl(g)
+	}
+
+	fileScope := scope
+	for _, d := range decls {
+		tokens = d.body
+		tmpRefs = make([]interface{}, 0)
+		if d.fn != nil {
+			funcBody(d.fn, d.fnScope)
+			funcRefs[d.fn] = tmpRefs
+			continue
+		}
+		scope = fileScope
+		if d.v.name == "_" {
+			d.stmt = &Assign{[]Expr{&Blank{d.v.ty, d.v.pos}}, []Expr{expr()}, d.assignAt}
+		} else {
+			d.stmt = assign(d.v, d.assignAt)
+		}
+		endDecl()
+		d.refs = tmpRefs
+	}
+	scope = fileScope
+
+	preStmts := initOrder(decls)
+	ty := newLiteralType("int64")
+	preStmts = append(preStmts, &Return{[]Expr{&IntLit{big.NewInt(0), &ty, eofPos}}, eofPos})
+	funcs[0].stmts = preStmts
+	return Program{globals, contents, funcs}, pkgName
+}
+
+// findLazyDecls finds package-level const declarations and type specs
+// and saves them to parse later.
+func findLazyDecls() []*lazyDecl {
+	decls := make([]*lazyDecl, 0)
+	add := func(g *lazyDecl) {
+		for _, name := range g.names {
+			if name.str != "_" {
+				pendingDecls[name.str] = g
+			}
+		}
+		decls = append(decls, g)
+	}
+
+	start := tokens
+	depth := 0
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		if tok.kind != TK_RESERVED {
+			continue
+		}
+		switch tok.str {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case "const":
+			if depth > 0 {
+				continue
+			}
+			g := &lazyDecl{nil, nil, false, false, false, peekPos()}
+			g.tokens = skipDecl()
+			g.names = specNames(g.tokens)
+			add(g)
+		case "type":
+			if depth > 0 {
+				continue
+			}
+			// Each TypeSpec in a group is parsed separately since types
+			// can refer to each other.
+			group := consume("(")
+			for len(tokens) > 0 {
+				if group && consume(";") {
+					continue
+				}
+				if group && consume(")") {
+					break
+				}
+				g := &lazyDecl{nil, nil, true, false, false, peekPos()}
+				g.tokens = skipSpec()
+				g.names = specNames(g.tokens)
+				if len(g.names) > 1 {
+					g.names = g.names[:1]
+				}
+				add(g)
+				if !group {
+					break
+				}
+			}
+		}
+	}
+	tokens = start
+	return decls
+}
+
+// skipSpec skips a spec in a declaration up to `;` or the `)` closing the
+// declaration and returns the skipped tokens.
+func skipSpec() []Token {
+	start := tokens
+	depth := 0
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		if tok.kind == TK_RESERVED {
+			switch tok.str {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth == 0 {
+					return start[:len(start)-len(tokens)]
+				}
+				depth--
+			case ";":
+				if depth == 0 {
+					tokens = tokens[1:]
+					return start[:len(start)-len(tokens)]
+				}
+			}
+		}
+		tokens = tokens[1:]
+	}
+	return start
+}
+
+// skipDecl skips the rest of a declaration up to and including `;` and
+// returns the skipped tokens. A declaration in parentheses or braces may
+// contain `;`.
+func skipDecl() []Token {
+	start := tokens
+	depth := 0
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		if tok.kind == TK_RESERVED {
+			switch tok.str {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			case ";":
+				if depth == 0 {
+					tokens = tokens[1:]
+					return start[:len(start)-len(tokens)]
+				}
+			}
+		}
+		tokens = tokens[1:]
+	}
+	return start
+}
+
+// skipBlock skips a block in braces and returns the skipped tokens.
+func skipBlock() []Token {
+	start := tokens
+	depth := 0
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		if tok.kind != TK_RESERVED {
+			continue
+		}
+		if tok.str == "{" {
+			depth++
+		} else if tok.str == "}" {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	return start[:len(start)-len(tokens)]
+}
+
+// specNames returns the names declared by the tokens of a ConstDecl or
+// TypeSpec.
+func specNames(toks []Token) []Token {
+	names := make([]Token, 0)
+	group := len(toks) > 0 && isOp(toks[0], "(")
+	depth := 0
+	// States in an IdentifierList at the start of each spec.
+	const (
+		expectName = iota
+		afterName
+		outside
+	)
+	state := expectName
+	for _, tok := range toks {
+		top := depth == 1 || !group && depth == 0
+		switch {
+		case state == expectName && top && tok.kind == TK_IDENT:
+			names = append(names, tok)
+			state = afterName
+			continue
+		case state == afterName && isOp(tok, ","):
+			state = expectName
+			continue
+		}
+		state = outside
+		if tok.kind != TK_RESERVED {
+			continue
+		}
+		switch tok.str {
+		case "(", "[", "{":
+			depth++
+			if group && depth == 1 {
+				state = expectName
+			}
+		case ")", "]", "}":
+			depth--
+		case ";":
+			if top {
+				state = expectName
+			}
+		}
+	}
+	return names
+}
+
+// Package-level variables and functions referred to by each function.
+var funcRefs = map[*Function][]interface{}{}
+
+// initOrder returns the initializers of package-level variables in the
+// order to execute. A variable is initialized after the variables that
+// its initializer refers to directly or through functions.
+func initOrder(decls []*pkgDecl) []Stmt {
+	inits := map[*Var]*pkgDecl{}
+	for _, d := range decls {
+		if d.v != nil && d.v.name != "_" {
+			inits[d.v] = d
+		}
+	}
+
+	stmts := make([]Stmt, 0)
+	done := map[*pkgDecl]bool{}
+	visiting := map[*pkgDecl]bool{}
+	var visit func(d *pkgDecl)
+	visit = func(d *pkgDecl) {
+		if done[d] {
+			return
+		}
+		if visiting[d] {
+			errorAt(d.v.pos, "initialization cycle for %s", d.v.name)
+		}
+		visiting[d] = true
+		for _, v := range varDeps(d.refs, map[*Function]bool{}) {
+			if dep := inits[v]; dep != nil {
+				visit(dep)
+			}
+		}
+		visiting[d] = false
+		done[d] = true
+		stmts = append(stmts, d.stmt)
+	}
+	for _, d := range decls {
+		if d.v != nil {
+			visit(d)
+		}
+	}
+	return stmts
+}
+
+// varDeps returns the package-level variables in refs, including the ones
+// referred to by functions in refs.
+func varDeps(refs []interface{}, seen map[*Function]bool) []*Var {
+	vars := make([]*Var, 0)
+	for _, r := range refs {
+		switch obj := r.(type) {
+		case *Var:
+			vars = append(vars, obj)
+		case *Function:
+			if !seen[obj] {
+				seen[obj] = true
+				vars = append(vars, varDeps(funcRefs[obj], seen)...)
+			}
+		}
+	}
+	return vars
+}
+
+// FunctionDecl = "func" FunctionName Signature [ FunctionBody ] .
+// MethodDecl   = "func" Receiver MethodName Signature [ FunctionBody ] .
+// Receiver     = Parameters .
+//
+// funcDecl parses the signature of a function or a method and declares
+// it. The body is parsed later by funcBody.
+func funcDecl() *pkgDecl {
+	// Parameters, results and the outermost declarations in the body are
+	// in the same scope.
+	enterScope()
+	fnScope := scope
+
+	var recv *Var
+	pos := peekPos()
+	if next("(") {
+		recvs := funcParams()
+		if len(recvs) == 0 {
+			errorAt(pos, "method has no receiver")
+		}
+		if len(recvs) > 1 {
+			errorAt(recvs[1].pos, "method has multiple receivers")
+		}
+		recv = recvs[0]
+	}
+
+	tok := consumeToken(TK_IDENT)
+	if tok == nil {
+		errorAt(peekPos(), "expected an identifier after 'func' keyword but got %s", peekStr())
+	}
 
-		varp := findVar(v.name)
-		if varp != nil {
-			panic(fmt.Sprintf("%s is already declared. No new variables\n", v.name))
+	// Signature = Parameters [ Result ] .
+	locals := make([]*Var, 0)
+	params := funcParams()
+	if recv != nil {
+		// The receiver is passed as the first argument.
+		params = append([]*Var{recv}, params...)
+	}
+	for _, p := range params {
+		// Unnamed parameters still take their stack slots.
+		locals = append(locals, p)
+		if p.name != "" {
+			declare(p.name, p, p.pos)
 		}
+	}
+	results := funcResults()
+	for _, r := range results {
+		// Named results are local variables.
+		if r.name != "" {
+			locals = append(locals, r)
+			declare(r.name, r, r.pos)
+		}
+	}
+	leaveScope()
 
-		tmpLocals = append(tmpLocals, v)
+	fn := &Function{tok.str, recv, params, results, locals, nil, 0, false, tok.pos, nil}
+	if recv != nil {
+		declareMethod(fn, tok.str)
+	} else {
+		declarePkg(fn.name, fn, fn.pos)
+	}
+	funcs = append(funcs, fn)
+	if !next("{") {
+		// A function implemented outside Go such as in C.
+		fn.isExternal = true
+		return &pkgDecl{fn, fnScope, nil, tok.pos, nil, nil, nil}
+	}
+	return &pkgDecl{fn, fnScope, nil, tok.pos, skipBlock(), nil, nil}
+}
+
+// declareMethod adds the method fn named name to the method set of its
+// receiver base type, which must be a type declared in the package. The
+// name of fn is mangled so that methods of different types do not
+// collide.
+func declareMethod(fn *Function, name string) {
+	ty := fn.recv.ty
+	if ty.kind == TY_PTR && ty.base.name != "" {
+		ty = ty.base
+	}
+	if ty.name == "" {
+		if isNamed(ty) {
+			errorAt(fn.recv.pos, "cannot define new methods on non-local type %s", ty)
+		}
+		errorAt(fn.recv.pos, "invalid receiver type %s", fn.recv.ty)
+	}
+	if ty.kind == TY_PTR || ty.kind == TY_INTERFACE {
+		errorAt(fn.recv.pos, "invalid receiver type %s (pointer or interface type)", ty)
+	}
+	fn.name = ty.name + "." + name
+	if name == "_" {
+		return
+	}
+	if findMethod(ty, name) != nil {
+		errorAt(fn.pos, "method %s already declared", fn.name)
+	}
+	if ty.kind == TY_STRUCT && findField(ty, name) != nil {
+		errorAt(fn.pos, "field and method with the same name %s", name)
+	}
+	ty.methods = append(ty.methods, fn)
+	if fn.recv.ty.kind != TY_PTR {
+		ptrWrapper(fn)
+	}
+}
+
+// ptrWrapper adds a function `T.M.ptr` calling the method fn with a value
+// receiver of T through a pointer such as `func (p *T) M(a A) R { return
+// (*p).M(a) }`. Method tables of interfaces refer to it as interfaces hold
+// a pointer to the value.
+func ptrWrapper(fn *Function) {
+	pty := pointerTo(fn.recv.ty)
+	p := &Var{"", 0, true, &pty, fn.pos, nil}
+	params := []*Var{p}
+	args := []Expr{&Deref{p, fn.recv.ty, fn.pos}}
+	for _, q := range fn.params[1:] {
+		v := &Var{"", 0, true, q.ty, q.pos, nil}
+		params = append(params, v)
+		args = append(args, v)
+	}
+	results := make([]*Var, 0)
+	for _, r := range fn.results {
+		results = append(results, &Var{"", 0, true, r.ty, r.pos, nil})
+	}
+	nty := newNoneType()
+	call := &FuncCall{fn.name, args, nil, nil, 0, nil, &nty, fn.pos}
+	var body Stmt = &ExprStmt{call, fn.pos}
+	if len(results) > 0 {
+		body = &Return{[]Expr{call}, fn.pos}
+	}
+	funcs = append(funcs, &Function{fn.name + ".ptr", p, params, results, append([]*Var{}, params...), []Stmt{body}, 0, false, fn.pos, nil})
+}
+
+// funcBody parses the body of fn in its scope.
+func funcBody(fn *Function, fnScope *Scope) {
+	if fn.isExternal {
+		return
+	}
+	tmpLocals = fn.locals
+	tmpResults = fn.results
+	scope = fnScope
+	body := blockStmts()
+	if len(tokens) > 0 {
+		errorAt(peekPos(), "expected ; but got %s", peekStr())
+	}
+	checkLabels()
+	fn.locals = tmpLocals
+	fn.stmts = body.children
+}
+
+// assign parses the right-hand side of an assignment to `v`. pos is the
+// position of `=` or `:=`.
+func assign(v *Var, pos Pos) Stmt {
+	return &Assign{[]Expr{v}, []Expr{expr()}, pos}
+}
+
+// blankDecl parses the rest of a declaration of `_` such as
+// `var _ int64 = f()`. The value is evaluated and discarded.
+func blankDecl(v *Var) Stmt {
+	pos := peekPos()
+	if consume("=") {
+		return &Assign{[]Expr{&Blank{v.ty, v.pos}}, []Expr{expr()}, pos}
+	}
+	return &Empty{pos}
+}
+
+// Block = "{" StatementList "}" .
+// StatementList = { Statement ";" } .
+// block parses a block, which opens a new scope.
+func block() *Block {
+	enterScope()
+	b := blockStmts()
+	leaveScope()
+	return b
+}
+
+// blockStmts parses a block in the current scope.
+func blockStmts() *Block {
+	pos := peekPos()
+	assert("{")
+	stmts := make([]Stmt, 0)
+	for !consume("}") {
+		if len(tokens) == 0 {
+			errorAt(eofPos, "expected } but got EOF")
+		}
+		// Empty statements.
+		if consume(";") {
+			continue
+		}
+		stmts = append(stmts, stmt())
+	}
+	return &Block{stmts, pos}
+}
+
+func stmt() Stmt {
+	pos := peekPos()
+	label := nextLabel
+	nextLabel = ""
+
+	// Labeled statement.
+	if len(tokens) > 1 && tokens[0].kind == TK_IDENT && isOp(tokens[1], ":") {
+		return labeledStmt()
+	}
+
+	// Break, continue and goto statements.
+	if next("break") || next("continue") || next("goto") {
+		return branchStmt()
+	}
+	if next("fallthrough") {
+		errorAt(pos, "fallthrough statement out of place")
+	}
+
+	// Constant declaration.
+	if consume("const") {
+		constDecl()
+		return &Empty{pos}
+	}
+
+	// Type declaration.
+	if consume("type") {
+		typeDecl()
+		return &Empty{pos}
+	}
+
+	// Var declaration.
+	if consume("var") {
+		v := varSpec()
+		if v.name == "_" {
+			return blankDecl(v)
+		}
 
+		// The scope of a variable begins after its declaration.
+		tmpLocals = append(tmpLocals, v)
+		pos := peekPos()
 		if consume("=") {
-			return assign(v)
+			s := assign(v, pos)
+			declare(v.name, v, v.pos)
+			return &Block{[]Stmt{&VarDecl{v, true, pos}, s}, pos}
 		}
-		// Return Empty struct because of no assignment.
-		return &Empty{}
+		declare(v.name, v, v.pos)
+		return &VarDecl{v, false, pos}
 	}
 
 	// Return statement.
 	if consume("return") {
-		return &Return{expr()}
+		if next(";") || next("}") {
+			// Return the current values of named results.
+			children := make([]Expr, 0)
+			for _, r := range tmpResults {
+				if r.name != "" {
+					children = append(children, r)
+				}
+			}
+			return &Return{children, pos}
+		}
+		return &Return{exprList(), pos}
 	}
 
 	// Block.
-	if consume("{") {
-		stmts := make([]Stmt, 0)
-		for !consume("}") {
-			stmts = append(stmts, stmt())
-		}
-		return &Block{stmts}
+	if next("{") {
+		return block()
 	}
 
 	// If statement.
 	if consume("if") {
+		// Variables declared in the header are visible in all branches.
+		enterScope()
 		init, cond := ifHeaders()
-		ifstmt := If{init, cond, nil, nil}
-		if next("{") {
-			ifstmt.then = stmt()
-		} else {
-			assert("{")
-		}
+		ifstmt := If{init, cond, block(), nil, pos}
 		if consume("else") {
 			if next("if") || next("{") {
 				ifstmt.els = stmt()
 			} else {
-				assert("if / {")
+				errorAt(peekPos(), "else must be followed by if or statement block")
 			}
 		}
+		leaveScope()
 		return &ifstmt
 	}
 
 	// For statement.
 	if consume("for") {
+		enterScope()
+		if isRangeClause() {
+			r := rangeClause(pos)
+			enterTarget(label, r)
+			r.then = block()
+			leaveTarget()
+			leaveScope()
+			return r
+		}
 		init, cond, post := forHeaders()
-		return &For{init, cond, post, stmt()}
+		forstmt := &For{init, cond, post, nil, nil, false, 0, pos}
+		if b, ok := init.(*Block); ok {
+			for _, c := range b.children {
+				if d, ok := c.(*VarDecl); ok {
+					forstmt.vars = append(forstmt.vars, d.v)
+				}
+			}
+		}
+		enterTarget(label, forstmt)
+		forstmt.then = block()
+		leaveTarget()
+		leaveScope()
+		return forstmt
+	}
+
+	// Switch statement.
+	if consume("switch") {
+		enterScope()
+		sw := switchHeaders(pos)
+		enterTarget(label, sw)
+		sw.cases = caseClauses(sw)
+		leaveTarget()
+		leaveScope()
+		return sw
 	}
 
-	return simpleStmt(expr())
+	return simpleStmt()
+}
+
+// Labels and jumps in the current function. A label is resolved when the
+// function body is parsed as it may be declared after goto statements.
+var (
+	labels    []*label
+	gotos     []*gotoStmt
+	targets   []target // The enclosing loops and switches from the outermost.
+	nextLabel string   // The label of the statement parsed next.
+)
+
+// label is a label declared in a function body.
+type label struct {
+	stmt  *Labeled
+	scope *Scope
+	nvars int // The number of variables in scope before the label.
+	used  bool
+}
+
+// gotoStmt is a goto statement with the numbers of variables declared in
+// the enclosing scopes from the innermost.
+type gotoStmt struct {
+	b      *Branch
+	pos    Pos // The position of the label.
+	scopes []*Scope
+	nvars  []int
+}
+
+// target is a loop or a switch that break or continue refers to.
+type target struct {
+	label string
+	stmt  Stmt
+}
+
+func enterTarget(label string, s Stmt) {
+	targets = append(targets, target{label, s})
+}
+
+func leaveTarget() {
+	targets = targets[:len(targets)-1]
 }
 
-func simpleStmt(exprN Expr) Stmt {
-	switch exprN.(type) {
-	case *Empty:
-		return &Empty{}
+// LabeledStmt = Label ":" Statement .
+func labeledStmt() Stmt {
+	tok := consumeToken(TK_IDENT)
+	assert(":")
+	for _, l := range labels {
+		if l.stmt.name == tok.str {
+			errorAt(tok.pos, "label %s already declared", tok.str)
+		}
 	}
+	l := &Labeled{tok.str, nil, tok.pos}
+	labels = append(labels, &label{l, scope, len(scope.vars), false})
+	if next("}") {
+		l.stmt = &Empty{tok.pos}
+		return l
+	}
+	nextLabel = tok.str
+	l.stmt = stmt()
+	return l
+}
 
-	// Identifier declaration.
-	if consume(":=") {
-		v := exprN.(*Var)
+// BreakStmt = "break" [ Label ] .
+// ContinueStmt = "continue" [ Label ] .
+// GotoStmt = "goto" Label .
+// break refers to the innermost loop or switch, and continue to the
+// innermost loop, unless they have a label.
+func branchStmt() Stmt {
+	pos := peekPos()
+	b := &Branch{tokens[0].str, "", nil, pos}
+	tokens = tokens[1:]
+	tok := consumeToken(TK_IDENT)
+	if tok != nil {
+		b.label = tok.str
+	}
+	if b.tok == "goto" {
+		if tok == nil {
+			errorAt(peekPos(), "expected label but got %s", peekStr())
+		}
+		g := &gotoStmt{b, tok.pos, nil, nil}
+		for s := scope; s != nil; s = s.outer {
+			g.scopes = append(g.scopes, s)
+			g.nvars = append(g.nvars, len(s.vars))
+		}
+		gotos = append(gotos, g)
+		return b
+	}
 
-		varp := findVar(v.name)
-		if varp != nil {
-			panic(fmt.Sprintf("%s is already declared. No new variables on left side of := \n", v.name))
+	for i := len(targets) - 1; i >= 0; i-- {
+		if tok != nil && targets[i].label != tok.str {
+			continue
+		}
+		// continue refers to a loop, not a switch.
+		if _, ok := targets[i].stmt.(*Switch); ok && b.tok == "continue" {
+			if tok != nil {
+				errorAt(tok.pos, "invalid continue label %s", tok.str)
+			}
+			continue
+		}
+		b.target = targets[i].stmt
+		break
+	}
+	switch {
+	case b.target == nil && tok != nil:
+		errorAt(tok.pos, "invalid %s label %s", b.tok, tok.str)
+	case b.target == nil && b.tok == "break":
+		errorAt(pos, "break is not in a loop, switch, or select")
+	case b.target == nil:
+		errorAt(pos, "continue is not in a loop")
+	}
+	for _, l := range labels {
+		if l.stmt.name == b.label {
+			l.used = true
+		}
+	}
+	if b.tok == "break" {
+		switch t := b.target.(type) {
+		case *For:
+			t.brk = true
+		case *Switch:
+			t.brk = true
 		}
+	}
+	return b
+}
 
-		tmpLocals = append(tmpLocals, v)
-		return assign(v)
+// checkLabels resolves goto statements and reports unused labels in a
+// function body. A goto must not jump into a block or over variable
+// declarations.
+func checkLabels() {
+	for _, g := range gotos {
+		var l *label
+		for _, l2 := range labels {
+			if l2.stmt.name == g.b.label {
+				l = l2
+			}
+		}
+		if l == nil {
+			errorAt(g.pos, "label %s not declared", g.b.label)
+		}
+		l.used = true
+		i := 0
+		for i < len(g.scopes) && g.scopes[i] != l.scope {
+			i++
+		}
+		if i == len(g.scopes) {
+			errorAt(g.pos, "goto %s jumps into block", g.b.label)
+		}
+		if l.nvars > g.nvars[i] {
+			errorAt(g.pos, "goto %s jumps over variable declaration at line %d", g.b.label, l.scope.vars[g.nvars[i]].line)
+		}
+	}
+	for _, l := range labels {
+		if !l.used {
+			errorAt(l.stmt.pos, "label %s declared and not used", l.stmt.name)
+		}
+	}
+	labels = nil
+	gotos = nil
+}
+
+// SimpleStmt = EmptyStmt | ExpressionStmt | IncDecStmt | Assignment | ShortVarDecl .
+func simpleStmt() Stmt {
+	if isShortVarDecl() {
+		return shortVarDecl()
+	}
+
+	lhs := exprList()
+	pos := peekPos()
+	if consume(":=") {
+		for _, e := range lhs {
+			if _, ok := e.(*Var); !ok {
+				errorAt(e.getPos(), "non-name on left side of :=")
+			}
+		}
 	}
 
 	// Assignment statement.
 	if consume("=") {
-		switch v := exprN.(type) {
-		case *Var:
-			varp := findVar(v.name)
-			if varp == nil {
-				panic(fmt.Sprintf("undefined: %s\n", v.name))
+		return &Assign{lhs, exprList(), pos}
+	}
+
+	if len(lhs) > 1 {
+		errorAt(pos, "expected := or = or comma but got %s", peekStr())
+	}
+	exprN := lhs[0]
+
+	// IncDec statement.
+	if consume("++") {
+		return &OpAssign{"+", exprN, &IntLit{big.NewInt(1), untypedType(TY_UNTYPED_INT), pos}, pos}
+	}
+	if consume("--") {
+		return &OpAssign{"-", exprN, &IntLit{big.NewInt(1), untypedType(TY_UNTYPED_INT), pos}, pos}
+	}
+
+	// Assignment operation.
+	switch op := peekStr(); op {
+	case "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<=", ">>=", "&^=":
+		tokens = tokens[1:]
+		return &OpAssign{op[:len(op)-1], exprN, expr(), pos}
+	}
+
+	// Expression statement.
+	return &ExprStmt{exprN, exprN.getPos()}
+}
+
+// isShortVarDecl reports whether the next tokens are `IdentifierList :=`.
+func isShortVarDecl() bool {
+	for i := 0; i+1 < len(tokens); i += 2 {
+		if tokens[i].kind != TK_IDENT {
+			return false
+		}
+		if isOp(tokens[i+1], ":=") {
+			return true
+		}
+		if !isOp(tokens[i+1], ",") {
+			return false
+		}
+	}
+	return false
+}
+
+// ShortVarDecl = IdentifierList ":=" ExpressionList .
+// At least one of the variables on the left must be new in the current
+// scope. The others are assigned. New variables are visible after the
+// declaration, so `x := x` refers to the outer `x` on the right side.
+func shortVarDecl() Stmt {
+	lvals := make([]Expr, 0)
+	newVars := make([]*Var, 0)
+	for !next(":=") {
+		tok := consumeToken(TK_IDENT)
+		consume(",")
+		if tok.str == "_" {
+			ty := newNoneType()
+			lvals = append(lvals, &Blank{&ty, tok.pos})
+			continue
+		}
+		for _, l := range lvals {
+			if v, ok := l.(*Var); ok && v.name == tok.str {
+				errorAt(tok.pos, "%s repeated on left side of :=", tok.str)
+			}
+		}
+		if obj, ok := scope.names[tok.str]; ok {
+			v, ok := obj.(*Var)
+			if !ok {
+				errorAt(tok.pos, "cannot assign to %s", tok.str)
 			}
+			lvals = append(lvals, v)
+			continue
 		}
-		return &Assign{[]Expr{exprN}, []Expr{expr()}}
+		ty := newNoneType()
+		v := &Var{tok.str, 0, true, &ty, tok.pos, nil}
+		lvals = append(lvals, v)
+		newVars = append(newVars, v)
+	}
+	pos := peekPos()
+	assert(":=")
+	if len(newVars) == 0 {
+		errorAt(pos, "no new variables on left side of :=")
 	}
 
-	// Expression statement.
-	return &ExprStmt{exprN}
+	stmts := make([]Stmt, 0)
+	for _, v := range newVars {
+		stmts = append(stmts, &VarDecl{v, true, pos})
+	}
+	if len(lvals) == 1 {
+		stmts = append(stmts, assign(newVars[0], pos))
+	} else {
+		stmts = append(stmts, &Assign{lvals, exprList(), pos})
+	}
+	for _, v := range newVars {
+		tmpLocals = append(tmpLocals, v)
+		declare(v.name, v, v.pos)
+	}
+	return &Block{stmts, pos}
 }
 
 func exprList() []Expr {
@@ -566,22 +2813,51 @@ func exprList() []Expr {
 	return exprs
 }
 
+// Expression = UnaryExpr | Expression binary_op Expression .
+// binary_op  = "||" | "&&" | rel_op | add_op | mul_op .
 func expr() Expr {
-	if consume(";") {
-		return &Empty{}
+	return logOr()
+}
+
+// newBinary returns `lhs op rhs`. It is evaluated at compile time if both
+// operands are constants.
+func newBinary(op string, lhs Expr, rhs Expr, ty *Type, pos Pos) Expr {
+	l, lok := lhs.(*IntLit)
+	r, rok := rhs.(*IntLit)
+	if lok && rok {
+		return foldBinary(op, l, r, pos)
+	}
+	ls, lok := lhs.(*StringLit)
+	rs, rok := rhs.(*StringLit)
+	if lok && rok {
+		return foldString(op, ls, rs, pos)
 	}
-	return equality()
+	return &Binary{op, lhs, rhs, ty, pos}
 }
 
-func equality() Expr {
+func logOr() Expr {
+	exprN := logAnd()
+
+	ty := newLiteralType("bool")
+	for len(tokens) > 0 {
+		pos := peekPos()
+		if consume("||") {
+			exprN = newBinary("||", exprN, logAnd(), &ty, pos)
+		} else {
+			return exprN
+		}
+	}
+	return exprN
+}
+
+func logAnd() Expr {
 	exprN := relational()
 
 	ty := newLiteralType("bool")
 	for len(tokens) > 0 {
-		if consume("==") {
-			exprN = &Binary{"==", exprN, relational(), &ty}
-		} else if consume("!=") {
-			exprN = &Binary{"!=", exprN, relational(), &ty}
+		pos := peekPos()
+		if consume("&&") {
+			exprN = newBinary("&&", exprN, relational(), &ty, pos)
 		} else {
 			return exprN
 		}
@@ -589,84 +2865,161 @@ func equality() Expr {
 	return exprN
 }
 
+// rel_op = "==" | "!=" | "<" | "<=" | ">" | ">=" .
 func relational() Expr {
 	exprN := add()
 
 	ty := newLiteralType("bool")
 	for len(tokens) > 0 {
-		if consume("<") {
-			exprN = &Binary{"<", exprN, add(), &ty}
-		} else if consume("<=") {
-			exprN = &Binary{"<=", exprN, add(), &ty}
-		} else if consume(">") {
-			exprN = &Binary{"<", add(), exprN, &ty}
-		} else if consume(">=") {
-			exprN = &Binary{"<=", add(), exprN, &ty}
-		} else {
+		pos := peekPos()
+		op := peekStr()
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+			tokens = tokens[1:]
+			exprN = newBinary(op, exprN, add(), &ty, pos)
+		default:
 			return exprN
 		}
 	}
 	return exprN
 }
 
+// add_op = "+" | "-" | "|" | "^" .
 func add() Expr {
 	exprN := mul()
 
-	ty := newNoneType()
 	for len(tokens) > 0 {
-		if consume("+") {
-			exprN = &Binary{"+", exprN, mul(), &ty}
-		} else if consume("-") {
-			exprN = &Binary{"-", exprN, mul(), &ty}
-		} else {
+		pos := peekPos()
+		op := peekStr()
+		switch op {
+		case "+", "-", "|", "^":
+			tokens = tokens[1:]
+			ty := newNoneType()
+			exprN = newBinary(op, exprN, mul(), &ty, pos)
+		default:
 			return exprN
 		}
 	}
 	return exprN
 }
 
+// mul_op = "*" | "/" | "%" | "<<" | ">>" | "&" | "&^" .
 func mul() Expr {
 	exprN := unary()
 
-	ty := newNoneType()
 	for len(tokens) > 0 {
-		if consume("*") {
-			exprN = &Binary{"*", exprN, unary(), &ty}
-		} else if consume("/") {
-			exprN = &Binary{"/", exprN, unary(), &ty}
-		} else {
+		pos := peekPos()
+		op := peekStr()
+		switch op {
+		case "*", "/", "%", "<<", ">>", "&", "&^":
+			tokens = tokens[1:]
+			ty := newNoneType()
+			exprN = newBinary(op, exprN, unary(), &ty, pos)
+		default:
 			return exprN
 		}
 	}
 	return exprN
 }
 
+// unary_op = "+" | "-" | "!" | "^" | "*" | "&" .
 func unary() Expr {
+	pos := peekPos()
 	nty := newNoneType()
 	if consume("+") {
 		return unary()
 	} else if consume("-") {
-		// -val = 0 - val
-		ity := newLiteralType("int64")
-		return &Binary{"-", &IntLit{0, &ity}, unary(), &nty}
+		// -val = 0 - val. 0 takes the type of val.
+		return newBinary("-", &IntLit{big.NewInt(0), untypedType(TY_UNTYPED_INT), pos}, unary(), &nty, pos)
+	} else if consume("!") {
+		child := unary()
+		if c, ok := child.(*IntLit); ok && (c.ty.kind == TY_BOOL || c.ty.kind == TY_UNTYPED_BOOL) {
+			return newBoolConst(c.val.Sign() == 0, c.ty, pos)
+		}
+		bty := newLiteralType("bool")
+		return &Not{child, &bty, pos}
+	} else if consume("^") {
+		child := unary()
+		if c, ok := child.(*IntLit); ok {
+			return foldBitNot(c, pos)
+		}
+		return &BitNot{child, &nty, pos}
 	} else if consume("&") {
-		return &Addr{unary(), &nty}
+		child := unary()
+		if lit, ok := child.(*CompositeLit); ok {
+			// The struct outlives the function.
+			lit.heap = true
+		}
+		return &Addr{child, &nty, pos}
 	} else if consume("*") {
-		return &Deref{unary(), &nty}
+		return &Deref{unary(), &nty, pos}
 	}
 	return arrayref()
 }
 
 func readVarSuffix(base Expr) Expr {
+	pos := peekPos()
+	ty := newNoneType()
+	if consume(".") {
+		if consume("(") {
+			if next("type") {
+				if !guardOk {
+					errorAt(peekPos(), "use of .(type) outside type switch")
+				}
+				guardOk = false
+				tokens = tokens[1:]
+				assert(")")
+				return &TypeAssert{base, nil, pos}
+			}
+			ty := readType()
+			if ty == nil {
+				errorAt(peekPos(), "expected type but got %s", peekStr())
+			}
+			assert(")")
+			return readVarSuffix(&TypeAssert{base, ty, pos})
+		}
+		tok := consumeToken(TK_IDENT)
+		if tok == nil {
+			errorAt(peekPos(), "expected field name but got %s", peekStr())
+		}
+		return readVarSuffix(&Selector{base, tok.str, nil, nil, nil, &ty, tok.pos})
+	}
+	if consume("(") {
+		return readVarSuffix(&FuncCall{"", funcArgs(), base, nil, 0, nil, &ty, base.getPos()})
+	}
 	if !consume("[") {
 		return base
 	}
 
-	// only supports a fixed array.
-	n := expr()
+	saved := noLit
+	noLit = false
+	var low Expr
+	if !next(":") {
+		low = expr()
+	}
+	if !consume(":") {
+		assert("]")
+		noLit = saved
+		return readVarSuffix(&ArrayRef{base, low, &ty, pos})
+	}
+
+	// Slice expression.
+	var high, max Expr
+	if !next("]") && !next(":") {
+		high = expr()
+	}
+	if consume(":") {
+		if high == nil {
+			errorAt(peekPos(), "middle index required in 3-index slice")
+		}
+		if next("]") {
+			errorAt(peekPos(), "final index required in 3-index slice")
+		}
+		max = expr()
+	}
 	assert("]")
-	ty := newNoneType()
-	return readVarSuffix(&ArrayRef{base, n, &ty})
+	noLit = saved
+	return readVarSuffix(&SliceExpr{base, low, high, max, &ty, pos})
 }
 
 func arrayref() Expr {
@@ -676,59 +3029,168 @@ func arrayref() Expr {
 
 // Operand = Literal | OperandName | "(" Expression ")" .
 func operand() Expr {
+	// A parenthesized pointer type such as `(*T).M` or `(*T)(p)`.
+	if next("(") && isPointerType(tokens[1:]) {
+		pos := peekPos()
+		consume("(")
+		ty := readType()
+		assert(")")
+		if consume(".") {
+			return methodExpr(ty, pos)
+		}
+		if consume("(") {
+			return conversion(ty, pos)
+		}
+		errorAt(pos, "%s (type) is not an expression", ty)
+	}
+
 	// "(" Expression ")".
 	if consume("(") {
+		saved := noLit
+		noLit = false
 		exprN := expr()
+		noLit = saved
 		assert(")")
 		return exprN
 	}
 
+	// Literal of an anonymous struct, an array, a slice or a map, or a
+	// conversion to a type literal such as `[]byte(s)`.
+	if next("struct") || next("[") || next("map") || next("interface") {
+		pos := peekPos()
+		ty := readType()
+		if consume("(") {
+			return conversion(ty, pos)
+		}
+		return compositeLit(ty, pos)
+	}
+
 	// OperandName = identifier.
 	tok := consumeToken(TK_IDENT)
 	if tok != nil {
 		nty := newNoneType()
 		// Function call.
 		if consume("(") {
-			return &FuncCall{tok.str, funcArgs(), &nty}
+			switch obj := lookup(tok.str).(type) {
+			case *Var:
+				// A function value.
+				if !obj.isLocal {
+					addRef(obj)
+				}
+				return &FuncCall{"", funcArgs(), obj, nil, 0, nil, &nty, tok.pos}
+			case *Function:
+				addRef(obj)
+			case *TypeName:
+				return conversion(obj.ty, tok.pos)
+			case *Builtin:
+				return builtinCall(obj, tok.pos)
+			case nil:
+				errorAt(tok.pos, "undefined: %s", tok.str)
+			default:
+				errorAt(tok.pos, "cannot call non-function %s", tok.str)
+			}
+			return &FuncCall{tok.str, funcArgs(), nil, nil, 0, nil, &nty, tok.pos}
 		}
 
-		// Variable.
-		// Not register to `tmpLocals` yet.
-		varp := findVar(tok.str)
+		if tok.str == "_" {
+			return &Blank{&nty, tok.pos}
+		}
 
-		// Normal variable.
-		if varp == nil {
-			a := Var{tok.str, 0, true, &nty}
-			return &a
+		switch obj := lookup(tok.str).(type) {
+		case *Var:
+			if !obj.isLocal {
+				addRef(obj)
+			}
+			return obj
+		case *Constant:
+			if obj == iotaConst {
+				if iotaVal < 0 {
+					errorAt(tok.pos, "cannot use iota outside constant declaration")
+				}
+				return &IntLit{big.NewInt(int64(iotaVal)), untypedType(TY_UNTYPED_INT), tok.pos}
+			}
+			return constValue(obj, tok.pos)
+		case *Nil:
+			return &Nil{obj.ty, tok.pos}
+		case *TypeName:
+			if next("{") && !noLit {
+				return compositeLit(obj.ty, tok.pos)
+			}
+			if consume(".") {
+				return methodExpr(obj.ty, tok.pos)
+			}
+			errorAt(tok.pos, "%s (type) is not an expression", tok.str)
+		case *Function:
+			addRef(obj)
+			return &FuncName{obj, &nty, tok.pos}
+		case *Builtin:
+			errorAt(tok.pos, "%s (built-in function %s) must be called", tok.str, tok.str)
 		}
-		return varp
+
+		errorAt(tok.pos, "undefined: %s", tok.str)
 	}
 	return literal()
 }
 
+// isPointerType reports whether toks start with a pointer to a type name
+// followed by `)`, which cannot be an expression.
+func isPointerType(toks []Token) bool {
+	n := 0
+	for n < len(toks) && toks[n].kind == TK_RESERVED && toks[n].str == "*" {
+		n++
+	}
+	if n == 0 || n+1 >= len(toks) || toks[n].kind != TK_IDENT || toks[n+1].str != ")" {
+		return false
+	}
+	_, ok := lookup(toks[n].str).(*TypeName)
+	return ok
+}
+
+// methodExpr parses the method name of a method expression on recv. `.`
+// has been already consumed.
+func methodExpr(recv *Type, pos Pos) Expr {
+	tok := consumeToken(TK_IDENT)
+	if tok == nil {
+		errorAt(peekPos(), "expected method name but got %s", peekStr())
+	}
+	m := methodOf(recv, tok.str)
+	if m == nil {
+		errorAt(tok.pos, "%s.%s undefined (type %s has no method %s)", recv, tok.str, recv, tok.str)
+	}
+	if m.recv != nil && m.recv.ty.kind == TY_PTR && recv.kind != TY_PTR {
+		errorAt(tok.pos, "invalid method expression %s.%s (needs pointer receiver (*%s).%s)", recv, tok.str, recv, tok.str)
+	}
+	addRef(m)
+	nty := newNoneType()
+	return &MethodExpr{recv, m, nil, &nty, pos}
+}
+
 func literal() Expr {
+	pos := peekPos()
+
 	// String literal.
-	if consume("\"") {
+	tok := consumeToken(TK_STRING)
+	if tok != nil {
 		ty := newLiteralType("string")
-		n := StringLit{tokens[0].str, newLabel(), &ty}
+		n := StringLit{tok.str, newLabel(), &ty, false, pos}
 		contents = append(contents, &n)
-		tokens = tokens[1:]
-		assert("\"")
 		return &n
 	}
 
-	// Character (int32).
-	if consume("'") {
-		ty := newLiteralType("int32")
-		n := IntLit{tokens[0].val, &ty}
-		tokens = tokens[1:]
-		assert("'")
-		return &n
+	// Rune literal.
+	tok = consumeToken(TK_CHAR)
+	if tok != nil {
+		return &IntLit{big.NewInt(int64(tok.val)), untypedType(TY_UNTYPED_RUNE), pos}
 	}
 
 	// Integer literal.
-	ty := newLiteralType("int64")
-	n := IntLit{tokens[0].val, &ty}
-	tokens = tokens[1:]
-	return &n
+	tok = consumeToken(TK_NUM)
+	if tok == nil {
+		errorAt(pos, "expected expression but got %s", peekStr())
+	}
+	v, ok := new(big.Int).SetString(tok.str, 0)
+	if !ok {
+		errorAt(pos, "invalid integer literal %s", tok.str)
+	}
+	return &IntLit{v, untypedType(TY_UNTYPED_INT), pos}
 }
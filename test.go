@@ -8,28 +8,35 @@ func assert(expected int, actual int, code string) {
 	}
 }
 
-// TODO: add return type
-func ret3() {
+func assertBool(expected int, actual bool, code string) {
+	if actual == (expected == 1) {
+		println("ok")
+	} else {
+		println(code)
+	}
+}
+
+func ret3() int {
 	return 3
 }
 
-func ret5() {
+func ret5() int {
 	return 5
 }
 
-func add(x int, y int) {
+func add(x int, y int) int {
 	return x + y
 }
 
-func sub(x int, y int) {
+func sub(x int, y int) int {
 	return x - y
 }
 
-func add6(a int, b int, c int, d int, e int, f int) {
+func add6(a int, b int, c int, d int, e int, f int) int {
 	return a + b + c + d + e + f
 }
 
-func fib(x int) {
+func fib(x int) int {
 	if x <= 1 {
 		return 1
 	}
@@ -50,23 +57,23 @@ func main() {
 	assert(10, - -+10, "- - +10")
 
 	println("equality operators")
-	assert(0, 0 == 1, "0==1")
-	assert(1, 42 == 42, "42==42")
-	assert(1, 0 != 1, "0!=1")
-	assert(0, 42 != 42, "42!=42")
+	assertBool(0, 0 == 1, "0==1")
+	assertBool(1, 42 == 42, "42==42")
+	assertBool(1, 0 != 1, "0!=1")
+	assertBool(0, 42 != 42, "42!=42")
 
 	println("relational operators")
-	assert(1, 0 < 1, "0<1")
-	assert(0, 1 < 1, "1<1")
-	assert(0, 2 < 1, "2<1")
-	assert(1, 0 <= 1, "0<=1")
-	assert(1, 1 <= 1, "1<=1")
-	assert(0, 2 <= 1, "2<=1")
+	assertBool(1, 0 < 1, "0<1")
+	assertBool(0, 1 < 1, "1<1")
+	assertBool(0, 2 < 1, "2<1")
+	assertBool(1, 0 <= 1, "0<=1")
+	assertBool(1, 1 <= 1, "1<=1")
+	assertBool(0, 2 <= 1, "2<=1")
 
-	assert(1, 1 > 0, "1>0")
-	assert(0, 1 > 1, "1>1")
-	assert(0, 1 > 2, "1>2")
-	assert(1, 1 >= 0, "1>=0")
-	assert(1, 1 >= 1, "1>=1")
-	assert(0, 1 >= 2, "1>=2")
+	assertBool(1, 1 > 0, "1>0")
+	assertBool(0, 1 > 1, "1>1")
+	assertBool(0, 1 > 2, "1>2")
+	assertBool(1, 1 >= 0, "1>=0")
+	assertBool(1, 1 >= 1, "1>=1")
+	assertBool(0, 1 >= 2, "1>=2")
 }
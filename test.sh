@@ -1,3 +1,5 @@
+# C functions called by tests declaring them without bodies, such as
+# `func add(x, y int32) int32`.
 cat <<EOF | gcc -xc -c -o tmp2.o -
 int ret3() { return 3; }
 int ret5() { return 5; }
@@ -26,6 +28,22 @@ assert() {
   fi
 }
 
+# assertError checks that compiling input fails with the expected message.
+assertError() {
+  expected="$1"
+  input="$2"
+
+  go build -o minigo main.go tokenize.go parse.go codegen.go type.go debug.go
+  actual=$(./minigo -in "$input" 2>&1 >/dev/null | head -1)
+
+  if [ "$actual" = "$expected" ]; then
+    echo "$input => $actual"
+  else
+    echo "$input => \"$expected\" expected, but got \"$actual\""
+    exit 1
+  fi
+}
+
 echo
 echo 'simple arithmetic'
 echo
@@ -40,6 +58,22 @@ assert 10 'package main; func main() { return -10+20; }'
 assert 10 'package main; func main() { return - -10; }'
 assert 10 'package main; func main() { return - - +10; }'
 
+echo
+echo 'integer literals'
+echo
+assert 31 'package main; func main() { return 0x1f; }'
+assert 171 'package main; func main() { return 0XaB; }'
+assert 15 'package main; func main() { return 0o17; }'
+assert 15 'package main; func main() { return 0O17; }'
+assert 15 'package main; func main() { return 017; }'
+assert 5 'package main; func main() { return 0b101; }'
+assert 5 'package main; func main() { return 0B_1_0_1; }'
+assert 100 'package main; func main() { return 1_00; }'
+assert 15 'package main; func main() { return 0x_F; }'
+assert 7 'package main; func main() { return 0_7; }'
+assert 0 'package main; func main() { return 0; }'
+assert 15 'package main; func main() { return 0x7fffffffffffffff - 9_223_372_036_854_775_792; }'
+
 echo
 echo 'equality operators'
 echo
@@ -65,6 +99,73 @@ assert 1 'package main; func main() { return 1>=0; }'
 assert 1 'package main; func main() { return 1>=1; }'
 assert 0 'package main; func main() { return 1>=2; }'
 
+echo
+echo 'arithmetic and bitwise operators'
+echo
+assert 2 'package main; func main() { return 17%5; }'
+assert 3 'package main; func main() { return -17%5+5; }'
+assert 8 'package main; func main() { return 12&10; }'
+assert 14 'package main; func main() { return 12|10; }'
+assert 6 'package main; func main() { return 12^10; }'
+assert 4 'package main; func main() { return 12&^10; }'
+assert 40 'package main; func main() { return 5<<3; }'
+assert 5 'package main; func main() { return 40>>3; }'
+assert 255 'package main; func main() { return -1>>70; }'
+assert 0 'package main; func main() { x:=1; return x<<64; }'
+assert 1 'package main; func main() { s := 7; var y int8 = 1 << s; var z int64 = 1 << s; w := 1 << s; u := (1 << s) + 3; if y == -128 && z == 128 && w == 128 && u == 131 && 1<<s == 128 { return 1; } return 0; }'
+assert 3 'package main; func f(x uint8) uint8 { return x; }; func main() { s := 8; var x int16 = 3; return int(f(1 << s)) + int(x + 1<<s) - 256; }'
+assert 250 'package main; func main() { return ^5; }'
+assert 1 'package main; func main() { return ^-2; }'
+assert 11 'package main; func main() { return 1+2*5; }'
+assert 7 'package main; func main() { return 1|2^4; }'
+assert 6 'package main; func main() { return 1<<2|2; }'
+assert 9 'package main; func main() { return 1+1<<3; }'
+assert 1 'package main; func main() { return 2+3 == 5; }'
+assert 1 'package main; func main() { return (1<2) == (2<3); }'
+assert 1 'package main; func main() { var m int64 = -9223372036854775808; d := int64(-1); q := m / d; r := m % d; m /= d; if q == -9223372036854775808 && r == 0 && m == q { return 1; } return 0; }'
+assert 9 'package main; func main() { a, b := -7, -1; var c int32 = -2147483648; var d int32 = -1; if c / d == c && c % d == 0 { return a / b + a % b + 4 * (-7 / 2) % 3 + 2; } return 0; }'
+
+echo
+echo 'logical operators'
+echo
+assert 1 'package main; func main() { return 1<2 && 2<3; }'
+assert 0 'package main; func main() { return 1<2 && 3<2; }'
+assert 1 'package main; func main() { return 2<1 || 2<3; }'
+assert 0 'package main; func main() { return 2<1 || 3<2; }'
+assert 1 'package main; func main() { return 2<1 && 1<2 || 1<2; }'
+assert 1 'package main; func main() { return 1<2 || 1<2 && 2<1; }'
+
+assert 0 'package main; var c int64; func inc() { c=c+1; return 1; } func main() { x:=0; if x==1 && inc()==1 { x=2; } return c; }'
+assert 1 'package main; var c int64; func inc() { c=c+1; return 1; } func main() { x:=1; if x==1 && inc()==1 { x=2; } return c; }'
+assert 0 'package main; var c int64; func inc() { c=c+1; return 1; } func main() { x:=0; if x==0 || inc()==1 { x=2; } return c; }'
+assert 1 'package main; var c int64; func inc() { c=c+1; return 1; } func main() { x:=1; if x==0 || inc()==1 { x=2; } return c; }'
+assert 2 'package main; var c int64; func inc() { c=c+1; return 1; } func main() { x:=1 < 2 || inc()==1 && inc()==1; x = 2 < 1 && inc()==1 || inc()==1 && inc()==1; return c; }'
+assert 0 'package main; func main() { return !(1<2); }'
+assert 1 'package main; func main() { return !(2<1); }'
+assert 1 'package main; func main() { return !!(1<2); }'
+assert 1 'package main; func main() { return !(2<1) && !(3<1); }'
+
+echo
+echo 'assignment operations'
+echo
+assert 4 'package main; func main() { a:=3; a++; return a; }'
+assert 2 'package main; func main() { a:=3; a--; return a; }'
+assert 8 'package main; func main() { a:=3; a+=5; return a; }'
+assert 1 'package main; func main() { a:=3; a-=2; return a; }'
+assert 15 'package main; func main() { a:=3; a*=5; return a; }'
+assert 3 'package main; func main() { a:=7; a/=2; return a; }'
+assert 1 'package main; func main() { a:=7; a%=2; return a; }'
+assert 2 'package main; func main() { a:=6; a&=3; return a; }'
+assert 7 'package main; func main() { a:=6; a|=3; return a; }'
+assert 5 'package main; func main() { a:=6; a^=3; return a; }'
+assert 24 'package main; func main() { a:=6; a<<=2; return a; }'
+assert 1 'package main; func main() { a:=6; a>>=2; return a; }'
+assert 4 'package main; func main() { a:=6; a&^=3; return a; }'
+assert 6 'package main; func main() { var x [2]int64; x[1]=2; x[1]*=3; return x[1]; }'
+assert 5 'package main; func main() { a:=4; p:=&a; *p++; return a; }'
+assert 10 'package main; func main() { s:=0; for i:=0; i<5; i++ { s+=i; } return s; }'
+assert 3 'package main; func main() { var a int32 = 2; a++; return a; }'
+
 echo
 echo 'assignments'
 echo
@@ -79,6 +180,205 @@ assert 3 'package main; func main() { foo:=3; return foo; }'
 assert 8 'package main; func main() { foo123:=3; bar:=5; return foo123+bar; }'
 assert 2 'package main; func main() { hoge1:=1; hoge2:=hoge1+hoge1; return hoge2; }'
 
+assert 3 'package main; func main() { my_var:=3; return my_var; }'
+assert 4 'package main; func main() { _x:=4; return _x; }'
+assert 5 'package main; func main() { café:=2; 日本:=3; return café+日本; }'
+assert 6 'package main; var größe int64=6; func main() { return größe; }'
+assert 7 'package main; func main() { returnx:=7; return returnx; }'
+assert 8 'package main; func main() { return_:=8; return return_; }'
+assert 9 'package main; func main() { x２:=9; return x２; }'
+
+echo
+echo 'constants'
+echo
+assert 2 'package main; const a = 2; func main() { return a; }'
+assert 5 'package main; const a, b = 2, 3; func main() { return a+b; }'
+assert 12 'package main; func main() { const a int64 = 12; return a; }'
+assert 3 'package main; const ( A = iota; B; C; D ); func main() { return D; }'
+assert 4 'package main; const ( A = iota; B; _; D ); func main() { return D+B; }'
+assert 10 'package main; const ( A, B = iota, iota*10; C, D ); func main() { return C+D+A+B-1; }'
+assert 8 'package main; const ( _ = 1 << iota; K2; K4; K8 ); func main() { return K8; }'
+assert 4 'package main; const big = 1 << 100; func main() { return big >> 98; }'
+assert 98 "package main; func main() { var a int32 = 1; b := 'a'; return a + b; }"
+assert 255 'package main; func main() { var x int8 = -1; return x; }'
+assert 7 'package main; const n = 7; func main() { var a [n]int64; a[n-1] = n; return a[6]; }'
+assert 101 'package main; const s = "hello"; func main() { var c byte = s[1]; return c; }'
+assert 3 'package main; func main() { return 10 / 3; }'
+assert 1 'package main; func main() { return -7 % 2 + 2; }'
+assert 1 'package main; const t = 1 < 2; func main() { if t && !(2 < 1) { return 1; } return 0; }'
+assert 6 'package main; func main() { const ( x = 1 + 2; y = x * 2 ); return y; }'
+assert 99 'package main; const s = "ab" + "cd"; func main() { return len(s) + int(s[2]) - 4; }'
+assert 1 'package main; const a = "x"; const b = a == "x"; const c = a < "a"; func main() { if b && !c { return 1; } return 0; }'
+assert 3 'package main; const n = len("ab" + "c"); func main() { var a [n]int; return len(a); }'
+assert 8 'package main; func main() { var a [3]int; var p *[5]int; const n = len(a) + cap(p); var b [n]int; return len(b); }'
+
+echo
+echo 'scopes'
+echo
+assert 1 'package main; func main() { x := 1; { x := 2; x = 3; } return x; }'
+assert 3 'package main; func main() { x := 1; { x := x + 2; return x; } }'
+assert 5 'package main; func f() int64 { return 5; } func main() { if err := f(); err != 5 { return 1; } err := 5; return err; }'
+assert 7 'package main; func main() { x := 7; if x := 1; x > 2 { return 0; } else { x = 3; } return x; }'
+assert 2 'package main; func main() { x := 1; if x := 2; x > 5 { return 0; } else if y := x; y == 2 { return y; } return 9; }'
+assert 4 'package main; func main() { i := 4; for i := 0; i < 10; i++ { } return i; }'
+assert 6 'package main; var x int64 = 6; func main() { x := 1; return 5 + x; }'
+assert 8 'package main; var x int = 6; func f() int { return x; } func main() { x := 2; return f() + x; }'
+assert 3 'package main; const c = 3; func main() { { c := 1; c = 2; } return c; }'
+assert 9 'package main; func main() { a := 1; { var a int = a + 8; return a; } }'
+assert 2 'package main; func f(a int64) int64 { { a := 9; a = a; } return a; } func main() { return f(2); }'
+
+echo
+echo 'package-level declarations'
+echo
+assert 6 'package main; func main() { return x; } var x = y * 2; var y int64 = 3'
+assert 5 'package main; var a = f(); func f() int64 { return b + 1; } var b int64 = 4; func main() { return a; }'
+assert 9 'package main; var s [n]int8; const n = m + 1; const m = 2; func main() { s[2] = 9; return s[2]; }'
+assert 4 'package main; func main() { var s [n]int8; s[0] = 4; return s[0]; } const n = 1'
+assert 7 'package main; var _ = f(); var n int64; func f() int64 { n = 7; return 0; } func main() { return n; }'
+assert 3 'package main; func _() {}; func _() int { return 1; }; type T struct{}; func (T) _() {}; func (*T) _() {}; func main() { return 3; }'
+assert 3 'package main; func main() { return g(); } func g() int64 { return h() + 1; } func h() int64 { return 2; }'
+
+echo
+echo 'structs'
+echo
+assert 7 'package main; type P struct { x, y int64 }; func main() { var p P; p.x = 3; p.y = 4; return p.x + p.y; }'
+assert 20 'package main; type P struct { a int8; b int64; c int8 }; func main() { p := P{a: 1, b: 2, c: 3}; return p.b*10; }'
+assert 14 'package main; type P struct { a int8; b int64; c int8 }; func main() { p := P{c: 5}; q := p; q.c = 9; return p.c + q.c; }'
+assert 3 'package main; type N struct { v int64; next *N }; func main() { b := &N{v: 2}; a := &N{v: 1, next: b}; return a.next.v + a.v; }'
+assert 13 'package main; type P struct { x, y int64 }; func f(p P) P { p.x = p.x * 2; return p; } func main() { p := P{3, 4}; q := f(p); return p.x + q.x + f(p).y; }'
+assert 103 'package main; type P struct { s string; n byte }; func main() { p := P{"hello", 2}; return p.n + p.s[1]; }'
+assert 2 'package main; func main() { p := struct{ a, b int64 }{1, 2}; return p.b; }'
+assert 14 'package main; type A struct { b B }; type B struct { v [3]int8 }; var g A; func main() { g.b.v[2] = 7; pa := &g; return pa.b.v[2] + f(); } func f() int8 { var x A; x = g; return x.b.v[2]; }'
+assert 1 'package main; type P struct { x int64 }; func main() { p := P{1}; if p.x == (P{1}).x { return 1; } return 0; }'
+assert 4 'package main; type P struct { x int64 }; func main() { p := P{1}; for i := 0; i < 3; i++ { q := P{}; q.x = q.x + 1; p.x = p.x + q.x; } return p.x; }'
+assert 5 'package main; func main() { type P struct { x int64 }; p := &P{2}; p.x += 3; return (*p).x; }'
+assert 3 'package main; type P struct { x int8; y int64; s string }; func main() { p := P{1, 2, "ab"}; q := P{1, 2, "xab"[1:]}; r := P{1, 3, "ab"}; n := 0; if p == q { n += 1; }; if p != r { n += 2; }; if p == r { n += 4; }; return n; }'
+assert 1 'package main; type E struct{}; func main() { a, b := E{}, E{}; if a == b { return 1; }; return 0; }'
+
+echo
+echo 'named types'
+echo
+assert 35 'package main; type Celsius int64; func main() { var c Celsius = 30; c = c + 5; return int64(c); }'
+assert 16 'package main; type Pair [2]int64; func main() { p := Pair{3, 4}; var a [2]int64 = p; a[0] = 9; return a[0] + p[0] + p[1]; }'
+assert 3 'package main; type A = int64; type B = A; func main() { var a A = 3; var b int64 = a; var c B = b; return c; }'
+assert 6 'package main; type L []N; type N struct { v int; kids L }; func main() { n := N{1, L{N{2, nil}, N{3, nil}}}; return n.v + n.kids[1].v + len(n.kids); }'
+assert 9 'package main; type P *N; type N struct { v int; p P }; func main() { a := N{4, nil}; b := N{5, &a}; return b.p.v + b.v; }'
+assert 5 'package main; type F func(N) int; type N struct { v int; f F }; func g(n N) int { return n.v; }; func main() { n := N{5, g}; return n.f(n); }'
+assert 7 'package main; type A = *B; type B struct { v int; a A }; func main() { x := B{3, nil}; y := B{4, &x}; var z A = &y; return z.a.v + z.v; }'
+assert 9 'package main; type S = []B; type B struct { v int; s S }; func main() { x := B{3, S{B{6, nil}}}; return x.s[0].v + x.v; }'
+assert 4 'package main; type P struct { x int64 }; type Q P; func main() { q := Q{4}; p := P(q); return p.x; }'
+assert 5 'package main; type L struct { next *L; v int64 }; type P *L; func main() { var l L; l.v = 5; var p P = &l; return (*p).v; }'
+assert 6 'package main; type E int8; const c E = 3; func main() { var e E = c * 2; return int64(e); }'
+assert 2 'package main; type S string; const x S = "a"; const z = x + "b"; func main() { var y S = z; if x == "a" { return len(y); } return 0; }'
+assert 1 'package main; type B bool; const x B = true; func main() { var y B = x; if y { return 1; } return 0; }'
+assert 3 'package main; type S string; func f(s S) int { return len(s); } func main() { var y S = "ab"; return f("c") + len(y); }'
+assert 3 'package main; func main() { int64 := 3; return int64; }'
+assert 103 'package main; const c int8 = 3; func main() { return int64(c) + 100; }'
+assert 44 'package main; func main() { var x int64 = 300; return int8(x); }'
+assert 1 'package main; func main() { var x int64 = -1; y := int8(x); if y == -1 { return 1; } return 0; }'
+assert 3 'package main; func main() { x := [3]int8{1, 2}; return x[0] + x[1] + x[2]; }'
+assert 7 'package main; type ( T int64; U = T ); func f(t U) T { return t + 1; } func main() { return f(6); }'
+
+echo
+echo 'predeclared identifiers'
+echo
+assert 1 'package main; func main() { x := true; if x && !false { return 1; } return 0; }'
+assert 3 'package main; const t = true; func main() { var b bool = t == false; if b { return 2; } return 3; }'
+assert 2 'package main; func main() { true := 2; return true; }'
+assert 3 'package main; type int int8; func main() { var x int = 3; return int64(x); }'
+assert 1 'package main; func main() { var p *int64; if p == nil { return 1; } return 0; }'
+assert 5 'package main; func main() { x := 5; p := &x; if nil != p { return *p; } return 0; }'
+assert 7 'package main; func main() { var e error; if e == nil { return 7; } return 0; }'
+assert 4 'package main; func main() { var e error = nil; var p *int8 = nil; if e == nil && p == nil { return 4; } return 0; }'
+assert 0 'package main; func f() int64 { var x int64; return x; } func g() { var y int64 = 9; y++; } func main() { g(); return f(); }'
+assert 44 'package main; func main() { var x uint8 = 200; x += 100; return x; }'
+assert 15 'package main; func main() { var x uint32 = 1; x = x - 2; return x >> 28; }'
+assert 1 'package main; func main() { var x uint64 = 0; x--; if x > 5 { return 1; } return 0; }'
+assert 7 'package main; func main() { var x uint = 10; x = x - 11; return x / 2 >> 60; }'
+assert 250 'package main; func main() { var x uint8 = 5; return ^x; }'
+assert 250 'package main; const x uint8 = 5; func main() { return ^x; }'
+assert 4 'package main; func main() { x := 5; return ^x + 10; }'
+assert 254 'package main; func main() { var b byte = 255; var r rune = -1; return b + byte(r); }'
+assert 1 'package main; func main() { var b uint16 = 65535; b++; var c int16 = 32767; c++; if c < 0 { return b + 1; } return 0; }'
+assert 3 'package main; func main() { var x uintptr = 3; var y uint32 = 0; return x + uintptr(y); }'
+assert 9 'package main; func main() { p := new(int64); *p += 9; return *p; }'
+assert 2 'package main; type P struct { x, y int64 }; func main() { p := new(P); p.y = 2; return p.x + p.y; }'
+assert 4 'package main; func main() { return len("abcd"); }'
+assert 5 'package main; const n = len("hello"); func main() { var a [n]int8; return len(a); }'
+assert 8 'package main; func main() { s := "hello"; var a [3]int8; p := &a; return len(s) + cap(p); }'
+
+echo
+echo 'slices'
+echo
+assert 10 'package main; func main() { s := []int{1, 2, 3}; return s[0] + s[2] + len(s) + cap(s); }'
+assert 199 'package main; func main() { var s []int; for i := 0; i < 100; i++ { s = append(s, i); } return s[99] + len(s); }'
+assert 22 'package main; func main() { s := make([]int8, 3, 10); s[1] = 4; t := s[1:3]; return int(t[0]) + len(t)*5 + cap(t) - 1; }'
+assert 17 'package main; func main() { var a [5]int; a[2] = 7; s := a[1:4]; s[0] = 3; return a[1] + s[1] + len(s) + cap(s); }'
+assert 2 'package main; func main() { s := "hello"; t := s[1:3]; if t[0] == 101 { return len(t); } return 0; }'
+assert 7 'package main; func mk(n int) []int { var a [3]int; a[0] = n; return a[:]; }; func main() { s := mk(7); t := mk(3); return s[0] + t[0] - 3; }'
+assert 4 'package main; func main() { s := "hello"; return len(s[1:]) + len(s[:0]); }'
+assert 10 'package main; func main() { s := []int{1, 2}; t := []int{3, 4, 5}; s = append(s, t...); return s[4] + len(s); }'
+assert 3 'package main; func main() { var b []byte; b = append(b, "hi"...); b = append(b, 33); if b[2] == 33 { return len(b); } return 0; }'
+assert 28 'package main; func main() { d := make([]int, 2); n := copy(d, []int{7, 8, 9}); return n*10 + d[1]; }'
+assert 2 'package main; func main() { b := make([]byte, 5); return copy(b, "hi"); }'
+assert 1 'package main; func main() { var s []int; if s == nil { s = make([]int, 0); if s != nil { return 1; } } return 0; }'
+assert 11 'package main; func f(s []int) int { s[0] = 9; return len(s); } func main() { s := []int{1, 2}; n := f(s); return s[0] + n; }'
+assert 5 'package main; type S struct { a []int; n int }; func main() { var x S; x.a = append(x.a, 4); x.n = 1; return x.a[0] + x.n; }'
+assert 3 'package main; func main() { s := [][]int{{1}, {2, 3}}; return s[1][1]; }'
+assert 6 'package main; type P struct { x, y int }; func main() { ps := []P{{1, 2}, {y: 5}}; return ps[1].y + ps[0].x; }'
+assert 3 'package main; func main() { s := make([]int, 2, 3); s = s[:3]; t := s[1:2:3]; return len(t) + cap(t); }'
+assert 10 'package main; func main() { var a [3]int; p := &a; s := p[:]; s[2] = 7; return a[2] + len(p); }'
+assert 6 'package main; func f() []int { return []int{1, 2, 3}; } func main() { s := f(); s = append(s[:1], s[2:]...); return s[0] + s[1] + len(s) + cap(s) - 3; }'
+assert 2 'package main; func main() { s := []int{1, 2, 3}; i := 5; return s[i]; }'
+assert 2 'package main; func main() { var a [3]int; i := 3; return a[i]; }'
+assert 2 'package main; func main() { s := []int{1, 2, 3}; i := 5; t := s[1:i]; return t[0]; }'
+assert 2 'package main; func main() { n := -1; s := make([]int, n); return len(s); }'
+
+echo
+echo 'maps'
+echo
+assert 12 'package main; func main() { m := make(map[int]int); m[1] = 5; m[2] = 7; return m[1] + m[2]; }'
+assert 3 'package main; func main() { m := map[string]int{"a": 1, "bb": 2}; return m["a"] + m["bb"] + m["c"]; }'
+assert 150 'package main; func main() { m := make(map[int]int); for i := 0; i < 100; i++ { m[i] = i; } return len(m) + m[50]; }'
+assert 23 'package main; func main() { m := map[int]int{1: 2}; v, ok := m[1]; w, ok2 := m[3]; if ok && !ok2 { return v*10 + w + 3; } return 0; }'
+assert 1 'package main; func main() { m := map[string]bool{"x": true, "y": true}; delete(m, "x"); delete(m, "z"); _, ok := m["x"]; if !ok { return len(m); } return 0; }'
+assert 29 'package main; func main() { m := make(map[int]int); for i := 0; i < 40; i++ { m[i] = i; } for i := 0; i < 40; i += 2 { delete(m, i); } for i := 0; i < 40; i += 4 { m[i] = 1; } return len(m) - m[0] - m[1] + m[39] - 39 + 1; }'
+assert 7 'package main; func main() { var m map[string]int; if m == nil { return len(m) + m["a"] + 7; } return 0; }'
+assert 4 'package main; func main() { m := map[string]int{}; m["a"] += 3; m["a"]++; return m["a"]; }'
+assert 13 'package main; type S struct { m map[string]int; n int }; func main() { s := S{m: map[string]int{}}; s.m["x"], s.n = 6, 7; return s.m["x"] + s.n; }'
+assert 3 'package main; func main() { m := map[string][]int{"a": {1, 2}}; m["b"] = append(m["b"], 1); return len(m["a"]) + m["b"][0]; }'
+assert 2 'package main; type P struct { x, y int }; func main() { m := map[string]P{"a": {1, 2}}; return m["a"].y; }'
+assert 1 'package main; func main() { m := map[int]int{}; m[0] = len(m); m[1] = len(m); return m[1] - m[0]; }'
+assert 18 'package main; func main() { p := &[]int{1, 2}; q := &map[int]int{1: 5}; *p = append(*p, 3); (*q)[2] = 7; return len(*p) + (*p)[2] + (*q)[1] + (*q)[2]; }'
+assert 6 'package main; func mk() *[]int { return &[]int{4, 5}; }; func main() { a := mk(); b := mk(); (*b)[0] = 9; return (*a)[0] + len(*a); }'
+assert 5 'package main; func f(m map[string]int) { m["k"] = 5; } func main() { m := make(map[string]int, 10); f(m); return m["k"]; }'
+assert 2 'package main; func main() { var m map[string]int; m["a"] = 1; return 0; }'
+
+echo
+echo 'tuple assignments'
+echo
+assert 3 'package main; func main() { x, y := 1, 2; return x+y; }'
+assert 21 'package main; func main() { a, b := 1, 2; a, b = b, a; return a*10+b; }'
+assert 18 'package main; func main() { a, b, c := 1, 2, 3; a, b, c = c, a, b; return a*4+b*2+c*2; }'
+assert 7 'package main; func f() (int64, int64) { return 3, 4; } func main() { a, b := f(); return a+b; }'
+assert 4 'package main; func f() (int64, int64) { return 3, 4; } func main() { _, b := f(); return b; }'
+assert 5 'package main; func main() { a := 1; a, b := 2, 3; return a+b; }'
+assert 9 'package main; func main() { var x [2]int64; i := 0; i, x[i] = 1, 9; return x[0]; }'
+assert 2 'package main; func main() { x := 1; x, x = 1, 2; return x; }'
+assert 98 'package main; func main() { s, t := "ab", "cd"; s, t = t, s; var c byte = t[1]; return c; }'
+assert 3 'package main; func f() (string, int64) { return "abc", 3; } func main() { s, n := f(); s, _ = "x", 1; return n; }'
+assert 10 'package main; func main() { for i, j := 0, 10; i < j; i, j = i+1, j-1 { } return 10; }'
+
+echo
+echo 'blank identifier'
+echo
+assert 3 'package main; func main() { _ = 5; return 3; }'
+assert 3 'package main; func main() { var _ int64 = 5; var _ int64 = 6; return 3; }'
+assert 3 'package main; var c int64; func inc() { c=c+1; return c; } func main() { _ = inc(); var _ = inc(); var _ int64; _ = inc(); return c; }'
+assert 2 'package main; var c int64; var _ = inc(); var _ = inc(); func inc() { c=c+1; return c; } func main() { return c; }'
+assert 5 'package main; func main() { _ = "abc"; return 5; }'
+assert 7 'package main; func f(_ int64, b int64, _ int64) { return b; } func main() { return f(1, 7, 3); }'
+
 echo
 echo 'blocks'
 echo
@@ -103,26 +403,167 @@ echo 'for statements'
 echo
 assert 3 'package main; func main() { for { return 3; } }'
 assert 10 'package main; func main() { i:=0; for i<10 { i=i+2; i=i-1; } return i; }'
-assert 10 'package main; func main() { for i:=0; i<10; i=i+1 { 1; } return i; }'
-assert 10 'package main; func main() { i:=0; for ; i<10; i=i+1; { i=i; } return i; }'
-assert 10 'package main; func main() { for i:=0; i<10; ; { i=i+1; } return i; }'
-assert 11 'package main; func main() { for i:=0; ; i=i+1; { if i>10 { return i; } } }'
+assert 10 'package main; func main() { j:=0; for i:=0; i<10; i=i+1 { j=i+1; } return j; }'
+assert 10 'package main; func main() { i:=0; for ; i<10; i=i+1 { i=i; } return i; }'
+assert 10 'package main; func main() { j:=0; for i:=0; i<10; { i=i+1; j=i; } return j; }'
+assert 11 'package main; func main() { for i:=0; ; i=i+1 { if i>10 { return i; } } }'
+assert 80 'package main; func main() { s := []int{10, 20, 30}; n := 0; for i, v := range s { n += i * v; i = 5; } return n; }'
+assert 12 'package main; func main() { var a [4]int8; for i := range a { a[i] = int8(i); } n := 0; for _, v := range a { n += int(v); } return n * 2; }'
+assert 9 'package main; func main() { var a [3]int; p := &a; for i, v := range p { p[i] = v + i + 2; } return a[0] + a[1] + a[2]; }'
+assert 10 'package main; func main() { n := 0; for i := range 5 { n += i; } return n; }'
+assert 0 'package main; func main() { n := 0; for range -2 { n++; } var u uint8 = 0; for range u { n++; } return n; }'
+assert 4 'package main; func main() { n := 0; for range "héllo" { n++; } return n - 1; }'
+assert 11 'package main; func main() { n := 0; for i, r := range "aé€😀z" { if r == 128512 { n = i; } } return n + 5; }'
+assert 3 'package main; func main() { n := 0; for i, r := range "a\xffb" { if r == 65533 { n = i + 2; } } return n; }'
+assert 60 'package main; func main() { m := map[int]int{1: 10, 2: 20, 3: 30}; n := 0; for k, v := range m { n += v * k / k; } return n; }'
+assert 5 'package main; func main() { m := map[int]int{}; for i := 0; i < 10; i++ { m[i] = i; } n := 0; for k := range m { delete(m, 9-k); n++; } return n; }'
+assert 0 'package main; func main() { var m map[string]int; n := 0; for range m { n++; } return n; }'
+assert 32 'package main; func main() { s := []int{1, 2}; k, v := 0, 0; for k, v = range s { } return k*10 + v*11; }'
+assert 3 'package main; func f() []int { calls++; return []int{1, 2, 3}; } var calls int; func main() { n := 0; for range f() { n++; } return n * calls; }'
+assert 3 'package main; func main() { s := []int{1, 2, 3}; n := 0; for range s { s = append(s, 1); n++; } return n; }'
+assert 12 'package main; func main() { var ps []*int; for i := range 3 { ps = append(ps, &i); } return *ps[0]*100 + *ps[1]*10 + *ps[2]; }'
+assert 12 'package main; func main() { var ps []*int; for i := 0; i < 3; i++ { ps = append(ps, &i); } return *ps[0]*100 + *ps[1]*10 + *ps[2]; }'
+assert 141 'package main; func main() { var ps []*int; for i := 0; i < 9; i++ { ps = append(ps, &i); if i > 4 { continue; }; i++; }; return *ps[0]*100 + *ps[1]*10 + *ps[2] + len(ps); }'
+assert 200 'package main; func main() { s := []int{4, 5, 6}; var ps []*int; for _, v := range s { ps = append(ps, &v); } return *ps[0]*100 + *ps[1]*10 + *ps[2]; }'
+
+echo
+echo 'break, continue and goto'
+echo
+assert 16 'package main; func main() { n := 0; for i := 0; i < 10; i++ { if i%2 == 0 { continue; } if i > 7 { break; } n += i; } return n; }'
+assert 4 'package main; func main() { n := 0; for { n++; if n > 3 { break; } } return n; }'
+assert 9 'package main; func main() { n := 0; outer: for i := 0; i < 5; i++ { for j := range 5 { if j == 3 { continue outer; } if i == 3 { break outer; } n++; } } return n; }'
+assert 2 'package main; func main() { m := map[int]int{1: 1, 2: 2, 3: 3}; n := 0; for range m { n++; if n == 2 { break; } } return n; }'
+assert 6 'package main; func main() { n := 0; for _, c := range "abcdef" { if c == 99 { continue; } n++; } return n + 1; }'
+assert 5 'package main; func main() { i := 0; loop: if i < 5 { i++; goto loop; } return i; }'
+assert 3 'package main; func main() { goto end; return 1; end: return 3; }'
+assert 7 'package main; func f() int { for { if true { goto L; } } L: return 7; } func main() { return f(); }'
+assert 1 'package main; func main() { x := 0; { L: x++; if x < 1 { goto L; } } return x; }'
+
+echo
+echo 'switch statements'
+echo
+assert 20 'package main; func f(n int) int { switch n { case 0: return 10; case 1, 2: return 20; default: return 0; } } func main() { return f(2); }'
+assert 70 'package main; func f(n int) int { switch n { case 0: return 10; case 1, 2: return 20; case 3: return 30; case 6: fallthrough; case 7: return 70; } return 0; } func main() { return f(6); }'
+assert 1 'package main; func f(n int) int { switch n { case 0: return 10; case 1, 2: return 20; case 3: return 30; case 6: fallthrough; case 7: return 70; } return 1; } func main() { return f(-5) * f(4) * f(100); }'
+assert 2 'package main; func f(s string) int { switch s { case "a": return 1; case "bc", "de": return 2; } return 0; } func main() { return f("de") + f("b") + f("abc"); }'
+assert 3 'package main; func sign(x int) int { switch { case x < 0: return 1; case x > 0: return 2; } return 0; } func main() { return sign(-4) + sign(3) + sign(0); }'
+assert 23 'package main; func main() { n := 0; for i := 0; i < 10; i++ { switch x := i % 3; x { case 0: continue; case 1: if i > 6 { break; } n += 10; default: n++; } } return n; }'
+assert 5 'package main; func main() { var u uint8 = 200; switch u { case 200, 201, 202, 203: return 5; } return 0; }'
+assert 4 'package main; func main() { n := 0; loop: for { switch { default: n = 4; break loop; } } return n; }'
+assert 3 'package main; func main() { n := 0; switch { case true: n++; fallthrough; case false: n++; fallthrough; default: n++; } return n; }'
+assert 1 'package main; func main() { a := "ab"; if a == "ab" && a != "a" && a < "b" && "abc" > a { return 1; } return 0; }'
 
 echo
 echo 'function'
 echo
-assert 3 'package main; func main() { return ret3(); }'
-assert 5 'package main; func main() { return ret5(); }'
-assert 8 'package main; func main() { return add(3, 5); }'
-assert 2 'package main; func main() { return sub(5, 3); }'
+assert 3 'package main; func ret3() int32; func main() { return ret3(); }'
+assert 5 'package main; func ret5() int32; func main() { return ret5(); }'
+assert 8 'package main; func add(x, y int32) int32; func main() { return add(3, 5); }'
+assert 2 'package main; func sub(x, y int32) int32; func main() { return sub(5, 3); }'
 assert 2 'package main; func sub2(a int64, b int64) { return a-b; } func main() { return sub2(5, 3); }'
-assert 21 'package main; func main() { return add6(1,2,3,4,5,6); }'
+assert 21 'package main; func add6(a, b, c, d, e, f int32) int32; func main() { return add6(1,2,3,4,5,6); }'
+assert 4 'package main; func minus(a, b int) int { return a - b; }; func main() {
+	return minus(
+		5,
+		2,
+	) + int(int8(1,));
+}'
 
 assert 32 'package main; func main() { return ret32(); } func ret32() { return 32; }'
 assert 7 'package main; func main() { return add2(3,4); } func add2(x int64, y int64) { return x+y; }'
 assert 1 'package main; func main() { return sub2(4,3); } func sub2(x int64, y int64) { return x-y; }'
 assert 55 'package main; func main() { return fib(9); } func fib(x int64) { if x<=1 { return 1; } return fib(x-1) + fib(x-2); }'
 
+echo
+echo 'function results'
+echo
+assert 3 'package main; func ret() int64 { return 3; } func main() { x := ret(); return x; }'
+assert 7 'package main; func f(a, b int64) int64 { return a+b; } func main() { return f(3, 4); }'
+assert 4 'package main; func f(int64, int64) int64 { return 4; } func main() { return f(1, 2); }'
+assert 98 'package main; func f() string { return "abc"; } func main() { s := f(); var x byte = s[1]; return x; }'
+assert 99 'package main; func f(s string, i int64) byte { return s[i]; } func main() { return f("abc", 2); }'
+assert 21 'package main; func swap(a, b int64) (int64, int64) { return b, a; } func sub2(a, b int64) int64 { return a-b; } func main() { return sub2(swap(3, 24)); }'
+assert 6 'package main; func f() (int64, string, int64) { return 1, "xy", 3; } func g(a int64, s string, c int64) int64 { return a+c+2; } func main() { return g(f()); }'
+assert 10 'package main; func f(x int64) (y int64, s string) { y = x*2; s = "hi"; return; } func g(y int64, s string) int64 { return y; } func main() { return g(f(5)); }'
+assert 0 'package main; func f() (n int64) { return; } func main() { return f(); }'
+assert 36 'package main; func f(a, b, c, d, e, f, g, h int64) int64 { return a+b+c+d+e+f+g+h; } func main() { return f(1, 2, 3, 4, 5, 6, 7, 8); }'
+assert 3 'package main; func f(a, b, c int64, s string, d, e, g int64, t string) byte { if a+b+c+d+e+g == 6 { return t[0]-s[0]; } return 0; } func main() { return f(1, 1, 1, "a", 1, 1, 1, "d"); }'
+assert 3 'package main; func f(x int64) int64 { if x > 0 { return 3; } else { return 4; } } func main() { return f(1); }'
+assert 5 'package main; func f() int64 { for { return 5; } } func main() { return f(); }'
+
+echo
+echo 'methods'
+echo
+assert 88 'package main; type T struct { x int }; func (t T) Get() int { return t.x; } func (t *T) Set(v int) { t.x = v; } func main() { var a T; a.Set(7); p := &a; p.Set(p.Get()+1); return a.Get()*10 + p.x; }'
+assert 20 'package main; type I int; func (i I) Double() I { return i*2; } func main() { var x I = 5; return int(x.Double().Double()); }'
+assert 12 'package main; type T struct { x int }; type U struct { x int }; func (t T) String() int { return 1; } func (u U) String() int { return 2; } func main() { return T{}.String()*10 + U{}.String(); }'
+assert 25 'package main; type S struct { a, b, c, d int }; func (s S) Sum(k int) int { return s.a+s.b+s.c+s.d+k; } func main() { s := S{1,2,3,4}; p := &s; return p.Sum(5) + (s.Sum)(0); }'
+assert 8 'package main; type T int; func (t *T) Inc() { *t++; } func main() { var a [3]T; a[1].Inc(); a[1].Inc(); s := []T{5}; s[0].Inc(); return int(a[1]) + int(s[0]); }'
+assert 23 'package main; func (p *Pt) Move(dx, dy int) (int, int) { p.x += dx; p.y += dy; return p.x, p.y; } type Pt struct { x, y int }; func main() { var p Pt; a, b := p.Move(2, 3); return a*10 + b; }'
+assert 4 'package main; type S string; func (s S) Len() int { return len(s); } func main() { return S("abcd").Len(); }'
+assert 3 'package main; type T int; func (T) One() int { return 1; } func (_ T) Two() int { return 2; } func main() { var t T; return t.One() + t.Two(); }'
+assert 13 'package main; type T struct { x int }; func (t T) Get() int { return t.x; } func (t *T) Add(v int) int { t.x += v; return t.x; } func main() { a := T{3}; return T.Get(a) + (*T).Get(&a) + (*T).Add(&a, 4); }'
+assert 7 'package main; type N int; func (n N) Add(m N) N { return n + m; } var x = N.Add(3, 4); func main() { return int(x); }'
+
+echo
+echo 'interfaces'
+echo
+assert 28 'package main; type Shape interface { Area() int; Name() string; }; type Rect struct { w, h int; }; func (r Rect) Area() int { return r.w*r.h; } func (r Rect) Name() string { return "rect"; } type Sq struct { s int; }; func (s *Sq) Area() int { return s.s*s.s; } func (s *Sq) Name() string { return "sq"; } func total(ss []Shape) int { n := 0; for _, s := range ss { n += s.Area() + len(s.Name()); } return n; } func main() { return total([]Shape{Rect{2, 3}, &Sq{4}}); }'
+assert 1 'package main; func main() { var e error; if e == nil { return 1; } return 0; }'
+assert 3 'package main; type E struct { msg string; }; func (e *E) Error() string { return e.msg; } func f(fail bool) error { if fail { return &E{"bad"}; } return nil; } func main() { e := f(true); if f(false) != nil { return 9; } return len(e.Error()); }'
+assert 31 'package main; func main() { var a interface{}; var b interface{}; a = 3; b = 3; n := 0; if a == b { n += 1; } b = "x"; if a != b { n += 2; } a = "x"; if a == b { n += 4; } if a == "x" { n += 8; } var c interface{} = 3; if c == 3 { n += 16; } return n; }'
+assert 3 'package main; type P struct { x int8; s string; y int; }; func main() { var a interface{} = P{1, "ab", 3}; var b interface{} = P{1, "xab"[1:], 3}; n := 0; if a == b { n++; } b = P{2, "ab", 3}; if a != b { n += 2; } return n; }'
+assert 42 'package main; type I interface { Get() int; Set(v int); }; type C struct { v int; }; func (c *C) Get() int { return c.v; } func (c *C) Set(v int) { c.v = v; } func main() { c := &C{1}; var i I = c; i.Set(42); return c.v; }'
+assert 15 'package main; type I interface { Get() int; }; type C struct { v int; }; func (c C) Get() int { return c.v; } func main() { c := C{1}; var i I = c; c.v = 5; var j I = &c; return i.Get()*10 + j.Get(); }'
+assert 11 'package main; type Expr interface { isExpr(); getPos() int; }; type Bin struct { pos int; }; type Lit struct { pos int; }; func (*Bin) isExpr() {} func (*Lit) isExpr() {} func (b *Bin) getPos() int { return b.pos; } func (l *Lit) getPos() int { return l.pos * 2; } func main() { es := []Expr{&Bin{3}, &Lit{4}}; n := 0; for _, e := range es { e.isExpr(); n += e.getPos(); } return n; }'
+assert 17 'package main; type A interface { M() int; }; type B interface { A; N() int; }; type T int; func (t T) M() int { return int(t); } func (t T) N() int { return 2; } func main() { var b B = T(5); var a A = b; var e interface{} = a; var a2 A = T(5); n := 0; if e == a2 { n = 10; } return a.M() + b.N() + n; }'
+assert 39 'package main; type I interface { M(a, b, c, d, e, f, g int) (int, string, int); }; type T struct { k int; s string; }; func (t T) M(a, b, c, d, e, f, g int) (int, string, int) { return t.k+a+b+c+d+e+f+g, t.s, 7; } func main() { var i I = T{1, "abc"}; x, s, y := i.M(1, 2, 3, 4, 5, 6, 7); return x + len(s) + y; }'
+assert 6 'package main; type I interface { M() int; }; type T int; func (t T) M() int { return int(t); } func main() { return I.M(T(6)); }'
+assert 2 'package main; func main() { var a interface{} = []int{1}; var b interface{} = []int{1}; if a == b { return 1; } return 0; }'
+assert 2 'package main; type S interface { M() int; }; func main() { var s S; return s.M(); }'
+
+echo
+echo 'type assertions'
+echo
+assert 42 'package main; func main() { var e interface{} = 42; return e.(int); }'
+assert 34 'package main; type T struct { a, b int; }; func main() { var e interface{} = T{3, 4}; t := e.(T); return t.a*10+t.b; }'
+assert 40 'package main; func main() { var e interface{} = "ab"; n, ok := e.(int); s, ok2 := e.(string); r := n; if ok { r += 10; } if ok2 { r += len(s)*20; } return r; }'
+assert 6 'package main; func main() { var e interface{}; var ok bool; n := 3; n, ok = e.(int); if !ok && n == 0 { return 6; } return 1; }'
+assert 2 'package main; func main() { var e interface{} = "ab"; return e.(int); }'
+assert 2 'package main; func main() { var e interface{}; return e.(int); }'
+assert 7 'package main; type I interface { M() int; }; type T int; func (t T) M() int { return int(t); }; func main() { var e interface{} = T(7); i := e.(I); return i.M(); }'
+assert 5 'package main; type I interface { M() int; }; func main() { var e interface{} = 3; i, ok := e.(I); if i == nil && !ok { return 5; } return i.M(); }'
+assert 2 'package main; type I interface { M() int; }; func main() { var e interface{} = 3; return e.(I).M(); }'
+assert 4 'package main; func main() { var q *int; var e interface{} = q; if e.(*int) == nil { return 4; } return 1; }'
+assert 23 'package main; type I interface { M() int; }; type T int; func (t T) M() int { return int(t)*3; }; func f(e interface{}) int { switch v := e.(type) { case nil: return 1; case int: return v + 1; case string, bool: if v == "x" { return 100; } return 50; case I: return v.M(); case *int: return *v; default: return 99; } }; func main() { x := 7; return f(nil) + f(2) + f("x")*0 + f(T(4)) + f(&x) + f(int8(1))*0 + f(true)*0; }'
+assert 122 'package main; func f(e interface{}) int { switch e.(type) { case int: return 1; case string: return 2; } return 3; }; func main() { return f(1)*100 + f("a")*10 + f(true); }'
+assert 4 'package main; func main() { var e interface{} = "abc"; switch x := 1; v := e.(type) { case string: return len(v) + x; } return 0; }'
+assert 5 'package main; func main() { var e interface{} = 1; switch v := e.(type) { case string, int: if v == 1 { return 5; } } return 0; }'
+assert 45 'package main; func f(e interface{}) int { switch e.(type) { case int: return 1; case int64: return 2; case uint: return 3; case uint64: return 4; case uintptr: return 5; } return 0; }; func main() { var u uint = 1; var p uintptr = 1; return f(1)*10000 + f(int64(1))*1000 + f(u)*100 + f(uint64(1))*10 + f(p) - 12300; }'
+assert 0 'package main; func main() { var e interface{} = 1; _, ok := e.(int64); if ok { return 1; } return 0; }'
+
+echo
+echo 'function values'
+echo
+assert 7 'package main; func sum(a, b int) int { return a + b; }; func apply(f func(int, int) int, x, y int) int { return f(x, y); }; func main() { return apply(sum, 3, 4); }'
+assert 7 'package main; func inc(x int) int { return x + 1; }; func main() { var f func(int) int; if f == nil { f = inc; }; if f != nil { return f(f(5)); }; return 0; }'
+assert 2 'package main; func main() { var f func(); f(); return 0; }'
+assert 51 'package main; func less(a, b int) bool { return a > b; }; func sort(a []int, less func(a, b int) bool) { for i := 0; i < len(a); i++ { for j := i + 1; j < len(a); j++ { if less(a[j], a[i]) { a[i], a[j] = a[j], a[i]; } } } }; func main() { a := []int{3, 1, 4, 1, 5}; sort(a, less); return a[0]*10 + a[4]; }'
+assert 5 'package main; func f() (int, string) { return 2, "abc"; }; func main() { g := f; a, s := g(); return a + len(s); }'
+assert 12 'package main; type S struct { f func(int) int; }; func dbl(x int) int { return x * 2; }; func main() { s := S{dbl}; fs := []func(int) int{dbl}; m := map[string]func(int) int{"d": dbl}; return s.f(1) + fs[0](2) + m["d"](3); }'
+assert 7 'package main; func add(x, y int) int; func main() { f := add; return f(2, 5); }'
+assert 11 'package main; func one() int { return 1; }; func main() { var e interface{} = one; f := e.(func() int); switch e.(type) { case func() int: return f() + 10; }; return 0; }'
+assert 2 'package main; func one() int { return 1; }; func main() { var e interface{} = one; return e == e; }'
+assert 9 'package main; var g = f; func f() int { return 9; }; func main() { return g(); }'
+assert 5 'package main; type F func(int) int; func (f F) Twice(x int) int { return f(f(x)); }; func inc(x int) int { return x + 1; }; func main() { var f F = inc; return f.Twice(3); }'
+assert 58 'package main; type T struct { n int; }; func (t T) Get() int { return t.n; }; func (t *T) Add(d int) { t.n += d; }; func main() { t := T{5}; g := t.Get; a := t.Add; a(3); t.n += 100; return g() * 10 + t.n - 100; }'
+assert 14 'package main; type T struct { n int; }; func (t T) Get() int { return t.n; }; func (t *T) Add(d int) { t.n += d; }; func main() { t := T{5}; f := T.Get; h := (*T).Add; k := (*T).Get; h(&t, 2); return f(t) + k(&t); }'
+assert 17 'package main; type I interface { M(int) int; }; type T int; func (t T) M(x int) int { return int(t) + x; }; func main() { var i I = T(3); f := i.M; g := I.M; return f(1) + g(i, 10); }'
+assert 29 'package main; type T int; func (t T) M(a, b, c, d, e, f, g int) int { return int(t)+a+b+c+d+e+f+g; }; func main() { x := T(1); m := x.M; return m(1, 2, 3, 4, 5, 6, 7); }'
+assert 5 'package main; type T struct { n int }; func (t *T) M() int { return t.n; }; func mk() func() int { t := T{5}; return t.M; }; func g() int { var a [64]int; for i := range a { a[i] = 9; }; return a[0]; }; func main() { f := mk(); g(); return f(); }'
+assert 8 'package main; type T struct { n int }; func (t *T) M() int { t.n++; return t.n; }; func mk(t T) func() int { return t.M; }; func main() { f := mk(T{6}); f(); return f(); }'
+assert 7 'package main; type T struct { n int }; func (t *T) P() *T { return t; }; func mk(n int) *T { var t T; t.n = n; return t.P(); }; func main() { a := mk(7); b := mk(3); return a.n + b.n - 3; }'
+
 echo
 echo 'pointers'
 echo
@@ -130,6 +571,8 @@ assert 3 'package main; func main() { x:=3; return *&x; }'
 assert 3 'package main; func main() { x:=3; y:=&x; return *y; }'
 assert 3 'package main; func main() { x:=3; y:=&x; z:=&y; return **z; }'
 assert 5 'package main; func main() { x:=3; y:=&x; *y=5; return x; }'
+assert 7 'package main; func f(n int) *int { x := n; return &x; } func g() int { var a [64]int; for i := range a { a[i] = 1; } return a[0]; } func main() { p := f(7); g(); return *p; }'
+assert 4 'package main; func f() (r int) { p := &r; *p = 4; return; } func main() { return f(); }'
 
 echo
 echo 'declarations'
@@ -141,8 +584,8 @@ assert 42 'package main; func main() { var x int64; x=42; return x; }'
 assert 3 'package main; func main() { var x int64=3; return x; }'
 assert 3 'package main; func main() { var x int64=5; var y int64=2; return x-y; }'
 assert 4 'package main; func main() { var x int64; x=3; return x+1; }'
-assert 4 'package main; func main() { var x int64; x=3; var y=1; return x+y; }'
-assert 4 'package main; func main() { var x int64; x=3; y:=1; return x+y; }'
+assert 4 'package main; func main() { var x int; x=3; var y=1; return x+y; }'
+assert 4 'package main; func main() { var x int; x=3; y:=1; return x+y; }'
 
 echo
 echo 'arrays'
@@ -153,6 +596,10 @@ assert 3 'package main; func main() { var x [2]int64; x[0]=2; x[1]=5; return x[1
 assert 2 'package main; func main() { var x [2]int64 = [2]int64{1, 2}; return x[1]; }'
 assert 3 'package main; func main() { x:=[2]int64{2, 5}; return x[1]-x[0]; }'
 assert 2 'package main; var x[2]int64=[2]int64{1,3}; func main() { return x[1]-x[0]; }'
+assert 1 'package main; func main() { if [2]int{1, 2} == [2]int{1, 2} { return 1; }; return 0; }'
+assert 1 'package main; func main() { a := [3]int{1, 2, 3}; b := a; b[2] = 4; if a != b { return 1; }; return 0; }'
+assert 3 'package main; type P struct { x, y int }; func main() { a := [2]P{{1, 2}, {3, 4}}; b := a; if a == b { b[1].y = 5; if a != b { return 3; } }; return 0; }'
+assert 1 'package main; func main() { var x interface{} = 1; a := [2]interface{}{x, "a"}; b := [2]interface{}{1, "a"}; if a == b { return 1; }; return 0; }'
 
 echo
 echo 'global variables'
@@ -183,12 +630,77 @@ assert 98 'package main; func main() { hoge:="abc"; return hoge[1]; }'
 assert 99 'package main; func main() { hoge:="abc"; return hoge[2]; }'
 assert 99 'package main; var hoge string="abc"; func main() { return hoge[2]; }'
 
+assert 10 'package main; func main() { return "\n"[0]; }'
+assert 34 'package main; func main() { return "a\"b"[1]; }'
+assert 92 'package main; func main() { return "\\"[0]; }'
+assert 98 'package main; func main() { return "a\tb"[2]; }'
+assert 65 'package main; func main() { return "\x41"[0]; }'
+assert 255 'package main; func main() { return "\xff"[0]; }'
+assert 65 'package main; func main() { return "\101"[0]; }'
+assert 98 'package main; func main() { return "a\000b"[2]; }'
+assert 195 'package main; func main() { return "\u00e9"[0]; }'
+assert 169 'package main; func main() { return "\U000000e9"[1]; }'
+assert 169 'package main; func main() { return "é"[1]; }'
+assert 92 'package main; func main() { return `a\nb`[1]; }'
+assert 98 'package main; func main() { s := `a
+b`; return s[2]; }'
+assert 10 'package main; func main() { s := `a
+b`; return s[1]; }'
+assert 0 'package main; func main() { println("tab:\t quote:\" backslash:\\ \u4e16"); return 0; }'
+assert 41 'package main; func f(s string) int { return int(s[0]); }; func main() { return f(")"); }'
+assert 44 'package main; func main() { s := []string{"}", ",", "{"}; return int(s[1][0]); }'
+assert 3 'package main; func main() { m := map[string]int{":": 3}; return m[":"]; }'
+assert 5 'package main; func main() { n := 0; for n < len("range") { n++; }; return n; }'
+assert 1 'package main; func main() { switch s := "{"; s { case "{": return 1; }; return 0; }'
+assert 71 'package main; func main() { b := []byte("xyz"); b[0] = 65; s := "xyz"; if s[0] == 120 { return int(b[0]) + len(b) + cap(b); } return 0; }'
+assert 105 'package main; func main() { b := []byte{104, 105}; s := string(b); b[1] = 0; return int(s[1]); }'
+assert 1 'package main; func main() { if string(rune(65)) == "A" && string(rune(0x4e16)) == "世" && string(rune(-1)) == "\uFFFD" { return 1; } return 0; }'
+assert 23 'package main; func main() { var r rune = 0x1F600; var i int = 233; var u uint64 = 0xD800; if string(r) == "😀" && string(i) == "é" && string(u) == "\uFFFD" { return len(string(r)) + len(string(i))*10 + len(string(u))*10 - 31; } return 0; }'
+assert 2 'package main; type S string; func main() { x := S([]byte("ab")); return len(x); }'
+assert 63 'package main; func main() { r := []rune("aé世"); s := string(r); if s == "aé世" && r[1] == 233 && r[2] == 19990 { return len(r) + len(s)*10; } return 0; }'
+assert 5 'package main; func main() { s := string([]rune{104, -1, 105}); if s == "h\uFFFDi" { return len(s); } return 0; }'
+assert 100 'package main; func main() { s := "\xffb"; r := []rune(s); return len(r) + int(r[0]-65533) + int(r[1]); }'
+assert 5 'package main; func main() { a := "x"; b := a + "y"; m := map[int]string{}; m[1] += "yz"; m[1] += b; s := ""; for i := 0; i < 3; i++ { s += a; } if m[1] == "yzxy" && s == "xxx" { return len(s) + len(b); } return 0; }'
+assert 3 'package main; type S string; func main() { var a S = "p"; c := a + a + "q"; var e string; e = e + e; if c == "ppq" { return len(c) + len(e); } return 0; }'
+
+echo
+echo 'characters (escapes)'
+echo
+assert 49 "package main; func main() { return '1'; }"
+assert 10 "package main; func main() { return '\\n'; }"
+assert 39 "package main; func main() { return '\\''; }"
+assert 34 "package main; func main() { return '\"'; }"
+assert 255 "package main; func main() { return '\\377'; }"
+assert 127 "package main; func main() { return '\\x7f'; }"
+assert 233 "package main; func main() { return 'é'; }"
+assert 233 "package main; func main() { return '\\u00e9'; }"
+assert 22 "package main; func main() { return '世'; }"
+
 echo
 echo 'comments'
 echo
-assert 1 'package main; func main() { a:=1; // this is a comment.; return a; }'
-assert 1 'package main; var a int64=1; // function description.; func main() { return a; }'
-assert 1 'package main; var a int32=1; // function description.; func main() { return a; } // hoge.'
+assert 1 'package main; func main() { a:=1; // this is a comment.
+return a; }'
+assert 1 'package main; var a int64=1; // function description.
+func main() { return a; }'
+assert 1 'package main; var a int32=1; // function description.
+func main() { return a; } // hoge.'
+assert 1 'package main; func main() { a:=1; // a; b
+return a; }'
+assert 3 'package main; func main() { a:=1 /* a; b */ + 2; return a; }'
+assert 3 'package main
+/*
+ * License header.
+ */
+func main() {
+	a := 1 /* inline */
+	/* a = 2
+	b := 3 */
+	return a + 2 // the end
+}'
+assert 5 'package main; func main() { a := 5 /*
+*/ return a }'
+assert 1 'package main; func main() { return 1 } //'
 
 echo
 echo 'multi-dimensional arrays'
@@ -196,13 +708,258 @@ echo
 assert 42 'package main; var x [2][2]int64; func main() { return 42; }'
 assert 3 'package main; func main() { var x [2][2]int64; x[1][1]=3; return x[1][1]; }'
 assert 99 'package main; func main() { var hoge [2]string; hoge[1]="abc"; return hoge[1][2]; }'
-# TODO: Support initialization for multi-dimentional arrays.
-#assert 3 'package main; func main() { var x [2][2]int64=[2][2]int64{{1,2}, {3,4}}; return x[1][1]; }'
+assert 4 'package main; func main() { var x [2][2]int64=[2][2]int64{{1,2}, {3,4}}; return x[1][1]; }'
 
 echo
 echo 'standard libraries'
 echo
 assert 0 'package main; func main() { println("aa"); return 0; }'
 assert 0 'package main; func main() { a:="abc"; println(a); return 0; }'
+assert 0 'package main; func main() { println("a", 1, -2, true, uint8(255)); print("b", false, "\\n"); return 0; }'
+assert 0 'package main; func main() { var p *int64; println(p); println(); return 0; }'
+
+echo
+echo 'semicolons'
+echo
+assert 6 'package main
+
+func main() {
+	a := 1 +
+		2 +
+		3
+	return a
+}'
+assert 4 'package main
+
+var a int64 = 3
+
+func main() {
+	if a > 2 {
+		a = a + 1
+	}
+	for a < 3 {
+	}
+	return a
+}'
+assert 2 'package main
+
+func main() {
+	x := 1
+	{
+		x = 2
+	}
+	return x
+}'
+assert 5 'package main
+
+func five() {
+	return 5
+}
+
+func main() {
+	return five()
+}'
+
+echo
+echo 'errors'
+echo
+assertError '<input>:1:38: expected ) but got ;' 'package main; func main() { return (1; }'
+assertError '<input>:1:38: unexpected character: @' 'package main; func main() { return 1 @ 2; }'
+assertError '<input>:1:72: invalid operation: operator + (mismatched types int32 and int64)' 'package main; func main() { var a int32 = 1; var b int64 = 2; return a + b; }'
+assertError '<input>:1:39: no new variables on left side of :=' 'package main; func main() { a := 1; a := 2; return a; }'
+assertError '<input>:1:29: expected expression but got )' 'package main; func main() { ); }'
+assertError '<input>:1:36: constant 9223372036854775808 overflows int' 'package main; func main() { return 9223372036854775808; }'
+assertError '<input>:1:36: constant 18446744073709551616 overflows int' 'package main; func main() { return 0x10000000000000000; }'
+assertError "<input>:1:36: invalid digit '8' in octal literal" 'package main; func main() { return 08; }'
+assertError "<input>:1:36: invalid digit '2' in binary literal" 'package main; func main() { return 0b102; }'
+assertError "<input>:1:36: '_' must separate successive digits" 'package main; func main() { return 1__0; }'
+assertError "<input>:1:36: '_' must separate successive digits" 'package main; func main() { return 10_; }'
+assertError '<input>:1:36: hexadecimal literal has no digits' 'package main; func main() { return 0x; }'
+assertError '<input>:1:37: unknown escape sequence' 'package main; func main() { return "\q"[0]; }'
+assertError '<input>:1:37: unknown escape sequence' "package main; func main() { return \"\\'\"[0]; }"
+assertError '<input>:1:37: octal escape value 256 > 255' 'package main; func main() { return "\400"[0]; }'
+assertError '<input>:1:37: escape sequence is invalid Unicode code point' 'package main; func main() { return "\ud800"[0]; }'
+assertError '<input>:1:36: more than one character in rune literal' "package main; func main() { return 'ab'; }"
+assertError "<input>:1:36: empty rune literal or unescaped ' in rune literal" "package main; func main() { return ''; }"
+assertError '<input>:1:36: string literal not terminated' 'package main; func main() { return "abc'
+assertError '<input>:1:36: raw string literal not terminated' 'package main; func main() { return `abc'
+assertError '<input>:1:36: cannot use _ as value' 'package main; func main() { return _; }'
+assertError '<input>:1:31: no new variables on left side of :=' 'package main; func main() { _ := 1; return 0; }'
+assertError '<input>:1:36: unexpected character: €' 'package main; func main() { return €; }'
+assertError '<input>:1:40: invalid operation: operator % not defined on string' 'package main; func main() { return "a" % "b"; }'
+assertError '<input>:1:37: invalid operation: shift count type string, must be integer' 'package main; func main() { x:=1; x <<= "a"; return x; }'
+assertError '<input>:1:38: invalid operation: operator && not defined on untyped int' 'package main; func main() { return 1 && 2; }'
+assertError '<input>:1:42: invalid operation: operator || not defined on untyped int' 'package main; func main() { return 1 < 2 || 2; }'
+assertError '<input>:1:36: invalid operation: operator ! not defined on untyped int' 'package main; func main() { return !1; }'
+assertError '<input>:1:29: comment not terminated' 'package main; func main() { /* return 1 }'
+assertError '<input>:1:46: missing return' 'package main; func main() { return 0; } func f() int64 { }'
+assertError '<input>:1:67: not enough return values' 'package main; func main() { return 0; } func f() (int64, int64) { return 1; }'
+assertError '<input>:1:58: too many return values' 'package main; func main() { return 0; } func f() int64 { return 1, 2; }'
+assertError '<input>:1:65: cannot use value of type string as int64 value in return statement' 'package main; func main() { return 0; } func f() int64 { return "a"; }'
+assertError '<input>:1:75: not enough arguments in call to f' 'package main; func f(a, b int64) int64 { return a; } func main() { return f(1); }'
+assertError '<input>:1:72: too many arguments in call to f' 'package main; func f(a int64) int64 { return a; } func main() { return f(1, 2); }'
+assertError '<input>:1:74: cannot use value of type string as int64 value in argument' 'package main; func f(a int64) int64 { return a; } func main() { return f("a"); }'
+assertError '<input>:1:77: multiple-value (int64, int64) in single-value context' 'package main; func f() (int64, int64) { return 1, 2; } func main() { return f() + 1; }'
+assertError '<input>:1:72: assignment mismatch: 1 variable but f() returns 2 values' 'package main; func f() (int64, int64) { return 1, 2; } func main() { x := f(); return x; }'
+assertError '<input>:1:34: assignment mismatch: 2 variables but 1 value' 'package main; func main() { a, b := 1; return a; }'
+assertError '<input>:1:48: assignment mismatch: 2 variables but 3 values' 'package main; func main() { a, b := 1, 2; a, b = 1, 2, 3; return a; }'
+assertError '<input>:1:78: assignment mismatch: 3 variables but f() returns 2 values' 'package main; func f() (int64, int64) { return 1, 2; } func main() { a, b, c := f(); return a; }'
+assertError '<input>:1:48: no new variables on left side of :=' 'package main; func main() { a, b := 1, 2; a, b := 3, 4; return a; }'
+assertError '<input>:1:32: a repeated on left side of :=' 'package main; func main() { a, a := 1, 2; return a; }'
+assertError '<input>:1:56: non-name on left side of :=' 'package main; func main() { var p *int64; var a int64; *p, a := 1, 2; return a; }'
+assertError '<input>:1:48: cannot use value of type string as int value in assignment' 'package main; func main() { a, b := 1, 2; a, b = "x", 3; return a; }'
+assertError '<input>:1:42: constant 128 overflows int8' 'package main; func main() { var a int8 = 128; return a; }'
+assertError '<input>:1:34: constant 1267650600228229401496703205376 overflows int' 'package main; func main() { a := 1 << 100; return a; }'
+assertError '<input>:1:38: invalid operation: division by zero' 'package main; func main() { return 1 / 0; }'
+assertError '<input>:1:58: constant 200 overflows int8' 'package main; const a int8 = 100; func main() { return a * 2; }'
+assertError '<input>:1:36: cannot use iota outside constant declaration' 'package main; func main() { return iota; }'
+assertError '<input>:1:22: missing init expr for const declaration' 'package main; const a; func main() { return 0; }'
+assertError '<input>:1:28: extra init expr' 'package main; const a = 1, 2; func main() { return 0; }'
+assertError '<input>:1:47: const initializer is not a constant' 'package main; func main() { x := 1; const a = x; return a; }'
+assertError '<input>:1:46: invalid operation: division by zero' 'package main; func main() { a := 4; return a / 0; }'
+assertError '<input>:1:39: invalid operation: division by zero' 'package main; func main() { a := 4; a %= 0; return a; }'
+assertError '<input>:1:75: invalid operation: operator + (mismatched types int8 and int64)' 'package main; const a int8 = 1; const b int64 = 2; func main() { return a + b; }'
+assertError '<input>:1:46: x redeclared in this block' 'package main; func main() { var x int64; var x int64; return 0; }'
+assertError '<input>:1:41: no new variables on left side of :=' 'package main; func f(a int64) int64 { a := 2; return a; } func main() { return 0; }'
+assertError '<input>:1:34: a redeclared in this block' 'package main; var a int64; const a = 1; func main() { return 0; }'
+assertError '<input>:1:42: cannot assign to non-addressable value' 'package main; const c = 1; func main() { c = 2; return 0; }'
+assertError '<input>:1:36: undefined: x' 'package main; func main() { return x; }'
+assertError '<input>:1:36: undefined: g' 'package main; func main() { return g(1); }'
+assertError '<input>:1:44: cannot call non-function x' 'package main; func main() { x := 1; return x(); }'
+assertError '<input>:1:41: cannot use value of type func() int64 as int64 value in assignment' 'package main; func main() { var x int64 = f; return x; } func f() int64 { return 1; }'
+assertError '<input>:1:19: initialization cycle for a' 'package main; var a = b; var b = a; func main() { return 0; }'
+assertError '<input>:1:19: initialization cycle for a' 'package main; var a = f(); func f() int64 { return a; } func main() { return 0; }'
+assertError '<input>:1:21: invalid constant cycle' 'package main; const a = b; const b = a; func main() { return 0; }'
+assertError '<input>:1:33: a redeclared in this block' 'package main; const a = 1; func a() { } func main() { return 0; }'
+assertError '<input>:1:31: non-declaration statement outside function body' 'package main; var a int64 = 1 2; func main() { return 0; }'
+assertError '<input>:1:76: type P has no field or method y' 'package main; type P struct { x int64 }; func main() { p := P{1}; return p.y; }'
+assertError '<input>:1:63: unknown field y in struct literal of type P' 'package main; type P struct { x int64 }; func main() { p := P{y: 1}; return 0; }'
+assertError '<input>:1:66: too many values in struct literal of type P' 'package main; type P struct { x int64 }; func main() { p := P{1, 2}; return 0; }'
+assertError '<input>:1:67: too few values in struct literal of type P' 'package main; type P struct { x, y int64 }; func main() { p := P{1}; return 0; }'
+assertError '<input>:1:72: mixture of field:value and value elements in struct literal' 'package main; type P struct { x, y int64 }; func main() { p := P{x: 1, 2}; return 0; }'
+assertError '<input>:1:72: duplicate field name x in struct literal' 'package main; type P struct { x, y int64 }; func main() { p := P{x: 1, x: 2}; return 0; }'
+assertError '<input>:1:69: cannot use value of type string as int64 value in struct literal' 'package main; type P struct { x, y int64 }; func main() { p := P{x: "a"}; return 0; }'
+assertError '<input>:1:33: invalid recursive type P' 'package main; type P struct { p P }; func main() { return 0; }'
+assertError '<input>:1:46: invalid recursive type A' 'package main; type A [2]B; type B struct { a A }; func main() { return 0; }'
+assertError '<input>:1:20: invalid recursive type A' 'package main; type A = [2]B; type B struct { a A }; func main() { return 0; }'
+assertError '<input>:1:34: duplicate field x' 'package main; type P struct { x, x int64 }; func main() { return 0; }'
+assertError '<input>:1:91: cannot use value of type Q as P value in assignment' 'package main; type P struct { x int64 }; type Q struct { x int64 }; func main() { var p P = Q{1}; return 0; }'
+assertError '<input>:1:63: P (type) is not an expression' 'package main; type P struct { x int64 }; func main() { return P; }'
+assertError '<input>:1:81: cannot use value of type Celsius as int64 value in assignment' 'package main; type Celsius int64; func main() { var c Celsius = 30; var x int64 = c; return 0; }'
+assertError '<input>:1:95: invalid operation: operator + (mismatched types Celsius and int64)' 'package main; type Celsius int64; func main() { var c Celsius = 30; var x int64 = 3; return c + x; }'
+assertError '<input>:1:39: constant 300 overflows int8' 'package main; func main() { x := int8(300); return x; }'
+assertError '<input>:1:34: cannot convert value of type string to type int64' 'package main; func main() { x := int64("a"); return x; }'
+assertError '<input>:1:48: array index 2 out of bounds [0:2]' 'package main; func main() { x := [2]int8{1, 2, 3}; return 0; }'
+assertError '<input>:1:22: invalid recursive type T' 'package main; type T T; func main() { return 0; }'
+assertError '<input>:1:37: x is not a type' 'package main; var x int64; func f(a x) { } func main() { return 0; }'
+assertError '<input>:1:34: use of untyped nil in assignment' 'package main; func main() { x := nil; return 0; }'
+assertError '<input>:1:41: cannot use nil as int64 value in assignment' 'package main; func main() { var x int64 = nil; return 0; }'
+assertError '<input>:1:40: invalid operation: operator == not defined on nil' 'package main; func main() { return nil == nil; }'
+assertError '<input>:1:34: len (built-in function len) must be called' 'package main; func main() { x := len; return 0; }'
+assertError '<input>:1:43: constant 256 overflows uint8' 'package main; func main() { var x uint8 = 256; return 0; }'
+assertError '<input>:1:42: constant -1 overflows uint' 'package main; func main() { var x uint = -1; return 0; }'
+assertError '<input>:1:48: invalid operation: operator ^ not defined on bool' 'package main; func main() { var b bool; return ^b; }'
+assertError '<input>:1:40: invalid argument: int for built-in len' 'package main; func main() { return len(1); }'
+assertError '<input>:1:29: not enough arguments for len() (expected 1, found 0)' 'package main; func main() { len(); return 0; }'
+assertError '<input>:1:40: illegal types for operand: println (type struct{})' 'package main; func main() { println(1, struct{}{}); return 0; }'
+assertError '<input>:1:34: cannot use iota outside constant declaration' 'package main; func main() { x := iota; return x; }'
+assertError '<input>:1:61: invalid operation: slice can only be compared to nil' 'package main; func main() { x := 1; s := []int{x}; return s == s; }'
+assertError '<input>:1:43: invalid argument: untyped int is not a slice' 'package main; func main() { return append(1, 2); }'
+assertError '<input>:1:46: invalid argument: length and capacity swapped' 'package main; func main() { s := make([]int, 3, 1); return 0; }'
+assertError '<input>:1:47: invalid operation: 3-index slice of string' 'package main; func main() { s := "abc"; t := s[0:1:2]; return 0; }'
+assertError '<input>:1:81: invalid operation: slice of unaddressable value' 'package main; func f() [3]int { var a [3]int; return a; } func main() { s := f()[:]; return 0; }'
+assertError '<input>:1:34: invalid argument: cannot make int; type must be slice or map' 'package main; func main() { s := make(int); return 0; }'
+assertError '<input>:1:66: invalid argument: arguments to copy []int and []int8 have different element types' 'package main; func main() { a := make([]int, 1); b := []int8{1}; copy(a, b); return 0; }'
+assertError '<input>:1:56: cannot use value of type string as int value in argument to append' 'package main; func main() { var s []int; s = append(s, "a"); return 0; }'
+assertError '<input>:1:42: middle index required in 3-index slice' 'package main; func main() { s := "abc"[::2]; return 0; }'
+assertError '<input>:1:53: invalid argument: index -1 must not be negative' 'package main; func main() { s := []int{1}; return s[-1]; }'
+assertError '<input>:1:50: invalid slice indices: 1 < 2' 'package main; func main() { s := []int{1}; t := s[2:1]; return 0; }'
+assertError '<input>:1:34: invalid operation: make([]int) expects 2 or 3 arguments; found 1' 'package main; func main() { s := make([]int); return 0; }'
+assertError '<input>:1:39: invalid map key type []int' 'package main; func main() { var m map[[]int]int; return 0; }'
+assertError '<input>:1:58: cannot use value of type string as int value in map index' 'package main; func main() { m := map[int]int{}; return m["a"]; }'
+assertError '<input>:1:52: duplicate key 1 in map literal' 'package main; func main() { m := map[int]int{1: 2, 1: 3}; return 0; }'
+assertError '<input>:1:46: missing key in map literal' 'package main; func main() { m := map[int]int{2}; return 0; }'
+assertError '<input>:1:62: invalid operation: map can only be compared to nil' 'package main; func main() { m := map[int]int{}; n := m; if m == n { return 1; } return 0; }'
+assertError '<input>:1:36: invalid argument: []int is not a map' 'package main; func main() { delete([]int{1}, 0); return 0; }'
+assertError '<input>:1:34: invalid operation: make(map[int]int) expects 1 or 2 arguments; found 3' 'package main; func main() { m := make(map[int]int, 1, 2); return 0; }'
+assertError '<input>:1:54: invalid operation: cannot take address of map index expression of type int' 'package main; func main() { m := map[int]int{}; p := &m[1]; return 0; }'
+assertError '<input>:1:62: invalid operation: cannot take address of non-addressable value' 'package main; func f() int { return 1; }; func main() { p := &f(); return *p; }'
+assertError '<input>:1:34: invalid operation: cannot take address of non-addressable value' 'package main; func main() { p := &3; return *p; }'
+assertError '<input>:1:87: invalid operation: cannot take address of non-addressable value' 'package main; type T struct { x int }; func f() T { return T{}; }; func main() { p := &f().x; return *p; }'
+assertError '<input>:1:70: cannot assign to non-addressable value' 'package main; func f() [2]int { return [2]int{}; }; func main() { f()[1] = 2; return 0; }'
+assertError '<input>:1:86: cannot assign to non-addressable value' 'package main; type T struct { x int }; func f() T { return T{}; }; func main() { f().x = 1; return 0; }'
+assertError '<input>:1:86: cannot assign to non-addressable value' 'package main; type T struct { x int }; func f() T { return T{}; }; func main() { f().x++; return 0; }'
+assertError '<input>:1:42: cannot assign to non-addressable value' 'package main; func main() { s := "abc"; s[0] = 120; return 0; }'
+assertError '<input>:1:46: invalid operation: cannot take address of non-addressable value' 'package main; func main() { s := "abc"; p := &s[0]; return int(*p); }'
+assertError '<input>:1:73: cannot assign to a part of a map entry' 'package main; type P struct { x int }; func main() { m := map[int]P{}; m[1].x = 2; return 0; }'
+assertError '<input>:1:44: cannot range over bool' 'package main; func main() { for i := range true { } return 0; }'
+assertError '<input>:1:36: range over int permits only one iteration variable' 'package main; func main() { for i, j := range 10 { } return 0; }'
+assertError '<input>:1:39: range clause permits at most two iteration variables' 'package main; func main() { for a, b, c := range "abc" { } return 0; }'
+assertError '<input>:1:57: undefined: i' 'package main; func main() { for i := range 3 { } return i; }'
+assertError '<input>:1:34: goto L jumps over variable declaration at line 1' 'package main; func main() { goto L; x := 1; L: return x; }'
+assertError '<input>:1:34: goto L jumps into block' 'package main; func main() { goto L; { L: }; return 0; }'
+assertError '<input>:1:29: label L declared and not used' 'package main; func main() { L: return 0; }'
+assertError '<input>:1:34: label M not declared' 'package main; func main() { goto M; return 0; }'
+assertError '<input>:1:32: label L already declared' 'package main; func main() { L: L: for { }; return 0; }'
+assertError '<input>:1:29: break is not in a loop, switch, or select' 'package main; func main() { break; return 0; }'
+assertError '<input>:1:29: continue is not in a loop' 'package main; func main() { continue; return 0; }'
+assertError '<input>:1:53: invalid break label L' 'package main; func main() { L: for { }; for { break L; }; return 0; }'
+assertError '<input>:1:49: invalid continue label L' 'package main; func main() { L: { for { continue L; } }; return 0; }'
+assertError '<input>:1:20: missing return' 'package main; func f() int { for { break; } } func main() { return 0; }'
+assertError '<input>:1:49: multiple defaults in switch' 'package main; func main() { switch 1 { default: default: }; return 0; }'
+assertError '<input>:1:48: cannot fallthrough final case in switch' 'package main; func main() { switch 1 { case 1: fallthrough; }; return 0; }'
+assertError '<input>:1:48: fallthrough statement out of place' 'package main; func main() { switch 1 { case 1: fallthrough; println(); case 2: }; return 0; }'
+assertError '<input>:1:59: duplicate case 1 in expression switch' 'package main; func main() { x := 1; switch x { case 1, 2, 1: }; return 0; }'
+assertError '<input>:1:43: invalid case in switch (mismatched types int and bool)' 'package main; func main() { switch { case 1: }; return 0; }'
+assertError '<input>:1:67: invalid continue label L' 'package main; func main() { L: switch { case true: for { continue L; } }; return 0; }'
+assertError '<input>:1:20: missing return' 'package main; func f(x int) int { switch x { case 1: return 1; } } func main() { return f(1); }'
+assertError '<input>:1:58: method T.M already declared' 'package main; type T int; func (t T) M() {}; func (t *T) M() {}; func main() { return 0; }'
+assertError '<input>:1:51: field and method with the same name M' 'package main; type T struct { M int }; func (t T) M() {}; func main() { return 0; }'
+assertError '<input>:1:21: cannot define new methods on non-local type int' 'package main; func (x int) M() {}; func main() { return 0; }'
+assertError '<input>:1:34: invalid receiver type P (pointer or interface type)' 'package main; type P *int; func (p P) M() {}; func main() { return 0; }'
+assertError '<input>:1:36: method has multiple receivers' 'package main; type T int; func (a, b T) M() {}; func main() { return 0; }'
+assertError '<input>:1:91: cannot call pointer method T.M on T' 'package main; type T int; func (t *T) M() {}; func f() T { return 1; }; func main() { f().M(); return 0; }'
+assertError '<input>:1:63: invalid method expression T.M (needs pointer receiver (*T).M)' 'package main; type T int; func (t *T) M() {}; func main() { T.M(1); return 0; }'
+assertError '<input>:1:62: T.N undefined (type T has no method N)' 'package main; type T int; func (t T) M() {}; func main() { T.N(1); return 0; }'
+assertError '<input>:1:86: cannot use value of type func() as func() int value in assignment' 'package main; type T int; func (t T) M() {}; func main() { var x T; var f func() int = x.M; return 0; }'
+assertError '<input>:1:64: invalid operation: cannot call non-function of type int' 'package main; type T struct{ f int }; func main() { var x T; x.f(); return 0; }'
+assertError '<input>:1:76: not enough arguments in call to T.M' 'package main; type T int; func (t T) M(a int) {}; func main() { var x T; x.M(); return 0; }'
+assertError '<input>:1:81: type U has no field or method M' 'package main; type T int; type U T; func (t T) M() {}; func main() { var x U; x.M(); return 0; }'
+assertError '<input>:1:75: cannot use value of type T as I value in assignment: T does not implement I (missing method M)' 'package main; type I interface { M() }; type T int; func main() { var i I = T(1); return 0; }'
+assertError '<input>:1:95: cannot use value of type T as I value in assignment: T does not implement I (method M has pointer receiver)' 'package main; type I interface { M() }; type T int; func (t *T) M() {}; func main() { var i I = T(1); return 0; }'
+assertError '<input>:1:98: cannot use value of type T as I value in assignment: T does not implement I (wrong type for method M)' 'package main; type I interface { M() int }; type T int; func (t T) M() {}; func main() { var i I = T(1); return 0; }'
+assertError '<input>:1:39: duplicate method M' 'package main; type I interface { M(); M() }; func main() { return 0; }'
+assertError '<input>:1:34: invalid recursive type I' 'package main; type I interface { I }; func main() { var i I; return 0; }'
+assertError '<input>:1:72: invalid operation: operator < not defined on interface{}' 'package main; func main() { var a interface{}; var b interface{}; if a < b { return 1; }; return 0; }'
+assertError '<input>:1:66: too many arguments in call to M' 'package main; type I interface { M() }; func main() { var i I; i.M(1); return 0; }'
+assertError '<input>:1:103: cannot use value of type I as J value in assignment: I does not implement J (missing method N)' 'package main; type I interface { M() }; type J interface { M(); N() }; func main() { var i I; var j J = i; return 0; }'
+assertError '<input>:1:45: invalid operation: value of type int is not an interface' 'package main; func main() { x := 1; return x.(int); }'
+assertError '<input>:1:72: impossible type assertion: int does not implement I (missing method M)' 'package main; type I interface { M() }; func main() { var i I; return i.(int); }'
+assertError '<input>:1:58: use of .(type) outside type switch' 'package main; func main() { var e interface{}; return e.(type); }'
+assertError '<input>:1:66: duplicate case int in type switch' 'package main; func main() { var e interface{}; switch e.(type) { case int, int: }; return 0; }'
+assertError '<input>:1:76: multiple nil cases in type switch' 'package main; func main() { var e interface{}; switch e.(type) { case nil: case nil: }; return 0; }'
+assertError '<input>:1:82: impossible type switch case: int does not implement I (missing method M)' 'package main; type I interface { M() }; func main() { var i I; switch i.(type) { case int: }; return 0; }'
+assertError '<input>:1:76: cannot fallthrough in type switch' 'package main; func main() { var e interface{}; switch e.(type) { case int: fallthrough; case string: }; return 0; }'
+assertError '<input>:1:71: expected type but got 1' 'package main; func main() { var e interface{}; switch e.(type) { case 1: }; return 0; }'
+assertError '<input>:1:55: invalid operation: func can only be compared to nil' 'package main; func f() {}; func main() { g := f; if f == g { return 1; }; return 0; }'
+assertError '<input>:1:60: cannot use value of type func(int) as func() value in assignment' 'package main; func f(x int) {}; func main() { var g func() = f; return 0; }'
+assertError '<input>:1:51: invalid map key type func()' 'package main; func f() {}; func main() { m := map[func()]int{}; return 0; }'
+assertError '<input>:1:55: invalid operation: operator < not defined on func()' 'package main; func f() {}; func main() { g := f; if g < nil { return 1; }; return 0; }'
+assertError '<input>:1:71: cannot call pointer method T.M on T' 'package main; type T int; func (t *T) M() {}; func main() { f := T(1).M; return 0; }'
+assertError '<input>:1:79: invalid operation: operator == not defined on P' 'package main; type P struct { s []int }; func main() { a, b := P{}, P{}; if a == b { return 1; }; return 0; }'
+assertError '<input>:1:69: invalid operation: operator < not defined on P' 'package main; type P struct { x int }; func main() { p := P{}; if p < p { return 1; }; return 0; }'
+assertError '<input>:1:40: invalid operation: operator - not defined on string' 'package main; func main() { return "a" - "b"; }'
+assertError '<input>:1:74: cannot use value of type S as string value in assignment' 'package main; type S string; const x S = "a"; func main() { var y string = x; return len(y); }'
+assertError '<input>:1:71: cannot use value of type B as bool value in assignment' 'package main; type B bool; const x B = true; func main() { var y bool = x; if y { return 1; } return 0; }'
+assertError '<input>:1:81: invalid operation: operator + (mismatched types S and string)' 'package main; type S string; const x S = "a"; const y string = "b"; const z = x + y; func main() { return 0; }'
+assertError '<input>:1:34: cannot convert value of type []int64 to type string' 'package main; func main() { s := string([]int64{1}); return len(s); }'
+assertError '<input>:1:49: cannot use value of type int as int64 value in assignment' 'package main; func main() { a := 1; var b int64 = a; return b; }'
+assertError '<input>:1:57: cannot use value of type uintptr as uint64 value in assignment' 'package main; func main() { var a uintptr; var b uint64 = a; return 0; }'
+assertError '<input>:1:55: invalid operation: operator < not defined on bool' 'package main; func main() { a, b := true, false; if a < b { return 1; } return 0; }'
+assertError '<input>:1:58: invalid operation: operator < not defined on *int' 'package main; func main() { x := 1; p, q := &x, &x; if p < q { return 1; } return 0; }'
+assertError '<input>:1:47: invalid operation: operator >= not defined on []int' 'package main; func main() { var s []int; if s >= nil { return 1; } return 0; }'
+assertError '<input>:1:53: invalid operation: operator < not defined on map[int]int' 'package main; func main() { var m map[int]int; if m < nil { return 1; } return 0; }'
+assertError '<input>:1:41: invalid operation: operator - not defined on string' 'package main; func main() { s := "a"; s -= "b"; return 0; }'
+assertError '<input>:1:31: mixed named and unnamed parameters' 'package main; func f(a int64, int64) int64 { return a; } func main() { return 0; }'
 
 echo OK
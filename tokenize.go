@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var tokens []Token
@@ -14,143 +16,421 @@ type TokenKind int
 const (
 	TK_RESERVED TokenKind = iota // Keywords or punctuators
 	TK_IDENT                     // Identifiers
-	TK_TYPE                      // Types
 	TK_NUM                       // Integer literals
 	TK_STRING                    // String literals
-	TK_LIBS                      // Call standard libraies
+	TK_CHAR                      // Rune literals
 )
 
+// Pos is a position in a source file. Both line and col start at 1, and
+// col counts bytes like the official Go tools do.
+type Pos struct {
+	file string
+	line int
+	col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.file, p.line, p.col)
+}
+
 type Token struct {
 	kind TokenKind
 	val  int
 	str  string
+	pos  Pos
 }
 
-func tokenError(f string, vars ...string) {
-	// TODO: improve an error message and place
-	n := len(userIn) - len(in)
-	fmt.Println(userIn)
-	fmt.Println(strings.Repeat(" ", n) + "^")
-	fmt.Println(f, vars)
+// The position of the last scanned byte. It moves forward lazily in
+// curPos() because `in` is consumed from its head.
+var posOff int = 0
+var posLine int = 1
+var posCol int = 1
+
+// eofPos is the position just after the last token.
+var eofPos Pos
+
+func curPos() Pos {
+	off := len(userIn) - len(in)
+	for ; posOff < off; posOff++ {
+		if userIn[posOff] == '\n' {
+			posLine++
+			posCol = 1
+		} else {
+			posCol++
+		}
+	}
+	return Pos{filename, posLine, posCol}
+}
+
+// sourceLine returns the n-th line of the input without a newline.
+func sourceLine(n int) string {
+	lines := strings.Split(userIn, "\n")
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return lines[n-1]
+}
+
+// errorAt prints a message like `file.go:12:7: expected ) but got ;`
+// followed by the source line and a caret under the column, and exits.
+func errorAt(pos Pos, format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", pos, fmt.Sprintf(format, a...))
+	line := sourceLine(pos.line)
+	if line == "" {
+		os.Exit(1)
+	}
+	// Keep tabs so that the caret lines up with the excerpt.
+	indent := ""
+	for i := 0; i < pos.col-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent += "\t"
+		} else {
+			indent += " "
+		}
+	}
+	fmt.Fprintln(os.Stderr, line)
+	fmt.Fprintln(os.Stderr, indent+"^")
 	os.Exit(1)
 }
 
+func tokenError(f string, vars ...interface{}) {
+	errorAt(curPos(), f, vars...)
+}
+
 func isNum(b byte) bool {
 	_, err := strconv.Atoi(string(b))
 	return err == nil
 }
 
-func getNum() int {
-	n := 0
-	for len(in) > 0 && '0' <= in[0] && in[0] <= '9' {
-		n = n*10 + int(in[0]-'0')
+// digitVal returns the value of a hexadecimal digit, or 16 if b is not a
+// digit.
+func digitVal(b byte) int {
+	switch {
+	case '0' <= b && b <= '9':
+		return int(b - '0')
+	case 'a' <= b && b <= 'f':
+		return int(b - 'a' + 10)
+	case 'A' <= b && b <= 'F':
+		return int(b - 'A' + 10)
+	}
+	return 16
+}
+
+// getNum reads an integer literal starting at pos and returns its text.
+// The value is arbitrary precision and evaluated by the parser.
+//
+// int_lit     = decimal_lit | binary_lit | octal_lit | hex_lit .
+// decimal_lit = "0" | ( "1" … "9" ) [ [ "_" ] decimal_digits ] .
+// binary_lit  = "0" ( "b" | "B" ) [ "_" ] binary_digits .
+// octal_lit   = "0" [ "o" | "O" ] [ "_" ] octal_digits .
+// hex_lit     = "0" ( "x" | "X" ) [ "_" ] hex_digits .
+func getNum(pos Pos) string {
+	start := in
+	base := 10
+	name := "decimal"
+	if len(in) >= 2 && in[0] == '0' {
+		switch in[1] {
+		case 'x', 'X':
+			base, name = 16, "hexadecimal"
+			in = in[2:]
+		case 'b', 'B':
+			base, name = 2, "binary"
+			in = in[2:]
+		case 'o', 'O':
+			base, name = 8, "octal"
+			in = in[2:]
+		default:
+			if isNum(in[1]) || in[1] == '_' {
+				base, name = 8, "octal"
+				in = in[1:]
+			}
+		}
+	}
+
+	// Read all hexadecimal digits and `_` to report invalid digits.
+	digits := ""
+	prevSep := false // `_` is also allowed just after a base prefix.
+	for len(in) > 0 && (digitVal(in[0]) < 16 || in[0] == '_') {
+		if in[0] == '_' {
+			if prevSep {
+				errorAt(pos, "'_' must separate successive digits")
+			}
+			prevSep = true
+		} else {
+			if digitVal(in[0]) >= base {
+				errorAt(pos, "invalid digit %q in %s literal", in[0], name)
+			}
+			digits += in[0:1]
+			prevSep = false
+		}
 		in = in[1:]
 	}
-	return n
+	str := start[:len(start)-len(in)]
+	if len(digits) == 0 {
+		errorAt(pos, "%s literal has no digits", name)
+	}
+	if prevSep {
+		errorAt(pos, "'_' must separate successive digits")
+	}
+	return str
 }
 
-func isAlpha(b byte) bool {
-	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+// letter = unicode_letter | "_" .
+func isLetter(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
 }
 
-func isAlnum(b byte) bool {
-	return isNum(b) || isAlpha(b)
+func isLetterOrDigit(r rune) bool {
+	return isLetter(r) || unicode.IsDigit(r)
+}
+
+// isWordEnd reports whether a keyword or an identifier ends at the head
+// of s.
+func isWordEnd(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return !isLetterOrDigit(r)
 }
 
 func startReserved() string {
-	keywords := []string{"return", "if", "else", "for", "func", "var", "package"}
+	keywords := []string{"return", "if", "else", "for", "break", "continue", "goto", "switch", "case", "default", "fallthrough", "range", "func", "var", "const", "type", "struct", "interface", "map", "package"}
 	for _, kw := range keywords {
 		if strings.HasPrefix(in, kw) {
-			if len(kw) == len(in) || !isAlnum(in[len(kw)]) {
+			if isWordEnd(in[len(kw):]) {
 				return kw
 			}
 		}
 	}
 
-	ops := []string{"==", "!=", "<=", ">=", ":="}
+	// Longer operators come first.
+	ops := []string{
+		"<<=", ">>=", "&^=", "...",
+		"==", "!=", "<=", ">=", ":=", "&&", "||", "<-", "++", "--",
+		"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<", ">>", "&^",
+	}
 	for _, op := range ops {
 		if strings.HasPrefix(in, op) {
 			return op
 		}
 	}
 
-	if strings.Contains("+-*/()<>;={},&[]'", in[0:1]) {
+	if strings.Contains("+-*/%&|^<>=!()[]{},;.:", in[0:1]) {
 		return in[0:1]
 	}
 	return ""
 }
 
-func startLib() string {
-	stdlibs := []string{"println"}
-	for _, lib := range stdlibs {
-		if strings.HasPrefix(in, lib) {
-			if len(lib) == len(in) || !isAlnum(in[len(lib)]) {
-				return lib
-			}
-		}
+// needSemicolon reports whether a semicolon is automatically inserted
+// after tok when it is the final token of a line. The rule follows
+// https://golang.org/ref/spec#Semicolons.
+func needSemicolon(tok Token) bool {
+	switch tok.kind {
+	case TK_IDENT, TK_NUM, TK_STRING, TK_CHAR:
+		return true
 	}
-	return ""
-}
-
-func startType() string {
-	typeStrs := []string{"bool", "int", "int8", "int32", "int64", "string"}
-	for _, t := range typeStrs {
-		if strings.HasPrefix(in, t) {
-			if len(t) == len(in) || !isAlnum(in[len(t)]) {
-				return t
-			}
-		}
+	switch tok.str {
+	case "break", "continue", "fallthrough", "return", "++", "--", ")", "]", "}":
+		return true
 	}
-	return ""
+	return false
 }
 
-func insertEnd() {
+func insertEnd(tokens []Token) []Token {
 	if len(tokens) < 1 {
-		return
-	}
-	if strings.Contains("{}", tokens[len(tokens)-1].str) {
-		return
+		return tokens
 	}
-	if tokens[len(tokens)-1].str == ";" {
-		return
+	if !needSemicolon(tokens[len(tokens)-1]) {
+		return tokens
 	}
-	tokens = append(tokens, Token{TK_RESERVED, -1, ";"})
+	return append(tokens, Token{TK_RESERVED, -1, ";", curPos()})
 }
 
+// readLine reads the rest of the line. `\n` is left for semicolon
+// insertion.
 func readLine() string {
-	str := in[0:1]
-	in = in[1:]
-	for len(in) > 0 && in[0] != '\n' && in[0] != ';' {
-		str += in[0:1]
-		in = in[1:]
+	idx := strings.IndexByte(in, '\n')
+	if idx < 0 {
+		idx = len(in)
 	}
-	if len(in) > 0 {
-		// Remove `\n` or `;`.
-		in = in[1:]
+	str := in[:idx]
+	in = in[idx:]
+	return str
+}
+
+// readComment reads a general comment `/* ... */`.
+func readComment() string {
+	idx := strings.Index(in[2:], "*/")
+	if idx < 0 {
+		tokenError("comment not terminated")
 	}
+	str := in[:idx+4]
+	in = in[idx+4:]
 	return str
 }
 
-func readUntil(s string) string {
-	str := ""
-	for in[0:1] != s {
-		str += in[0:1]
+// readDigits reads n digits in base and returns their value.
+func readDigits(n int, base int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if len(in) == 0 {
+			tokenError("escape sequence not terminated")
+		}
+		d := digitVal(in[0])
+		if d >= base {
+			tokenError("illegal character %q in escape sequence", in[0])
+		}
+		v = v*base + d
 		in = in[1:]
-		if in[0:1] == "\n" {
-			panic("expected end of string '\"' but got \\n")
+	}
+	return v
+}
+
+// readEscape reads an escape sequence starting with `\` in a literal
+// quoted by quote. It returns the value and whether the value is a
+// single byte (`\x` and octal escapes) rather than a Unicode code point.
+func readEscape(quote byte) (int, bool) {
+	pos := curPos()
+	in = in[1:]
+	if len(in) == 0 {
+		errorAt(pos, "escape sequence not terminated")
+	}
+	c := in[0]
+	in = in[1:]
+	switch c {
+	case 'a':
+		return 7, false
+	case 'b':
+		return 8, false
+	case 'f':
+		return 12, false
+	case 'n':
+		return 10, false
+	case 'r':
+		return 13, false
+	case 't':
+		return 9, false
+	case 'v':
+		return 11, false
+	case '\\':
+		return '\\', false
+	case '\'', '"':
+		if c != quote {
+			errorAt(pos, "unknown escape sequence")
+		}
+		return int(c), false
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		v := int(c-'0')*64 + readDigits(2, 8)
+		if v > 255 {
+			errorAt(pos, "octal escape value %d > 255", v)
+		}
+		return v, true
+	case 'x':
+		return readDigits(2, 16), true
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		v := readDigits(n, 16)
+		if v > unicode.MaxRune || (0xD800 <= v && v < 0xE000) {
+			errorAt(pos, "escape sequence is invalid Unicode code point")
 		}
+		return v, false
 	}
-	return str
+	errorAt(pos, "unknown escape sequence")
+	return 0, false
 }
 
-func readChunk() string {
-	str := in[0:1]
+// readString reads an interpreted string literal and returns its value.
+func readString() string {
+	pos := curPos()
 	in = in[1:]
-	for len(in) > 0 && isAlnum(in[0]) && in[0] != '\n' {
+	str := ""
+	for {
+		if len(in) == 0 {
+			errorAt(pos, "string literal not terminated")
+		}
+		if in[0] == '\n' {
+			tokenError("newline in string")
+		}
+		if in[0] == '"' {
+			in = in[1:]
+			return str
+		}
+		if in[0] == '\\' {
+			v, isByte := readEscape('"')
+			if isByte {
+				str += string([]byte{byte(v)})
+			} else {
+				str += string(rune(v))
+			}
+			continue
+		}
 		str += in[0:1]
 		in = in[1:]
 	}
-	return str
+}
+
+// readRawString reads a raw string literal quoted by backquotes. Carriage
+// returns are discarded from the value.
+func readRawString() string {
+	idx := strings.IndexByte(in[1:], '`')
+	if idx < 0 {
+		tokenError("raw string literal not terminated")
+	}
+	str := in[1 : idx+1]
+	in = in[idx+2:]
+	return strings.Replace(str, "\r", "", -1)
+}
+
+// readChar reads a rune literal and returns its value.
+func readChar() int {
+	pos := curPos()
+	in = in[1:]
+	n := 0
+	v := 0
+	for {
+		if len(in) == 0 || in[0] == '\n' {
+			errorAt(pos, "rune literal not terminated")
+		}
+		if in[0] == '\'' {
+			in = in[1:]
+			break
+		}
+		if in[0] == '\\' {
+			v, _ = readEscape('\'')
+		} else {
+			r, size := utf8.DecodeRuneInString(in)
+			if r == utf8.RuneError && size == 1 {
+				tokenError("invalid UTF-8 encoding")
+			}
+			v = int(r)
+			in = in[size:]
+		}
+		n++
+	}
+	if n == 0 {
+		errorAt(pos, "empty rune literal or unescaped ' in rune literal")
+	}
+	if n > 1 {
+		errorAt(pos, "more than one character in rune literal")
+	}
+	return v
+}
+
+// identifier = letter { letter | unicode_digit } .
+func readIdent() string {
+	start := in
+	for len(in) > 0 {
+		r, size := utf8.DecodeRuneInString(in)
+		if !isLetterOrDigit(r) {
+			break
+		}
+		in = in[size:]
+	}
+	return start[:len(start)-len(in)]
 }
 
 func tokenize() []Token {
@@ -161,71 +441,69 @@ func tokenize() []Token {
 			continue
 		}
 		if in[0] == '\n' {
-			insertEnd()
+			tokens = insertEnd(tokens)
 			in = in[1:]
 			continue
 		}
-		if len(in) > 2 && in[0:2] == "//" {
-			// Ignore comments.
-			in = in[2:]
+		// Ignore comments.
+		if strings.HasPrefix(in, "//") {
 			_ = readLine()
 			continue
 		}
-
-		lib := startLib()
-		if len(lib) != 0 {
-			tokens = append(tokens, Token{TK_LIBS, -1, lib})
-			in = in[len(lib):]
+		if strings.HasPrefix(in, "/*") {
+			// A general comment containing newlines acts like a newline.
+			if strings.Contains(readComment(), "\n") {
+				tokens = insertEnd(tokens)
+			}
 			continue
 		}
 
-		ty := startType()
-		if len(ty) != 0 {
-			tokens = append(tokens, Token{TK_TYPE, -1, ty})
-			in = in[len(ty):]
-			continue
-		}
+		pos := curPos()
 
 		kw := startReserved()
 		if len(kw) != 0 {
-			tokens = append(tokens, Token{TK_RESERVED, -1, kw})
+			tokens = append(tokens, Token{TK_RESERVED, -1, kw, pos})
 			in = in[len(kw):]
 			continue
 		}
 
 		// String.
-		if in[0:1] == "\"" {
-			tokens = append(tokens, Token{TK_RESERVED, -1, "\""})
-			in = in[1:]
-			str := readUntil("\"")
-			tokens = append(tokens, Token{TK_STRING, -1, str})
-			tokens = append(tokens, Token{TK_RESERVED, -1, "\""})
-			in = in[1:]
+		if in[0] == '"' {
+			tokens = append(tokens, Token{TK_STRING, -1, readString(), pos})
+			continue
+		}
+		if in[0] == '`' {
+			tokens = append(tokens, Token{TK_STRING, -1, readRawString(), pos})
 			continue
 		}
 
-		if isAlpha(in[0]) {
-			// Character.
-			if tokens[len(tokens)-1].str == "'" {
-				tokens = append(tokens, Token{TK_NUM, int(in[0]), in[0:1]})
-				in = in[1:]
-				if in[0] != '\'' {
-					panic("invalid character literal (more than one character)")
-				}
-				continue
-			}
+		// Character.
+		if in[0] == '\'' {
+			start := in
+			v := readChar()
+			tokens = append(tokens, Token{TK_CHAR, v, start[:len(start)-len(in)], pos})
+			continue
+		}
 
+		r, _ := utf8.DecodeRuneInString(in)
+		if isLetter(r) {
 			// Variable.
-			str := readChunk()
-			tokens = append(tokens, Token{TK_IDENT, -1, str})
+			str := readIdent()
+			tokens = append(tokens, Token{TK_IDENT, -1, str, pos})
 			continue
 		}
 
 		if isNum(in[0]) {
-			tokens = append(tokens, Token{TK_NUM, getNum(), ""})
+			str := getNum(pos)
+			tokens = append(tokens, Token{TK_NUM, -1, str, pos})
 			continue
 		}
-		tokenError("unexcected character:", in[0:1])
+		if r == utf8.RuneError {
+			tokenError("invalid UTF-8 encoding")
+		}
+		tokenError("unexpected character: %c", r)
 	}
+	tokens = insertEnd(tokens)
+	eofPos = curPos()
 	return tokens
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 type TypeKind int
@@ -13,101 +15,1823 @@ const (
 	TY_BOOL
 	TY_INT
 	TY_INT8
+	TY_INT16
 	TY_INT32
 	TY_INT64
+	TY_UINT8
+	TY_UINT16
+	TY_UINT32
+	TY_UINT64
+	TY_UINT
+	TY_UINTPTR
 	TY_STRING
 
 	TY_PTR
 
 	TY_ARRAY
+
+	TY_SLICE
+
+	TY_MAP
+
+	TY_STRUCT
+
+	TY_INTERFACE
+
+	TY_FUNC
+
+	TY_TUPLE // Results of a function call returning multiple values.
+
+	// Kinds of untyped constants.
+	TY_UNTYPED_INT
+	TY_UNTYPED_RUNE
+	TY_UNTYPED_BOOL
+	TY_UNTYPED_NIL
 )
 
-type Type struct {
-	kind   TypeKind
-	base   *Type
-	size   int // default is 0.
-	aryLen int // default is 1.
+type Type struct {
+	kind   TypeKind
+	base   *Type
+	size   int      // default is 0. It is -1 while a struct is being declared.
+	aryLen int      // default is 1.
+	elems  []*Type  // Types in a tuple.
+	name   string   // Name of a declared type such as `T` in `type T struct{}`.
+	fields []*Field // Fields of a struct.
+	key    *Type    // Key type of a map. base is the value type.
+
+	// Methods declared with this type as the receiver base type, or the
+	// methods of an interface without receivers.
+	methods []*Function
+
+	sig *Function // Parameters and results of a function type.
+}
+
+// Field is a field of a struct. offset is in bytes from the start of the
+// struct.
+type Field struct {
+	name   string
+	ty     *Type
+	offset int
+	pos    Pos
+}
+
+func typeKind(s string) TypeKind {
+	switch s {
+	case "bool":
+		return TY_BOOL
+	case "int8":
+		return TY_INT8
+	case "int16":
+		return TY_INT16
+	case "int32":
+		return TY_INT32
+	case "int":
+		return TY_INT
+	case "int64":
+		return TY_INT64
+	case "uint8":
+		return TY_UINT8
+	case "uint16":
+		return TY_UINT16
+	case "uint32":
+		return TY_UINT32
+	case "uint":
+		return TY_UINT
+	case "uint64":
+		return TY_UINT64
+	case "uintptr":
+		return TY_UINTPTR
+	case "string":
+		return TY_STRING
+	case "pointer":
+		return TY_PTR
+	case "array":
+		return TY_ARRAY
+	case "slice":
+		return TY_SLICE
+	case "map":
+		return TY_MAP
+	case "interface":
+		return TY_INTERFACE
+	default:
+		return TY_NONE
+	}
+}
+
+func typeSize(k TypeKind) int {
+	switch k {
+	case TY_BOOL:
+		return 1
+	case TY_INT8, TY_UINT8:
+		return 1
+	case TY_INT16, TY_UINT16:
+		return 2
+	case TY_INT32, TY_UINT32:
+		return 8
+		// TODO: varOffset sets depending on type's size.
+		//return 4
+	case TY_INT64, TY_INT, TY_UINT64, TY_UINT, TY_UINTPTR:
+		return 8
+	case TY_STRING, TY_INTERFACE:
+		return 16
+	case TY_PTR, TY_MAP:
+		return 8
+	case TY_ARRAY:
+		return 0
+	case TY_SLICE:
+		return 24
+	default:
+		return 0
+	}
+}
+
+func newNoneType() Type {
+	return Type{TY_NONE, nil, 0, 1, nil, "", nil, nil, nil, nil}
+}
+
+func newLiteralType(s string) Type {
+	return Type{typeKind(s), nil, typeSize(typeKind(s)), 1, nil, "", nil, nil, nil, nil}
+}
+
+// untypedType returns the type of an untyped constant of kind k.
+func untypedType(k TypeKind) *Type {
+	return &Type{k, nil, 8, 1, nil, "", nil, nil, nil, nil}
+}
+
+func isUntyped(ty *Type) bool {
+	switch ty.kind {
+	case TY_UNTYPED_INT, TY_UNTYPED_RUNE, TY_UNTYPED_BOOL, TY_UNTYPED_NIL:
+		return true
+	}
+	return false
+}
+
+// defaultType returns the type that an untyped constant of ty takes when
+// no type is required by the context.
+func defaultType(ty *Type) *Type {
+	var dty Type
+	switch ty.kind {
+	case TY_UNTYPED_INT:
+		dty = newLiteralType("int")
+	case TY_UNTYPED_RUNE:
+		dty = newLiteralType("int32")
+	case TY_UNTYPED_BOOL:
+		dty = newLiteralType("bool")
+	default:
+		return ty
+	}
+	return &dty
+}
+
+func pointerTo(base *Type) Type {
+	return Type{TY_PTR, base, 8, 1, nil, "", nil, nil, nil, nil}
+}
+
+func arrayOf(base *Type, length int) Type {
+	return Type{TY_ARRAY, base, length * base.size, length, nil, "", nil, nil, nil, nil}
+}
+
+// sliceOf returns a slice of base, which is a pointer to the elements, the
+// length and the capacity.
+func sliceOf(base *Type) Type {
+	return Type{TY_SLICE, base, 24, 1, nil, "", nil, nil, nil, nil}
+}
+
+// mapOf returns a map from key to val, which is a pointer to a hash table
+// in the runtime. A nil map has no table.
+func mapOf(key *Type, val *Type) Type {
+	return Type{TY_MAP, val, 8, 1, nil, "", nil, key, nil, nil}
+}
+
+// funcOf returns a function type, which is a pointer to a closure whose
+// first word is the address of the code.
+func funcOf(params []*Var, results []*Var) Type {
+	sig := &Function{"", nil, params, results, nil, nil, 0, false, Pos{}, nil}
+	return Type{TY_FUNC, nil, 8, 1, nil, "", nil, nil, nil, sig}
+}
+
+func tupleOf(elems []*Type) Type {
+	size := 0
+	for _, e := range elems {
+		size += wordCount(e) * 8
+	}
+	return Type{TY_TUPLE, nil, size, 1, elems, "", nil, nil, nil, nil}
+}
+
+// alignOf returns the alignment of a value of ty in bytes.
+func alignOf(ty *Type) int {
+	switch ty.kind {
+	case TY_ARRAY:
+		return alignOf(ty.base)
+	case TY_STRUCT:
+		align := 1
+		for _, f := range ty.fields {
+			if a := alignOf(f.ty); a > align {
+				align = a
+			}
+		}
+		return align
+	case TY_STRING, TY_INTERFACE, TY_SLICE:
+		return 8
+	case TY_NONE:
+		// A type being declared refers to other types.
+		if ty.size > 0 {
+			return 8
+		}
+	}
+	if ty.size < 1 {
+		return 1
+	}
+	return ty.size
+}
+
+func alignTo(n int, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// layoutStruct assigns offsets to the fields of a struct and sets its
+// size. Each field is aligned to its alignment and the size is rounded up
+// to the alignment of the struct.
+func layoutStruct(ty *Type) {
+	offset := 0
+	for _, f := range ty.fields {
+		fillSize(f.ty)
+		offset = alignTo(offset, alignOf(f.ty))
+		f.offset = offset
+		offset += f.ty.size
+	}
+	ty.size = alignTo(offset, alignOf(ty))
+}
+
+// findField returns the field named name of a struct, or nil.
+func findField(ty *Type, name string) *Field {
+	for _, f := range ty.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// findMethod returns the method named name whose receiver base type is ty,
+// or nil.
+func findMethod(ty *Type, name string) *Function {
+	for _, m := range ty.methods {
+		if m.name == ty.name+"."+name {
+			return m
+		}
+	}
+	return nil
+}
+
+// incompleteType returns a type in ty whose declaration is being parsed,
+// or nil. A type cannot contain itself without a pointer.
+func incompleteType(ty *Type) *Type {
+	if ty.size < 0 {
+		return ty
+	}
+	if ty.kind == TY_ARRAY {
+		return incompleteType(ty.base)
+	}
+	return nil
+}
+
+// isNamed reports whether ty is a predeclared type such as int64 or a type
+// declared by `type`.
+func isNamed(ty *Type) bool {
+	switch ty.kind {
+	case TY_BOOL, TY_INT, TY_INT8, TY_INT16, TY_INT32, TY_INT64, TY_UINT8, TY_UINT16, TY_UINT32, TY_UINT64, TY_UINT, TY_UINTPTR, TY_STRING:
+		return true
+	}
+	return ty.name != ""
+}
+
+// underlying returns the type that a declared type is defined with.
+func underlying(ty *Type) *Type {
+	if ty.name == "" {
+		return ty
+	}
+	u := *ty
+	u.name = ""
+	if u.kind != TY_INTERFACE {
+		u.methods = nil
+	}
+	return &u
+}
+
+// assignable reports whether a value of rty can be assigned to a variable
+// of lty. Types with the same underlying type are assignable if either
+// of them is not named. A value can be assigned to an interface that its
+// type implements.
+func assignable(lty *Type, rty *Type) bool {
+	if identical(lty, rty) {
+		return true
+	}
+	if rty.kind == TY_UNTYPED_NIL {
+		return hasNil(lty)
+	}
+	if lty.kind == TY_INTERFACE && !isUntyped(rty) && rty.kind != TY_TUPLE {
+		return missingMethod(rty, lty) == ""
+	}
+	return (!isNamed(lty) || !isNamed(rty)) && identical(underlying(lty), underlying(rty))
+}
+
+// missingMethod returns why ty does not implement an interface iface, or
+// "" if it does. The method set of *T has the methods of T with pointer
+// receivers as well as value receivers.
+func missingMethod(ty *Type, iface *Type) string {
+	for _, m := range iface.methods {
+		f := methodOf(ty, m.name)
+		if f == nil {
+			return "missing method " + m.name
+		}
+		if f.recv != nil && f.recv.ty.kind == TY_PTR && ty.kind != TY_PTR {
+			return "method " + m.name + " has pointer receiver"
+		}
+		if !identicalSig(f, m) {
+			return "wrong type for method " + m.name
+		}
+	}
+	return ""
+}
+
+// identicalSig reports whether functions or methods f and g have
+// identical signatures. Receivers are not compared.
+func identicalSig(f *Function, g *Function) bool {
+	fp, gp := sigParams(f), sigParams(g)
+	if len(fp) != len(gp) || len(f.results) != len(g.results) {
+		return false
+	}
+	for i, p := range fp {
+		if !identical(p.ty, gp[i].ty) {
+			return false
+		}
+	}
+	for i, r := range f.results {
+		if !identical(r.ty, g.results[i].ty) {
+			return false
+		}
+	}
+	return true
+}
+
+// sigParams returns the parameters of fn except the receiver.
+func sigParams(fn *Function) []*Var {
+	if fn.recv != nil {
+		return fn.params[1:]
+	}
+	return fn.params
+}
+
+// sigString returns the signature of fn such as `(int, string) bool` for
+// error messages.
+func sigString(fn *Function) string {
+	str := "("
+	for i, p := range sigParams(fn) {
+		if i > 0 {
+			str += ", "
+		}
+		str += p.ty.String()
+	}
+	str += ")"
+	if len(fn.results) == 1 {
+		return str + " " + fn.results[0].ty.String()
+	}
+	if len(fn.results) > 1 {
+		ty := tupleOf(resultTypes(fn))
+		return str + " " + ty.String()
+	}
+	return str
+}
+
+// isNil reports whether e is nil.
+func isNil(e Expr) bool {
+	_, ok := e.(*Nil)
+	return ok
+}
+
+// hasNil reports whether nil is a value of ty.
+func hasNil(ty *Type) bool {
+	switch ty.kind {
+	case TY_PTR, TY_INTERFACE, TY_SLICE, TY_MAP, TY_FUNC:
+		return true
+	}
+	return false
+}
+
+// isMapKey reports whether a value of ty can be a key of a map. Keys are
+// hashed by their bytes except strings, which are hashed by their
+// contents.
+func isMapKey(ty *Type) bool {
+	switch ty.kind {
+	case TY_BOOL, TY_STRING, TY_PTR:
+		return true
+	}
+	return isInteger(ty)
+}
+
+// isComparable reports whether values of ty can be compared with `==`.
+// Slices, maps and functions can only be compared to nil.
+func isComparable(ty *Type) bool {
+	switch ty.kind {
+	case TY_SLICE, TY_MAP, TY_FUNC:
+		return false
+	case TY_ARRAY:
+		return isComparable(ty.base)
+	case TY_STRUCT:
+		for _, f := range ty.fields {
+			if !isComparable(f.ty) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// convertible reports whether a value of from can be converted to to.
+func convertible(from *Type, to *Type) bool {
+	if assignable(to, from) || identical(underlying(from), underlying(to)) {
+		return true
+	}
+	if isInteger(from) && isInteger(to) {
+		return true
+	}
+	// The bytes of a string are copied from and to a byte slice, the runes
+	// of a string are decoded to and encoded from a rune slice, and an
+	// integer is converted to a string of the UTF-8 of the rune.
+	if isBytes(to, from) || isBytes(from, to) || isRunes(to, from) || isRunes(from, to) || to.kind == TY_STRING && isInteger(from) {
+		return true
+	}
+	return from.kind == TY_PTR && to.kind == TY_PTR && identical(underlying(from.base), underlying(to.base))
+}
+
+// identical reports whether a and b are identical types. A declared type
+// is only identical to itself. Types not known yet are not checked.
+func identical(a *Type, b *Type) bool {
+	if a == b || a.kind == TY_NONE || b.kind == TY_NONE {
+		return true
+	}
+	if a.kind != b.kind || a.name != "" || b.name != "" {
+		return false
+	}
+	switch a.kind {
+	case TY_PTR, TY_SLICE:
+		return identical(a.base, b.base)
+	case TY_MAP:
+		return identical(a.key, b.key) && identical(a.base, b.base)
+	case TY_ARRAY:
+		return a.aryLen == b.aryLen && identical(a.base, b.base)
+	case TY_STRUCT:
+		if len(a.fields) != len(b.fields) {
+			return false
+		}
+		for i, f := range a.fields {
+			g := b.fields[i]
+			if f.name != g.name || !identical(f.ty, g.ty) {
+				return false
+			}
+		}
+	case TY_INTERFACE:
+		// Methods are sorted by their names.
+		if len(a.methods) != len(b.methods) {
+			return false
+		}
+		for i, m := range a.methods {
+			if m.name != b.methods[i].name || !identicalSig(m, b.methods[i]) {
+				return false
+			}
+		}
+	case TY_FUNC:
+		return identicalSig(a.sig, b.sig)
+	}
+	return true
+}
+
+// wordCount returns the number of 8-byte words that a value of ty takes
+// on the stack. Values whose types are unknown are held in one word.
+func wordCount(ty *Type) int {
+	if ty == nil || ty.kind == TY_NONE {
+		return 1
+	}
+	if ty.kind == TY_TUPLE {
+		n := 0
+		for _, e := range ty.elems {
+			n += wordCount(e)
+		}
+		return n
+	}
+	return (ty.size + 7) / 8
+}
+
+// String returns the type in Go syntax for error messages.
+func (ty *Type) String() string {
+	if ty.name != "" {
+		return ty.name
+	}
+	switch ty.kind {
+	case TY_BOOL:
+		return "bool"
+	case TY_INT:
+		return "int"
+	case TY_INT8:
+		return "int8"
+	case TY_INT16:
+		return "int16"
+	case TY_INT32:
+		return "int32"
+	case TY_INT64:
+		return "int64"
+	case TY_UINT8:
+		return "uint8"
+	case TY_UINT16:
+		return "uint16"
+	case TY_UINT32:
+		return "uint32"
+	case TY_UINT64:
+		return "uint64"
+	case TY_UINT:
+		return "uint"
+	case TY_UINTPTR:
+		return "uintptr"
+	case TY_STRING:
+		return "string"
+	case TY_PTR:
+		return "*" + ty.base.String()
+	case TY_ARRAY:
+		return fmt.Sprintf("[%d]%s", ty.aryLen, ty.base.String())
+	case TY_SLICE:
+		return "[]" + ty.base.String()
+	case TY_MAP:
+		return "map[" + ty.key.String() + "]" + ty.base.String()
+	case TY_STRUCT:
+		str := "struct{"
+		for i, f := range ty.fields {
+			if i > 0 {
+				str += "; "
+			}
+			str += f.name + " " + f.ty.String()
+		}
+		return str + "}"
+	case TY_TUPLE:
+		str := "("
+		for i, e := range ty.elems {
+			if i > 0 {
+				str += ", "
+			}
+			str += e.String()
+		}
+		return str + ")"
+	case TY_UNTYPED_INT:
+		return "untyped int"
+	case TY_UNTYPED_RUNE:
+		return "untyped rune"
+	case TY_UNTYPED_BOOL:
+		return "untyped bool"
+	case TY_UNTYPED_NIL:
+		return "untyped nil"
+	case TY_INTERFACE:
+		str := "interface{"
+		for i, m := range ty.methods {
+			if i > 0 {
+				str += "; "
+			}
+			str += m.name + sigString(m)
+		}
+		return str + "}"
+	case TY_FUNC:
+		return "func" + sigString(ty.sig)
+	default:
+		return "<none>"
+	}
+}
+
+func typeCheck(lty *Type, rty *Type, op string, pos Pos) {
+	if lty.kind == TY_NONE || rty.kind == TY_NONE {
+		return
+	}
+	// Untyped integer and rune constants are mixed in a constant expression.
+	if isUntyped(lty) && isUntyped(rty) && isInteger(lty) && isInteger(rty) {
+		return
+	}
+	if !identical(lty, rty) {
+		errorAt(pos, "invalid operation: operator %s (mismatched types %s and %s)", op, lty, rty)
+	}
+}
+
+func isInteger(ty *Type) bool {
+	switch ty.kind {
+	case TY_INT, TY_INT8, TY_INT16, TY_INT32, TY_INT64, TY_UNTYPED_INT, TY_UNTYPED_RUNE:
+		return true
+	}
+	return isUnsigned(ty)
+}
+
+func isUnsigned(ty *Type) bool {
+	switch ty.kind {
+	case TY_UINT8, TY_UINT16, TY_UINT32, TY_UINT64, TY_UINT, TY_UINTPTR:
+		return true
+	}
+	return false
+}
+
+// addOperandTypes adds types to the operands of a binary operation. An
+// untyped constant, such as 0 in `-x`, takes the type of the other
+// operand. An untyped constant shifted by a non-constant count is left
+// untyped for the context to decide its type.
+func addOperandTypes(lhs Expr, rhs Expr, op string) {
+	addType(lhs)
+	addType(rhs)
+	if op == "<<" || op == ">>" {
+		defaultConst(rhs)
+		return
+	}
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		// Compared shifts take the default type.
+		for _, e := range []Expr{lhs, rhs} {
+			if _, ok := e.(*Binary); ok {
+				defaultConst(e)
+			}
+		}
+	}
+	if isUntyped(lhs.getType()) && !isUntyped(rhs.getType()) {
+		convertUntyped(lhs, rhs.getType())
+	}
+	if isUntyped(rhs.getType()) && !isUntyped(lhs.getType()) {
+		convertUntyped(rhs, lhs.getType())
+	}
+	convertString(lhs, rhs.getType(), !isUntypedString(rhs))
+	convertString(rhs, lhs.getType(), !isUntypedString(lhs))
+	if n, ok := lhs.(*Nil); ok && hasNil(rhs.getType()) {
+		n.setType(rhs.getType())
+	}
+	if n, ok := rhs.(*Nil); ok && hasNil(lhs.getType()) {
+		n.setType(lhs.getType())
+	}
+}
+
+// checkDivisor reports an error if the divisor of `/` or `%` is the
+// constant zero.
+func checkDivisor(op string, rhs Expr, pos Pos) {
+	if c, ok := rhs.(*IntLit); ok && (op == "/" || op == "%") && c.val.Sign() == 0 {
+		errorAt(pos, "invalid operation: division by zero")
+	}
+}
+
+// convertOperand converts an operand e compared to a value of ty to ty
+// if ty is an interface that the type of e implements.
+func convertOperand(ty *Type, e Expr, pos Pos) Expr {
+	ety := e.getType()
+	if ty.kind != TY_INTERFACE || ety.kind == TY_UNTYPED_NIL || identical(ty, ety) {
+		return e
+	}
+	if c, ok := e.(*IntLit); ok && isUntyped(c.ty) {
+		ety = defaultType(c.ty)
+	}
+	if !assignable(ty, ety) {
+		return e
+	}
+	return assignCheck(ty, e, e.getType(), "comparison", pos)
+}
+
+// checkOperands checks the operand types of a binary operator.
+func checkOperands(lty *Type, rty *Type, op string, pos Pos) {
+	switch op {
+	case "<<", ">>":
+		if lty.kind != TY_NONE && !isInteger(lty) {
+			errorAt(pos, "invalid operation: shifted operand of type %s must be integer", lty)
+		}
+		if rty.kind != TY_NONE && !isInteger(rty) {
+			errorAt(pos, "invalid operation: shift count type %s, must be integer", rty)
+		}
+		return
+	case "+", "-", "*", "/", "%", "&", "|", "^", "&^":
+		// Strings are concatenated by `+`.
+		if lty.kind != TY_NONE && !isInteger(lty) && (op != "+" || lty.kind != TY_STRING) {
+			errorAt(pos, "invalid operation: operator %s not defined on %s", op, lty)
+		}
+	case "&&", "||":
+		checkBool(lty, op, pos)
+		checkBool(rty, op, pos)
+	case "<", "<=", ">", ">=":
+		checkOrdered(lty, op, pos)
+		checkOrdered(rty, op, pos)
+	case "==", "!=":
+		if (lty.kind == TY_STRUCT || lty.kind == TY_ARRAY) && !isComparable(lty) {
+			errorAt(pos, "invalid operation: operator %s not defined on %s", op, lty)
+		}
+		if lty.kind == TY_UNTYPED_NIL && rty.kind == TY_UNTYPED_NIL {
+			errorAt(pos, "invalid operation: operator %s not defined on nil", op)
+		}
+	}
+	typeCheck(lty, rty, op, pos)
+}
+
+// checkOrdered checks that the operand of an ordered comparison is an
+// integer or a string.
+func checkOrdered(ty *Type, op string, pos Pos) {
+	if ty.kind == TY_UNTYPED_NIL {
+		errorAt(pos, "invalid operation: operator %s not defined on nil", op)
+	}
+	if ty.kind != TY_NONE && !isInteger(ty) && ty.kind != TY_STRING {
+		errorAt(pos, "invalid operation: operator %s not defined on %s", op, ty)
+	}
+}
+
+// checkBool checks that the operand of a logical operator is a boolean.
+func checkBool(ty *Type, op string, pos Pos) {
+	if ty.kind != TY_NONE && ty.kind != TY_BOOL && ty.kind != TY_UNTYPED_BOOL {
+		errorAt(pos, "invalid operation: operator %s not defined on %s", op, ty)
+	}
+}
+
+// addBuiltinType adds types to a call of a builtin function.
+func addBuiltinType(n *BuiltinCall) {
+	for _, arg := range n.args {
+		addType(arg)
+		checkSingle(arg)
+	}
+	switch n.name {
+	case "print", "println":
+		for _, arg := range n.args {
+			defaultConst(arg)
+			switch ty := arg.getType(); {
+			case ty.kind == TY_NONE, ty.kind == TY_BOOL, ty.kind == TY_STRING, ty.kind == TY_PTR, isInteger(ty):
+			default:
+				errorAt(arg.getPos(), "illegal types for operand: %s (type %s)", n.name, ty)
+			}
+		}
+		// It has no value.
+		ty := tupleOf(nil)
+		n.setType(&ty)
+	case "len", "cap":
+		defaultConst(n.args[0])
+		ty := n.args[0].getType()
+		if ty.kind == TY_PTR && ty.base.kind == TY_ARRAY {
+			ty = ty.base
+		}
+		switch {
+		case ty.kind == TY_NONE, ty.kind == TY_ARRAY, ty.kind == TY_SLICE:
+		case (ty.kind == TY_STRING || ty.kind == TY_MAP) && n.name == "len":
+		default:
+			errorAt(n.args[0].getPos(), "invalid argument: %s for built-in %s", n.args[0].getType(), n.name)
+		}
+		ity := newLiteralType("int")
+		n.setType(&ity)
+	case "make":
+		if n.ty.kind == TY_MAP {
+			// The size hint is ignored.
+			if len(n.args) > 1 {
+				errorAt(n.pos, "invalid operation: make(%s) expects 1 or 2 arguments; found %d", n.ty, len(n.args)+1)
+			}
+			for _, arg := range n.args {
+				checkIndex(arg)
+			}
+			return
+		}
+		if n.ty.kind != TY_SLICE {
+			errorAt(n.pos, "invalid argument: cannot make %s; type must be slice or map", n.ty)
+		}
+		if len(n.args) == 0 || len(n.args) > 2 {
+			errorAt(n.pos, "invalid operation: make(%s) expects 2 or 3 arguments; found %d", n.ty, len(n.args)+1)
+		}
+		for _, arg := range n.args {
+			checkIndex(arg)
+		}
+		if len(n.args) == 2 {
+			l, lok := n.args[0].(*IntLit)
+			c, cok := n.args[1].(*IntLit)
+			if lok && cok && l.val.Cmp(c.val) > 0 {
+				errorAt(n.args[0].getPos(), "invalid argument: length and capacity swapped")
+			}
+		}
+	case "append":
+		ty := n.args[0].getType()
+		if ty.kind == TY_UNTYPED_NIL {
+			errorAt(n.args[0].getPos(), "first argument to append must be a typed slice; have untyped nil")
+		}
+		if ty.kind != TY_SLICE {
+			errorAt(n.args[0].getPos(), "invalid argument: %s is not a slice", ty)
+		}
+		n.setType(ty)
+		if !n.dots {
+			for i, e := range n.args[1:] {
+				n.args[i+1] = assignCheck(ty.base, e, e.getType(), "argument to append", e.getPos())
+			}
+			return
+		}
+		if len(n.args) != 2 {
+			errorAt(n.pos, "can only use ... with final argument in list")
+		}
+		// Bytes of a string can be appended to a byte slice.
+		if t := n.args[1].getType(); !isBytes(ty, t) && (t.kind != TY_SLICE || !identical(ty.base, t.base)) {
+			errorAt(n.args[1].getPos(), "cannot use value of type %s as %s value in argument to append", t, ty)
+		}
+	case "delete":
+		ty := n.args[0].getType()
+		if ty.kind != TY_MAP {
+			errorAt(n.args[0].getPos(), "invalid argument: %s is not a map", ty)
+		}
+		n.args[1] = assignCheck(ty.key, n.args[1], n.args[1].getType(), "argument to delete", n.args[1].getPos())
+		// It has no value.
+		tty := tupleOf(nil)
+		n.setType(&tty)
+	case "copy":
+		dst := n.args[0].getType()
+		src := n.args[1].getType()
+		if dst.kind != TY_SLICE || src.kind != TY_SLICE && src.kind != TY_STRING {
+			errorAt(n.pos, "invalid argument: copy expects slice arguments; found %s and %s", dst, src)
+		}
+		if !isBytes(dst, src) && (src.kind != TY_SLICE || !identical(dst.base, src.base)) {
+			errorAt(n.pos, "invalid argument: arguments to copy %s and %s have different element types", dst, src)
+		}
+		ity := newLiteralType("int")
+		n.setType(&ity)
+	}
+}
+
+// isBytes reports whether dst is a byte slice and src is a string, whose
+// bytes can be copied to dst.
+func isBytes(dst *Type, src *Type) bool {
+	return dst.kind == TY_SLICE && dst.base.kind == TY_UINT8 && src.kind == TY_STRING
+}
+
+// isRunes reports whether dst is a rune slice and src is a string, whose
+// runes can be decoded to dst.
+func isRunes(dst *Type, src *Type) bool {
+	return dst.kind == TY_SLICE && dst.base.kind == TY_INT32 && src.kind == TY_STRING
+}
+
+// checkIndex checks that e is an integer index. A constant index must not
+// be negative.
+func checkIndex(e Expr) {
+	defaultConst(e)
+	if ty := e.getType(); ty.kind != TY_NONE && !isInteger(ty) {
+		errorAt(e.getPos(), "invalid argument: index of type %s must be integer", ty)
+	}
+	if c, ok := e.(*IntLit); ok && c.val.Sign() < 0 {
+		errorAt(e.getPos(), "invalid argument: index %s must not be negative", c.val)
+	}
+}
+
+// checkAssignable reports an error if e is neither addressable nor a map
+// index expression.
+func checkAssignable(e Expr) {
+	checkMapField(e)
+	if a, ok := e.(*ArrayRef); ok && a.lhs.getType().kind == TY_MAP {
+		return
+	}
+	if !isAddressable(e) {
+		errorAt(e.getPos(), "cannot assign to non-addressable value")
+	}
+}
+
+// checkMapField reports an error if e is a part of an entry of a map, which
+// cannot be assigned as the entry is not addressable.
+func checkMapField(e Expr) {
+	inner := false
+	for {
+		switch n := e.(type) {
+		case *Selector:
+			if n.lhs.getType().kind == TY_PTR {
+				return
+			}
+			e = n.lhs
+		case *ArrayRef:
+			if n.lhs.getType().kind == TY_MAP {
+				if inner {
+					errorAt(n.pos, "cannot assign to a part of a map entry")
+				}
+				return
+			}
+			if n.lhs.getType().kind != TY_ARRAY {
+				return
+			}
+			e = n.lhs
+		default:
+			return
+		}
+		inner = true
+	}
+}
+
+// addSwitchType adds types to a switch statement. The case values are
+// compared with the tag, and constant ones must not be duplicated.
+func addSwitchType(n *Switch) {
+	if n.init != nil {
+		addType(n.init)
+	}
+	if n.tag != nil {
+		addType(n.tag)
+		checkSingle(n.tag)
+		defaultConst(n.tag)
+		n.tmp = newTemp(n.tag.getType(), n.pos)
+	}
+	if n.guard != nil {
+		addType(n.guard.lhs)
+		checkSingle(n.guard.lhs)
+		checkAssertion(n.guard.lhs.getType(), nil, "", n.guard.pos)
+		n.tmp = newTemp(n.guard.lhs.getType(), n.pos)
+	}
+	seen := map[string]bool{}
+	var seenTypes []*Type
+	for _, c := range n.cases {
+		for _, ty := range c.types {
+			if ty == nil {
+				if seen["nil"] {
+					errorAt(c.pos, "multiple nil cases in type switch")
+				}
+				seen["nil"] = true
+				continue
+			}
+			checkAssertion(n.tmp.ty, ty, "type switch case", c.pos)
+			for _, t := range seenTypes {
+				if identical(t, ty) {
+					errorAt(c.pos, "duplicate case %s in type switch", ty)
+				}
+			}
+			seenTypes = append(seenTypes, ty)
+		}
+		// The variable declared by the guard has the type of the case if
+		// there is only one, or the type of the interface otherwise.
+		if c.v != nil {
+			var rhs Expr = n.tmp
+			if len(c.types) == 1 && c.types[0] != nil {
+				rhs = &TypeAssert{n.tmp, c.types[0], c.pos}
+			}
+			decl := &VarDecl{c.v, true, c.pos}
+			assign := &Assign{[]Expr{c.v}, []Expr{rhs}, c.pos}
+			c.body.children = append([]Stmt{decl, assign}, c.body.children...)
+		}
+		for _, v := range c.vals {
+			if n.tag == nil {
+				addType(v)
+				checkSingle(v)
+				defaultConst(v)
+				if ty := v.getType(); ty.kind != TY_BOOL {
+					errorAt(v.getPos(), "invalid case in switch (mismatched types %s and bool)", ty)
+				}
+				c.conds = append(c.conds, v)
+				continue
+			}
+			bty := newLiteralType("bool")
+			cond := &Binary{"==", n.tmp, v, &bty, v.getPos()}
+			addType(cond)
+			c.conds = append(c.conds, cond)
+
+			var key string
+			switch lit := v.(type) {
+			case *IntLit:
+				key = lit.val.String()
+			case *StringLit:
+				key = fmt.Sprintf("%q", lit.val)
+			default:
+				continue
+			}
+			if seen[key] {
+				errorAt(v.getPos(), "duplicate case %s in expression switch", key)
+			}
+			seen[key] = true
+		}
+		addType(c.body)
+	}
+}
+
+// addRangeType adds types to a for statement with a range clause. The
+// values of each iteration are assigned to the variables from RangeNext.
+func addRangeType(n *Range) {
+	addType(n.x)
+	checkSingle(n.x)
+	defaultConst(n.x)
+	ty := n.x.getType()
+	ity := newLiteralType("int")
+	rty := newLiteralType("int32")
+	// The state is the index, or the byte offset, the rune and its width
+	// for a string, or the iterator of a map.
+	words := 1
+	var types []*Type
+	switch {
+	case ty.kind == TY_PTR && ty.base.kind == TY_ARRAY:
+		types = []*Type{&ity, ty.base.base}
+	case ty.kind == TY_ARRAY, ty.kind == TY_SLICE:
+		types = []*Type{&ity, ty.base}
+	case ty.kind == TY_STRING:
+		types = []*Type{&ity, &rty}
+		words = 3
+	case ty.kind == TY_MAP:
+		types = []*Type{ty.key, ty.base}
+		words = 5
+	case isInteger(ty):
+		types = []*Type{ty}
+	default:
+		errorAt(n.x.getPos(), "cannot range over %s", ty)
+	}
+	if len(n.lvals) > len(types) {
+		errorAt(n.lvals[len(types)].getPos(), "range over %s permits only one iteration variable", ty)
+	}
+	n.tmp = newTemp(ty, n.pos)
+	sty := arrayOf(&ity, words)
+	n.it = newTemp(&sty, n.pos)
+
+	if len(n.lvals) > 0 {
+		next := &RangeNext{n, types[0], n.pos}
+		if len(n.lvals) == 2 {
+			tty := tupleOf(types)
+			next.ty = &tty
+		}
+		n.assign = &Assign{n.lvals, []Expr{next}, n.pos}
+		addType(n.assign)
+	}
+	addType(n.then)
+}
+
+// commaOk returns a CommaOk node if e is a map index or a type assertion
+// assigned to two values. Otherwise e is returned as it is.
+func commaOk(e Expr) Expr {
+	bty := newLiteralType("bool")
+	switch n := e.(type) {
+	case *ArrayRef:
+		if n.lhs.getType().kind == TY_MAP {
+			ty := tupleOf([]*Type{n.ty, &bty})
+			return &CommaOk{n, &ty, n.pos}
+		}
+	case *TypeAssert:
+		ty := tupleOf([]*Type{n.ty, &bty})
+		return &CommaOk{n, &ty, n.pos}
+	}
+	return e
+}
+
+// checkAssertion checks that a value of ity is an interface which may
+// hold a value of the dynamic type ty. ty is nil for the nil interface.
+func checkAssertion(ity *Type, ty *Type, context string, pos Pos) {
+	if ity.kind != TY_INTERFACE {
+		errorAt(pos, "invalid operation: value of type %s is not an interface", ity)
+	}
+	if ty == nil || ty.kind == TY_INTERFACE {
+		return
+	}
+	if m := missingMethod(ty, ity); m != "" {
+		errorAt(pos, "impossible %s: %s does not implement %s (%s)", context, ty, ity, m)
+	}
+}
+
+// addMapLitType adds types to a map literal. Constant keys must not be
+// duplicated.
+func addMapLitType(n *MapLit) {
+	seen := map[string]bool{}
+	for i, k := range n.keys {
+		addType(k)
+		checkSingle(k)
+		n.keys[i] = assignCheck(n.ty.key, k, k.getType(), "map literal", k.getPos())
+		v := n.vals[i]
+		addType(v)
+		checkSingle(v)
+		n.vals[i] = assignCheck(n.ty.base, v, v.getType(), "map literal", v.getPos())
+
+		var key string
+		switch c := k.(type) {
+		case *IntLit:
+			key = c.val.String()
+		case *StringLit:
+			key = fmt.Sprintf("%q", c.val)
+		default:
+			continue
+		}
+		if seen[key] {
+			errorAt(k.getPos(), "duplicate key %s in map literal", key)
+		}
+		seen[key] = true
+	}
+}
+
+// addSliceType adds types to a slice expression. Slicing an array or a
+// pointer to an array makes a slice of the array.
+func addSliceType(n *SliceExpr) {
+	addType(n.lhs)
+	checkSingle(n.lhs)
+	for _, e := range []Expr{n.low, n.high, n.max} {
+		if e != nil {
+			addType(e)
+			checkSingle(e)
+			checkIndex(e)
+		}
+	}
+	l, lok := n.low.(*IntLit)
+	h, hok := n.high.(*IntLit)
+	if lok && hok && l.val.Cmp(h.val) > 0 {
+		errorAt(n.pos, "invalid slice indices: %s < %s", h.val, l.val)
+	}
+
+	ty := n.lhs.getType()
+	if ty.kind == TY_PTR && ty.base.kind == TY_ARRAY {
+		n.lhs = &Deref{n.lhs, ty.base, n.pos}
+		ty = ty.base
+	}
+	switch ty.kind {
+	case TY_STRING:
+		if n.max != nil {
+			errorAt(n.pos, "invalid operation: 3-index slice of string")
+		}
+	case TY_ARRAY:
+		if !isAddressable(n.lhs) {
+			errorAt(n.pos, "invalid operation: slice of unaddressable value")
+		}
+		// The slice may outlive the array.
+		moveToHeap(n.lhs)
+		sty := sliceOf(ty.base)
+		ty = &sty
+	case TY_SLICE:
+	default:
+		errorAt(n.pos, "cannot slice value of type %s", ty)
+	}
+	// A slice literal has its own type.
+	if n.ty.kind == TY_NONE {
+		n.setType(ty)
+	}
+}
+
+func fillSize(ty *Type) {
+	if ty == nil || ty.kind != TY_ARRAY {
+		return
+	}
+	fillSize(ty.base)
+	ty.size = ty.aryLen * ty.base.size
+}
+
+// The function whose body is being typed.
+var curFn *Function
+
+// addFuncType adds types to the body of fn and allocates its stack frame.
+func addFuncType(fn *Function) {
+	if fn.isExternal {
+		return
+	}
+	curFn = fn
+	resetOffset()
+	if fn.ctx != nil {
+		addType(fn.ctx)
+	}
+	// Parameters and results need stack slots even if they are never used.
+	for _, p := range fn.params {
+		addType(p)
+	}
+	for _, r := range fn.results {
+		if r.name != "" {
+			addType(r)
+		}
+	}
+	for _, s := range fn.stmts {
+		addType(s)
+	}
+	fn.stackSize = stackSize(fn.locals)
+
+	if len(fn.results) > 0 && (len(fn.stmts) == 0 || !isTerminating(fn.stmts[len(fn.stmts)-1])) {
+		errorAt(fn.pos, "missing return")
+	}
+}
+
+func resultTypes(fn *Function) []*Type {
+	types := make([]*Type, len(fn.results))
+	for i, r := range fn.results {
+		types[i] = r.ty
+	}
+	return types
+}
+
+// valueTypes returns the types of values in exprs. A function call
+// returning multiple values is expanded if it is the only expression.
+func valueTypes(exprs []Expr) []*Type {
+	if len(exprs) == 1 && exprs[0].getType().kind == TY_TUPLE {
+		return exprs[0].getType().elems
+	}
+	types := make([]*Type, len(exprs))
+	for i, e := range exprs {
+		checkSingle(e)
+		types[i] = e.getType()
+	}
+	return types
+}
+
+// count returns "n noun" in the singular or plural form.
+func count(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// checkSingle reports an error if e has multiple values.
+func checkSingle(e Expr) {
+	if e.getType().kind == TY_TUPLE {
+		errorAt(e.getPos(), "multiple-value %s in single-value context", e.getType())
+	}
+}
+
+// assignCheck checks that a value of rty can be assigned to lty, and
+// returns rhs to assign. Untyped constants are converted to lty, or to
+// their default types if lty is an interface. A value assigned to an
+// interface of another type is converted to the interface. rhs is nil if
+// it is a value of a function call returning multiple values.
+func assignCheck(lty *Type, rhs Expr, rty *Type, context string, pos Pos) Expr {
+	if rhs != nil && isUntyped(rty) && rty.kind != TY_UNTYPED_NIL {
+		if lty.kind == TY_INTERFACE {
+			defaultConst(rhs)
+		} else {
+			convertUntyped(rhs, lty)
+		}
+		rty = rhs.getType()
+	}
+	if s, ok := rhs.(*StringLit); ok && lty.kind != TY_INTERFACE {
+		convertString(s, lty, true)
+		rty = s.ty
+	}
+	if assignable(lty, rty) {
+		if n, ok := rhs.(*Nil); ok && lty.kind != TY_NONE {
+			n.setType(lty)
+			return rhs
+		}
+		if lty.kind != TY_INTERFACE || identical(lty, rty) {
+			return rhs
+		}
+		if rhs == nil {
+			errorAt(pos, "cannot use multiple values of a function call as %s value in %s", lty, context)
+		}
+		return &Conv{rhs, lty, rhs.getPos()}
+	}
+	if rty.kind == TY_UNTYPED_NIL {
+		errorAt(pos, "cannot use nil as %s value in %s", lty, context)
+	}
+	if lty.kind == TY_INTERFACE {
+		errorAt(pos, "cannot use value of type %s as %s value in %s: %s does not implement %s (%s)", rty, lty, context, rty, lty, missingMethod(rty, lty))
+	}
+	errorAt(pos, "cannot use value of type %s as %s value in %s", rty, lty, context)
+	return nil
+}
+
+// methodOf returns the method named name of a value of ty, or nil. The
+// methods of T are also the methods of *T.
+func methodOf(ty *Type, name string) *Function {
+	if ty.kind == TY_INTERFACE {
+		for _, m := range ty.methods {
+			if m.name == name {
+				return m
+			}
+		}
+		return nil
+	}
+	if ty.kind == TY_PTR && ty.name == "" {
+		ty = ty.base
+	}
+	return findMethod(ty, name)
 }
 
-func typeKind(s string) TypeKind {
-	switch s {
-	case "bool":
-		return TY_BOOL
-	case "int8":
-		return TY_INT8
-	case "int32":
-		return TY_INT32
-	case "int64", "int":
-		return TY_INT64
-	case "string":
-		return TY_STRING
-	case "pointer":
-		return TY_PTR
-	case "array":
-		return TY_ARRAY
+// methodIndex returns the index of the method m in the method table of
+// an interface ty.
+func methodIndex(ty *Type, m *Function) int {
+	for i, n := range ty.methods {
+		if n == m {
+			return i
+		}
+	}
+	panic("method not found")
+}
+
+// addSelectorType adds types to a selector whose lhs is typed. It is a
+// field or a method value.
+func addSelectorType(n *Selector) {
+	if m := methodOf(n.lhs.getType(), n.name); m != nil {
+		checkSingle(n.lhs)
+		n.lhs = methodRecv(n.lhs, m, n.pos)
+		n.bound = methodWrapper(n.lhs.getType(), m, true)
+		ty := funcOf(sigParams(m), m.results)
+		n.setType(&ty)
+		return
+	}
+	ty := n.lhs.getType()
+	if ty.kind == TY_PTR && ty.base.kind == TY_STRUCT {
+		n.lhs = &Deref{n.lhs, ty.base, n.pos}
+		ty = ty.base
+	}
+	if ty.kind == TY_STRUCT {
+		n.field = findField(ty, n.name)
+	}
+	if n.field == nil {
+		errorAt(n.pos, "type %s has no field or method %s", ty, n.name)
+	}
+	n.setType(n.field.ty)
+	if !isAddressable(n.lhs) {
+		n.tmp = newTemp(ty, n.pos)
+	}
+}
+
+// methodRecv returns the receiver recv passed to the method m. The
+// address of recv is taken or recv is dereferenced if the receiver of m
+// needs it.
+func methodRecv(recv Expr, m *Function, pos Pos) Expr {
+	ty := recv.getType()
+	if ty.kind == TY_INTERFACE {
+		return recv
+	}
+	if m.recv.ty.kind == TY_PTR && ty.kind != TY_PTR {
+		if !isAddressable(recv) {
+			errorAt(pos, "cannot call pointer method %s on %s", m.name, ty)
+		}
+		// The method may keep the address of the receiver.
+		moveToHeap(recv)
+		pty := pointerTo(ty)
+		return &Addr{recv, &pty, recv.getPos()}
+	}
+	if m.recv.ty.kind != TY_PTR && ty.kind == TY_PTR && ty.name == "" {
+		return &Deref{recv, ty.base, recv.getPos()}
+	}
+	return recv
+}
+
+// methodExprFunc returns the function of the value of a method
+// expression. `(*T).M` of a method with a value receiver is its wrapper
+// taking a pointer.
+func methodExprFunc(n *MethodExpr) *Function {
+	m := n.method
+	if n.recv.kind == TY_INTERFACE {
+		return methodWrapper(n.recv, m, false)
+	}
+	if n.recv.kind == TY_PTR && m.recv.ty.kind != TY_PTR {
+		return findFunc(m.name + ".ptr")
+	}
+	return m
+}
+
+// wrapper is a function calling a method, which is generated for a method
+// value or a method expression of an interface.
+type wrapper struct {
+	recv  *Type
+	name  string
+	bound bool
+	fn    *Function
+}
+
+// Wrappers generated while typing. They are typed after the declared
+// functions.
+var wrappers []wrapper
+
+// methodWrapper returns the function calling the method m of a receiver
+// of recv. The receiver of a bound wrapper is the one of a method value
+// and it is held in the closure, otherwise it is the first parameter.
+func methodWrapper(recv *Type, m *Function, bound bool) *Function {
+	for _, w := range wrappers {
+		if w.name == m.name && w.bound == bound && identical(w.recv, recv) {
+			return w.fn
+		}
+	}
+	pos := m.pos
+	var ctx *Var
+	var lhs Expr
+	params := make([]*Var, 0)
+	if bound {
+		pty := pointerTo(recv)
+		ctx = &Var{"", 0, true, &pty, pos, nil}
+		lhs = &Deref{ctx, recv, pos}
+	} else {
+		p := &Var{"", 0, true, recv, pos, nil}
+		params = append(params, p)
+		lhs = p
+	}
+	args := make([]Expr, 0)
+	for _, q := range sigParams(m) {
+		v := &Var{"", 0, true, q.ty, q.pos, nil}
+		params = append(params, v)
+		args = append(args, v)
+	}
+	results := make([]*Var, 0)
+	for _, r := range m.results {
+		results = append(results, &Var{"", 0, true, r.ty, r.pos, nil})
+	}
+	locals := append([]*Var{}, params...)
+	if ctx != nil {
+		locals = append(locals, ctx)
+	}
+
+	// The method is selected by its name without the receiver base type.
+	name := m.name[strings.LastIndex(m.name, ".")+1:]
+	sty, cty := newNoneType(), newNoneType()
+	sel := &Selector{lhs, name, nil, nil, nil, &sty, pos}
+	call := &FuncCall{"", args, sel, nil, 0, nil, &cty, pos}
+	var body Stmt = &ExprStmt{call, pos}
+	if len(results) > 0 {
+		body = &Return{[]Expr{call}, pos}
+	}
+
+	label := recv.name
+	if recv.kind == TY_PTR {
+		label = recv.base.name
+	} else if label == "" {
+		label = "interface"
+	}
+	kind := "expr"
+	if bound {
+		kind = "bound"
+	}
+	label = fmt.Sprintf("%s.%s.%s.%d", label, name, kind, len(wrappers))
+	fn := &Function{label, nil, params, results, locals, []Stmt{body}, 0, false, pos, ctx}
+	wrappers = append(wrappers, wrapper{recv, m.name, bound, fn})
+	return fn
+}
+
+// addMethodCall adds types to a call of a method value `x.M(args)` or a
+// method expression `T.M(x, args)`, and changes it to a call of the
+// method with the receiver as the first argument. It returns the method.
+// The address of x is taken or x is dereferenced if the receiver of the
+// method needs it. A method of an interface is called dynamically. Any
+// other callee is a function value, whose signature is returned.
+func addMethodCall(n *FuncCall) *Function {
+	var m *Function
+	switch f := n.fn.(type) {
+	case *Selector:
+		addType(f.lhs)
+		checkSingle(f.lhs)
+		m = methodOf(f.lhs.getType(), f.name)
+		if m == nil {
+			addSelectorType(f)
+			return addFuncValueCall(n)
+		}
+		n.args = append([]Expr{f.lhs}, n.args...)
+	case *MethodExpr:
+		m = f.method
+		if len(n.args) == 0 {
+			errorAt(n.pos, "not enough arguments in call to %s", m.name)
+		}
+		addType(n.args[0])
+		checkSingle(n.args[0])
+		n.args[0] = assignCheck(f.recv, n.args[0], n.args[0].getType(), "argument", n.args[0].getPos())
 	default:
-		return TY_NONE
+		addType(n.fn)
+		return addFuncValueCall(n)
+	}
+	for _, arg := range n.args[1:] {
+		addType(arg)
 	}
+	n.name = m.name
+
+	ty := n.args[0].getType()
+	if ty.kind == TY_INTERFACE {
+		n.iface = newTemp(ty, n.pos)
+		n.index = methodIndex(ty, m)
+		return m
+	}
+	n.args[0] = methodRecv(n.args[0], m, n.pos)
+	return m
 }
 
-func typeSize(k TypeKind) int {
-	switch k {
-	case TY_BOOL:
-		return 1
-	case TY_INT8:
-		return 1
-	case TY_INT32:
-		return 8
-		// TODO: varOffset sets depending on type's size.
-		//return 4
-	case TY_INT64, TY_INT:
+// addFuncValueCall adds types to a call of a function value, which is
+// held in fnval, and returns its signature.
+func addFuncValueCall(n *FuncCall) *Function {
+	checkSingle(n.fn)
+	ty := n.fn.getType()
+	if ty.kind != TY_FUNC {
+		if v, ok := n.fn.(*Var); ok {
+			errorAt(n.pos, "cannot call non-function %s", v.name)
+		}
+		errorAt(n.pos, "invalid operation: cannot call non-function of type %s", ty)
+	}
+	for _, arg := range n.args {
+		addType(arg)
+	}
+	switch f := n.fn.(type) {
+	case *Var:
+		n.name = f.name
+	case *Selector:
+		n.name = f.name
+	default:
+		n.name = "function value"
+	}
+	n.fnval = newTemp(ty, n.pos)
+	return ty.sig
+}
+
+func checkArgs(n *FuncCall, fn *Function) {
+	args := n.args
+	if n.iface != nil {
+		// The receiver of a dynamic call is not a parameter.
+		args = args[1:]
+	}
+	types := valueTypes(args)
+	if len(types) < len(fn.params) {
+		errorAt(n.pos, "not enough arguments in call to %s", n.name)
+	}
+	if len(types) > len(fn.params) {
+		errorAt(n.pos, "too many arguments in call to %s", n.name)
+	}
+	if len(args) != len(types) {
+		// Multiple values of a function call.
+		for i, p := range fn.params {
+			assignCheck(p.ty, nil, types[i], "argument", n.pos)
+		}
+		return
+	}
+	for i, p := range fn.params {
+		args[i] = assignCheck(p.ty, args[i], types[i], "argument", args[i].getPos())
+	}
+}
+
+func checkReturn(n *Return) {
+	// A function without results may return a value as main returns an
+	// exit code.
+	if len(curFn.results) == 0 {
+		if len(n.children) > 1 {
+			errorAt(n.pos, "too many return values")
+		}
+		for _, c := range n.children {
+			defaultConst(c)
+		}
+		return
+	}
+
+	types := valueTypes(n.children)
+	if len(types) < len(curFn.results) {
+		errorAt(n.pos, "not enough return values")
+	}
+	if len(types) > len(curFn.results) {
+		errorAt(n.pos, "too many return values")
+	}
+	if len(n.children) != len(types) {
+		// Multiple values of a function call.
+		for i, r := range curFn.results {
+			assignCheck(r.ty, nil, types[i], "return statement", n.pos)
+		}
+		return
+	}
+	for i, r := range curFn.results {
+		n.children[i] = assignCheck(r.ty, n.children[i], types[i], "return statement", n.children[i].getPos())
+	}
+}
+
+// isTerminating reports whether s is a terminating statement, after which
+// a function does not need a return statement.
+func isTerminating(s Stmt) bool {
+	switch n := s.(type) {
+	case *Return:
+		return true
+	case *Block:
+		return len(n.children) > 0 && isTerminating(n.children[len(n.children)-1])
+	case *If:
+		return n.els != nil && isTerminating(n.then) && isTerminating(n.els)
+	case *For:
+		return isEmpty(n.cond) && !n.brk
+	case *Labeled:
+		return isTerminating(n.stmt)
+	case *Switch:
+		// It has a default case, and all cases end with a terminating
+		// statement or fallthrough.
+		hasDefault := false
+		for _, c := range n.cases {
+			if c.vals == nil {
+				hasDefault = true
+			}
+			if !c.fall && !isTerminating(c.body) {
+				return false
+			}
+		}
+		return hasDefault && !n.brk
+	case *Branch:
+		return n.tok == "goto"
+	}
+	return false
+}
+
+// representable reports whether v can be represented by a value of ty.
+func representable(v *big.Int, ty *Type) bool {
+	bits := intBits(ty)
+	if bits == 0 {
+		return true
+	}
+	if isUnsigned(ty) {
+		max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+		return v.Sign() >= 0 && v.Cmp(max) <= 0
+	}
+	min := new(big.Int).Lsh(big.NewInt(-1), bits-1)
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits-1), big.NewInt(1))
+	return v.Cmp(min) >= 0 && v.Cmp(max) <= 0
+}
+
+// intBits returns the number of bits of an integer type, or 0 if ty is
+// not a typed integer.
+func intBits(ty *Type) uint {
+	switch ty.kind {
+	case TY_INT8, TY_UINT8:
 		return 8
-	case TY_STRING:
+	case TY_INT16, TY_UINT16:
 		return 16
-	case TY_PTR:
-		return 8
-	case TY_ARRAY:
-		return 0
-	default:
-		return 0
+	case TY_INT32, TY_UINT32:
+		return 32
+	case TY_INT, TY_INT64, TY_UINT64, TY_UINT, TY_UINTPTR:
+		return 64
 	}
+	return 0
 }
 
-func newNoneType() Type {
-	return Type{TY_NONE, nil, 0, 1}
+// convertConst converts the untyped constant c to ty. An untyped
+// constant assigned to a value of an unknown type takes its default type.
+// A mismatch of types is left to the caller.
+func convertConst(c *IntLit, ty *Type) {
+	if ty.kind == TY_NONE {
+		ty = defaultType(c.ty)
+	}
+	if (c.ty.kind == TY_UNTYPED_BOOL) != (ty.kind == TY_BOOL) {
+		return
+	}
+	if c.ty.kind != TY_UNTYPED_BOOL && !isInteger(ty) {
+		return
+	}
+	if !representable(c.val, ty) {
+		errorAt(c.pos, "constant %s overflows %s", c.val, ty)
+	}
+	c.setType(ty)
 }
 
-func newLiteralType(s string) Type {
-	return Type{typeKind(s), nil, typeSize(typeKind(s)), 1}
+// convertUntyped converts e to ty if e is an untyped constant or an
+// operation on a shift of one, such as `1 << s` in `var y int8 = 1 << s`.
+func convertUntyped(e Expr, ty *Type) {
+	switch n := e.(type) {
+	case *IntLit:
+		if isUntyped(n.ty) {
+			convertConst(n, ty)
+		}
+	case *Binary:
+		if !isUntyped(n.ty) {
+			return
+		}
+		convertUntyped(n.lhs, ty)
+		if n.op != "<<" && n.op != ">>" {
+			convertUntyped(n.rhs, ty)
+		}
+		n.setType(n.lhs.getType())
+	}
 }
 
-func pointerTo(base *Type) Type {
-	return Type{TY_PTR, base, 8, 1}
+// defaultConst gives e its default type if e is an untyped constant or an
+// operation on a shift of one. nil has no default type.
+func defaultConst(e Expr) {
+	if c, ok := e.(*IntLit); ok && isUntyped(c.ty) {
+		convertConst(c, defaultType(c.ty))
+	}
+	if b, ok := e.(*Binary); ok && isUntyped(b.ty) {
+		convertUntyped(b, defaultType(b.ty))
+	}
+	if n, ok := e.(*Nil); ok && n.ty.kind == TY_UNTYPED_NIL {
+		errorAt(n.pos, "use of untyped nil")
+	}
 }
 
-func arrayOf(base *Type, length int) Type {
-	return Type{TY_ARRAY, base, length * typeSize(base.kind), length}
+// The largest shift count of constants.
+const maxShift = 10000
+
+// foldBinary evaluates a binary operation of constants at compile time.
+func foldBinary(op string, l *IntLit, r *IntLit, pos Pos) *IntLit {
+	ty := l.ty
+	if op == "<<" || op == ">>" {
+		checkOperands(l.ty, r.ty, op, pos)
+		if r.val.Sign() < 0 {
+			errorAt(pos, "invalid shift count %s", r.val)
+		}
+		if r.val.Cmp(big.NewInt(maxShift)) > 0 {
+			errorAt(pos, "shift count %s too large", r.val)
+		}
+	} else {
+		// An untyped operand takes the type of the other.
+		if isUntyped(l.ty) && !isUntyped(r.ty) {
+			convertConst(l, r.ty)
+		}
+		if isUntyped(r.ty) && !isUntyped(l.ty) {
+			convertConst(r, l.ty)
+		}
+		checkOperands(l.ty, r.ty, op, pos)
+		if r.ty.kind == TY_UNTYPED_RUNE {
+			// A rune is larger than an integer.
+			ty = r.ty
+		} else {
+			ty = l.ty
+		}
+	}
+
+	v := new(big.Int)
+	switch op {
+	case "+":
+		v.Add(l.val, r.val)
+	case "-":
+		v.Sub(l.val, r.val)
+	case "*":
+		v.Mul(l.val, r.val)
+	case "/", "%":
+		if r.val.Sign() == 0 {
+			errorAt(pos, "invalid operation: division by zero")
+		}
+		if op == "/" {
+			v.Quo(l.val, r.val)
+		} else {
+			v.Rem(l.val, r.val)
+		}
+	case "&":
+		v.And(l.val, r.val)
+	case "|":
+		v.Or(l.val, r.val)
+	case "^":
+		v.Xor(l.val, r.val)
+	case "&^":
+		v.AndNot(l.val, r.val)
+	case "<<":
+		v.Lsh(l.val, uint(r.val.Uint64()))
+	case ">>":
+		v.Rsh(l.val, uint(r.val.Uint64()))
+	case "==", "!=", "<", "<=", ">", ">=":
+		return newBoolConst(compareResult(op, l.val.Cmp(r.val)), untypedType(TY_UNTYPED_BOOL), l.pos)
+	case "&&":
+		return newBoolConst(l.val.Sign() != 0 && r.val.Sign() != 0, ty, l.pos)
+	case "||":
+		return newBoolConst(l.val.Sign() != 0 || r.val.Sign() != 0, ty, l.pos)
+	default:
+		panic(fmt.Sprintf("unexpected operator %s", op))
+	}
+	if !representable(v, ty) {
+		errorAt(pos, "constant %s overflows %s", v, ty)
+	}
+	return &IntLit{v, ty, l.pos}
 }
 
-func supportType(s string) bool {
-	if typeKind(s) == TY_NONE {
-		return false
+// foldString evaluates a concatenation or a comparison of constant
+// strings at compile time.
+func foldString(op string, l *StringLit, r *StringLit, pos Pos) Expr {
+	switch op {
+	case "+", "==", "!=", "<", "<=", ">", ">=":
+		convertString(l, r.ty, r.typed)
+		convertString(r, l.ty, l.typed)
+		typeCheck(l.ty, r.ty, op, pos)
+		if op == "+" {
+			n := &StringLit{l.val + r.val, newLabel(), l.ty, l.typed, l.pos}
+			contents = append(contents, n)
+			return n
+		}
+		return newBoolConst(compareResult(op, strings.Compare(l.val, r.val)), untypedType(TY_UNTYPED_BOOL), l.pos)
 	}
-	return true
+	errorAt(pos, "invalid operation: operator %s not defined on %s", op, l.ty)
+	return nil
 }
 
-func typeCheck(lty *Type, rty *Type, op string) {
-	if lty.kind != rty.kind {
-		panic(fmt.Sprintf("invalid operation %#v %s %#v (mismatched types %s and %s)", lty, op, rty, lty.kind, rty.kind))
+// convertString gives an untyped string constant e the type ty of a
+// string if it is typed.
+func convertString(e Expr, ty *Type, typed bool) {
+	if s, ok := e.(*StringLit); ok && !s.typed && typed && ty.kind == TY_STRING {
+		s.setType(ty)
+		s.typed = true
 	}
 }
 
-func fillSize(ty *Type) {
-	if ty == nil || ty.kind != TY_ARRAY {
-		return
+// isUntypedString reports whether e is an untyped string constant.
+func isUntypedString(e Expr) bool {
+	s, ok := e.(*StringLit)
+	return ok && !s.typed
+}
+
+// compareResult returns the result of a comparison op whose operands
+// compare as cmp, which is negative, 0 or positive.
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
 	}
-	fillSize(ty.base)
-	ty.size = ty.aryLen * ty.base.size
+	return cmp >= 0
+}
+
+// foldBitNot evaluates the bitwise complement of a constant. The bits of
+// an unsigned constant are limited to the size of its type.
+func foldBitNot(c *IntLit, pos Pos) *IntLit {
+	if !isInteger(c.ty) {
+		errorAt(pos, "invalid operation: operator ^ not defined on %s", c.ty)
+	}
+	v := new(big.Int)
+	if isUnsigned(c.ty) {
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), intBits(c.ty)), big.NewInt(1))
+		v.Xor(c.val, mask)
+	} else {
+		v.Not(c.val)
+	}
+	return &IntLit{v, c.ty, pos}
+}
+
+// newBoolConst returns a boolean constant, which is 1 if it is true.
+func newBoolConst(b bool, ty *Type, pos Pos) *IntLit {
+	if b {
+		return &IntLit{big.NewInt(1), ty, pos}
+	}
+	return &IntLit{big.NewInt(0), ty, pos}
 }
 
 func stackSize(locals []*Var) int {
@@ -118,6 +1842,72 @@ func stackSize(locals []*Var) int {
 	return size
 }
 
+// newTemp allocates a local variable without a name for a value of ty in
+// the function being typed.
+func newTemp(ty *Type, pos Pos) *Var {
+	v := &Var{"", 0, true, ty, pos, nil}
+	fillOffset(v)
+	curFn.locals = append(curFn.locals, v)
+	return v
+}
+
+// moveToHeap moves the local variable holding an addressable expression
+// e to the heap, so that its address stays valid after the function
+// returns and a variable declared in a loop is new in every iteration.
+func moveToHeap(e Expr) {
+	switch n := e.(type) {
+	case *Var:
+		if n.isLocal && n.ref == nil {
+			ty := pointerTo(n.ty)
+			n.ref = newTemp(&ty, n.pos)
+		}
+	case *Selector:
+		if n.lhs.getType().kind == TY_STRUCT {
+			moveToHeap(n.lhs)
+		}
+	case *ArrayRef:
+		if n.lhs.getType().kind == TY_ARRAY {
+			moveToHeap(n.lhs)
+		}
+	}
+}
+
+// isCompositeLit reports whether e is a struct, array, slice or map
+// literal.
+func isCompositeLit(e Expr) bool {
+	switch n := e.(type) {
+	case *CompositeLit, *MapLit:
+		return true
+	case *SliceExpr:
+		// A slice literal slices its array literal.
+		lhs := n.lhs
+		if d, ok := lhs.(*Deref); ok {
+			lhs = d.child
+		}
+		if a, ok := lhs.(*Addr); ok {
+			_, ok = a.child.(*CompositeLit)
+			return ok
+		}
+	}
+	return false
+}
+
+// isAddressable reports whether e is a variable in memory.
+func isAddressable(e Expr) bool {
+	switch n := e.(type) {
+	case *Var, *Deref:
+		return true
+	case *ArrayRef:
+		// Elements of a slice are on the heap. Elements of a map move
+		// when the map grows, and those of a string are immutable.
+		k := n.lhs.getType().kind
+		return k == TY_SLICE || k != TY_MAP && k != TY_STRING && isAddressable(n.lhs)
+	case *Selector:
+		return n.tmp == nil
+	}
+	return false
+}
+
 func resetOffset() {
 	varOffset = 0
 }
@@ -131,11 +1921,7 @@ func addType(node interface{}) {
 	switch n := node.(type) {
 	// Expressions. It should have Type field.
 	case *IntLit:
-		if n.ty.kind != TY_NONE {
-			return
-		}
-		ty := newLiteralType("int64")
-		n.setType(&ty)
+		// Untyped constants take their types from the context.
 	case *StringLit:
 		if n.ty.kind == TY_STRING {
 			return
@@ -144,8 +1930,15 @@ func addType(node interface{}) {
 		n.setType(&ty)
 	case *Addr:
 		addType(n.child)
+		if a, ok := n.child.(*ArrayRef); ok && a.lhs.getType().kind == TY_MAP {
+			errorAt(n.pos, "invalid operation: cannot take address of map index expression of type %s", a.ty)
+		}
+		if !isAddressable(n.child) && !isCompositeLit(n.child) {
+			errorAt(n.pos, "invalid operation: cannot take address of non-addressable value")
+		}
 		ty := pointerTo(n.child.getType())
 		n.setType(&ty)
+		moveToHeap(n.child)
 	case *Deref:
 		addType(n.child)
 		if n.child.getType().kind == TY_PTR {
@@ -154,16 +1947,53 @@ func addType(node interface{}) {
 		}
 		ty := newLiteralType("int64")
 		n.setType(&ty)
-	case *Binary:
+	case *Not:
+		addType(n.child)
+		checkBool(n.child.getType(), "!", n.pos)
+	case *BitNot:
+		addType(n.child)
+		checkSingle(n.child)
+		ty := n.child.getType()
+		if ty.kind != TY_NONE && !isInteger(ty) {
+			errorAt(n.pos, "invalid operation: operator ^ not defined on %s", ty)
+		}
+		n.setType(ty)
+	case *Nil:
+		// nil takes its type from the context.
+	case *BuiltinCall:
+		addBuiltinType(n)
+	case *SliceExpr:
+		addSliceType(n)
+	case *MapLit:
+		addMapLitType(n)
+	case *CommaOk:
+		// Assign wraps a map index or a type assertion after adding its
+		// type.
+	case *TypeAssert:
 		addType(n.lhs)
-		addType(n.rhs)
-		typeCheck(n.lhs.getType(), n.rhs.getType(), n.op)
+		checkSingle(n.lhs)
+		checkAssertion(n.lhs.getType(), n.ty, "type assertion", n.pos)
+	case *RangeNext:
+		// Range sets its type.
+	case *Binary:
+		addOperandTypes(n.lhs, n.rhs, n.op)
+		checkSingle(n.lhs)
+		checkSingle(n.rhs)
+		if n.op == "==" || n.op == "!=" {
+			n.rhs = convertOperand(n.lhs.getType(), n.rhs, n.pos)
+			n.lhs = convertOperand(n.rhs.getType(), n.lhs, n.pos)
+		}
+		checkOperands(n.lhs.getType(), n.rhs.getType(), n.op, n.pos)
+		checkDivisor(n.op, n.rhs, n.pos)
+		if k := n.lhs.getType().kind; (k == TY_SLICE || k == TY_MAP || k == TY_FUNC) && !isNil(n.lhs) && !isNil(n.rhs) {
+			errorAt(n.pos, "invalid operation: %s can only be compared to nil", map[TypeKind]string{TY_SLICE: "slice", TY_MAP: "map", TY_FUNC: "func"}[k])
+		}
 		switch n.op {
-		case "+", "-", "*", "/":
-			n.setType(n.lhs.getType())
-		case "==", "!=", "<", "<=":
+		case "==", "!=", "<", "<=", ">", ">=", "&&", "||":
 			ty := newLiteralType("bool")
 			n.setType(&ty)
+		default:
+			n.setType(n.lhs.getType())
 		}
 	case *Var:
 		// Types except array are defined at Assgin node.
@@ -177,23 +2007,93 @@ func addType(node interface{}) {
 	case *ArrayRef:
 		addType(n.lhs)
 		addType(n.rhs)
-		if n.lhs.getType().kind == TY_ARRAY {
+		if ty := n.lhs.getType(); ty.kind == TY_MAP {
+			checkSingle(n.rhs)
+			n.rhs = assignCheck(ty.key, n.rhs, n.rhs.getType(), "map index", n.rhs.getPos())
+			n.setType(ty.base)
+			return
+		}
+		checkIndex(n.rhs)
+		if ty := n.lhs.getType(); ty.kind == TY_PTR && ty.base.kind == TY_ARRAY {
+			// `p[i]` is a shorthand for `(*p)[i]`.
+			n.lhs = &Deref{n.lhs, ty.base, n.pos}
+		}
+		if k := n.lhs.getType().kind; k == TY_ARRAY || k == TY_SLICE {
 			ty := n.lhs.getType()
 			n.setType(ty.base)
 		} else {
-			ty := newLiteralType("int8")
+			ty := newLiteralType("uint8")
 			n.setType(&ty)
 		}
 	case *FuncCall:
-		for _, arg := range n.args {
-			addType(arg)
+		var fn *Function
+		if n.fn != nil {
+			fn = addMethodCall(n)
+		} else {
+			for _, arg := range n.args {
+				addType(arg)
+			}
+			fn = findFunc(n.name)
+		}
+		checkArgs(n, fn)
+		switch len(fn.results) {
+		case 0:
+			// The value of a function without results is the value in
+			// RAX, e.g. an exit code returned by main.
+		case 1:
+			n.setType(fn.results[0].ty)
+		default:
+			ty := tupleOf(resultTypes(fn))
+			n.setType(&ty)
+		}
+	case *FuncName:
+		ty := funcOf(n.fn.params, n.fn.results)
+		n.setType(&ty)
+	case *MethodExpr:
+		n.fn = methodExprFunc(n)
+		ty := funcOf(n.fn.params, n.fn.results)
+		n.setType(&ty)
+	case *Selector:
+		addType(n.lhs)
+		addSelectorType(n)
+	case *CompositeLit:
+		for i, v := range n.vals {
+			addType(v)
+			checkSingle(v)
+			n.vals[i] = assignCheck(n.fields[i].ty, v, v.getType(), "struct literal", v.getPos())
+		}
+		if !n.heap {
+			n.tmp = newTemp(n.ty, n.pos)
+		}
+	case *Conv:
+		addType(n.child)
+		checkSingle(n.child)
+		defaultConst(n.child)
+		if !convertible(n.child.getType(), n.ty) {
+			errorAt(n.pos, "cannot convert value of type %s to type %s", n.child.getType(), n.ty)
 		}
+	case *Blank:
+		// Assign handles `_` on its left side.
+		errorAt(n.pos, "cannot use _ as value")
 	// Statements.
+	case *OpAssign:
+		addOperandTypes(n.lhs, n.rhs, n.op)
+		checkSingle(n.lhs)
+		checkSingle(n.rhs)
+		checkOperands(n.lhs.getType(), n.rhs.getType(), n.op, n.pos)
+		checkDivisor(n.op, n.rhs, n.pos)
+		checkAssignable(n.lhs)
+	case *VarDecl:
+		addType(n.v)
 	case *Empty:
 	case *ExprStmt:
 		addType(n.child)
+		defaultConst(n.child)
 	case *Return:
-		addType(n.child)
+		for _, c := range n.children {
+			addType(c)
+		}
+		checkReturn(n)
 	case *Block:
 		for _, c := range n.children {
 			addType(c)
@@ -203,6 +2103,7 @@ func addType(node interface{}) {
 			addType(n.init)
 		}
 		addType(n.cond)
+		defaultConst(n.cond)
 		addType(n.then)
 		if n.els != nil {
 			addType(n.els)
@@ -213,23 +2114,62 @@ func addType(node interface{}) {
 		}
 		if !isEmpty(n.cond) {
 			addType(n.cond)
+			defaultConst(n.cond)
 		}
 		addType(n.then)
 		if !isEmpty(n.post) {
 			addType(n.post)
 		}
+	case *Range:
+		addRangeType(n)
+	case *Labeled:
+		addType(n.stmt)
+	case *Branch:
+	case *Switch:
+		addSwitchType(n)
 	case *Assign:
-		if len(n.lvals) != len(n.rvals) {
-			panic(fmt.Sprintf("not same length %d != %d", len(n.lvals), len(n.rvals)))
+		for _, r := range n.rvals {
+			addType(r)
+		}
+		if len(n.lvals) == 2 && len(n.rvals) == 1 {
+			n.rvals[0] = commaOk(n.rvals[0])
+		}
+		types := valueTypes(n.rvals)
+		if len(n.lvals) != len(types) {
+			if call, ok := n.rvals[0].(*FuncCall); ok && len(n.rvals) == 1 {
+				errorAt(n.pos, "assignment mismatch: %s but %s() returns %s", count(len(n.lvals), "variable"), call.name, count(len(types), "value"))
+			}
+			errorAt(n.pos, "assignment mismatch: %s but %s", count(len(n.lvals), "variable"), count(len(n.rvals), "value"))
 		}
 		for i := range n.lvals {
+			if types[i].kind == TY_UNTYPED_NIL && n.lvals[i].getType().kind == TY_NONE {
+				errorAt(n.rvals[i].getPos(), "use of untyped nil in assignment")
+			}
+			if _, ok := n.lvals[i].(*Blank); ok {
+				if len(n.rvals) == len(n.lvals) {
+					defaultConst(n.rvals[i])
+					types[i] = n.rvals[i].getType()
+				}
+				if n.lvals[i].getType().kind == TY_NONE {
+					n.lvals[i].setType(types[i])
+				}
+				continue
+			}
 			addType(n.lvals[i])
-			addType(n.rvals[i])
+			checkAssignable(n.lvals[i])
 			if n.lvals[i].getType().kind == TY_NONE {
-				n.lvals[i].setType(n.rvals[i].getType())
+				n.lvals[i].setType(defaultType(types[i]))
 			}
-			if n.rvals[i].getType().kind == TY_NONE {
-				n.rvals[i].setType(n.lvals[i].getType())
+			var rhs Expr
+			if len(n.rvals) == len(n.lvals) {
+				rhs = n.rvals[i]
+				if rhs.getType().kind == TY_NONE {
+					rhs.setType(n.lvals[i].getType())
+				}
+			}
+			rhs = assignCheck(n.lvals[i].getType(), rhs, types[i], "assignment", n.pos)
+			if rhs != nil {
+				n.rvals[i] = rhs
 			}
 
 			// allocate offset to local variables which is assigned a specific type just above.
@@ -240,10 +2180,6 @@ func addType(node interface{}) {
 				}
 			}
 		}
-	case *Stdlib:
-		for _, arg := range n.args {
-			addType(arg)
-		}
 	default:
 		panic(fmt.Sprintf("unexpected node type %#v", n))
 	}